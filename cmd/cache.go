@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/sebastianappelberg/disk/pkg/cache"
+	"github.com/sebastianappelberg/disk/pkg/config"
+	"github.com/sebastianappelberg/disk/pkg/storage"
+	"github.com/spf13/cobra"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// rebuiltCaches are the caches that disk rebuilds on its own, so they're cleared without asking. The rest hold
+// things like excluded folders and the items in the trash, which are lost if they're cleared.
+var rebuiltCaches = []string{"index"}
+
+func NewCmdCache() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "cache",
+		Short: "Show and clear what disk stores in its app dir.",
+		Long: `Show and clear what disk stores in its app dir.
+
+The index of scanned folders makes repeated runs fast, clear it if the sizes seem off.`,
+	}
+
+	cmd.AddCommand(newCmdCacheStats())
+	cmd.AddCommand(newCmdCacheClear())
+
+	return cmd
+}
+
+func newCmdCacheStats() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "stats",
+		Short: "List the caches along with their size and number of entries.",
+		Run: func(cmd *cobra.Command, args []string) {
+			stats, err := cache.List(config.GetAppDir())
+			if err != nil {
+				log.Fatal(err)
+			}
+			if len(stats) == 0 {
+				fmt.Printf("There are no caches in %s.\n", config.GetAppDir())
+				return
+			}
+			total := int64(0)
+			w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, '\t', 0)
+			fmt.Fprintln(w, "Cache\tEntries\tSize\tUpdated")
+			for _, s := range stats {
+				total += s.Size
+				entries := "?"
+				if s.Err != nil {
+					entries = "corrupt"
+				} else if s.Entries >= 0 {
+					entries = fmt.Sprint(s.Entries)
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", s.Name, entries, storage.FormatSize(s.Size), s.Flushed.Format(time.DateTime))
+			}
+			fmt.Fprintf(w, "Total:\t\t%s\t\n", storage.FormatSize(total))
+			w.Flush()
+		},
+	}
+
+	return cmd
+}
+
+func newCmdCacheClear() *cobra.Command {
+	var yes bool
+
+	var cmd = &cobra.Command{
+		Use:   "clear [cache]...",
+		Short: "Clear the index of scanned folders, or the given caches.",
+		Run: func(cmd *cobra.Command, args []string) {
+			names := args
+			if len(names) == 0 {
+				names = rebuiltCaches
+			}
+			stats, err := cache.List(config.GetAppDir())
+			if err != nil {
+				log.Fatal(err)
+			}
+			existing := make([]string, 0, len(stats))
+			for _, s := range stats {
+				existing = append(existing, s.Name)
+			}
+			for _, name := range names {
+				if !slices.Contains(existing, name) {
+					if len(args) == 0 {
+						// The default caches don't have to exist.
+						continue
+					}
+					log.Fatalf("unknown cache %q, expected one of %s", name, strings.Join(existing, ", "))
+				}
+				if !yes && !slices.Contains(rebuiltCaches, name) &&
+					!confirm(fmt.Sprintf("The %s cache isn't rebuilt by disk, clear it anyway?", name)) {
+					continue
+				}
+				err = cache.Clear(config.GetAppDir(), name)
+				if err != nil {
+					log.Fatal(err)
+				}
+				fmt.Printf("Cleared the %s cache.\n", name)
+			}
+		},
+	}
+
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Don't ask for confirmation.")
+
+	return cmd
+}
@@ -1,22 +1,35 @@
 package cmd
 
 import (
+	"bytes"
+	"cmp"
+	"context"
 	"fmt"
 	"github.com/charmbracelet/bubbles/help"
 	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/bubbles/table"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/glamour"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/sebastianappelberg/disk/pkg/clean"
+	"github.com/sebastianappelberg/disk/pkg/clutter"
+	"github.com/sebastianappelberg/disk/pkg/config"
+	"github.com/sebastianappelberg/disk/pkg/history"
+	"github.com/sebastianappelberg/disk/pkg/largefiles"
 	"github.com/sebastianappelberg/disk/pkg/storage"
+	"github.com/sebastianappelberg/disk/pkg/util"
 	"github.com/sebastianappelberg/mathx"
 	"github.com/spf13/cobra"
 	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
 	"runtime"
 	"slices"
 	"strings"
 	"sync"
+	"text/tabwriter"
 	"time"
 )
 
@@ -26,22 +39,133 @@ var (
 		BorderForeground(lipgloss.Color("240"))
 )
 
-const minTableWidth = 67
+const (
+	minTableWidth = 67
+	// minDialogWidth is the narrowest the dialog next to the table can be. The dialog is shown on top of the table
+	// instead when the window is narrower than that, see KeyMap.Details.
+	minDialogWidth = 60
+)
 
 type KeyMap struct {
-	Up      key.Binding
-	Down    key.Binding
-	Delete  key.Binding
-	Exclude key.Binding
-	Exit    key.Binding
+	Up           key.Binding
+	Down         key.Binding
+	Select       key.Binding
+	SelectAll    key.Binding
+	Invert       key.Binding
+	Delete       key.Binding
+	Exclude      key.Binding
+	KeepNext     key.Binding
+	SortSize     key.Binding
+	SortLastUsed key.Binding
+	SortPath     key.Binding
+	Filter       key.Binding
+	Details      key.Binding
+	Help         key.Binding
+	Exit         key.Binding
 }
 
 func (k KeyMap) ShortHelp() []key.Binding {
-	return []key.Binding{k.Up, k.Down, k.Delete, k.Exclude, k.Exit}
+	return []key.Binding{k.Up, k.Down, k.Select, k.Delete, k.Exclude, k.Filter, k.Details, k.Help, k.Exit}
 }
 
 func (k KeyMap) FullHelp() [][]key.Binding {
-	return [][]key.Binding{{k.Up, k.Down, k.Delete}}
+	return [][]key.Binding{
+		{k.Up, k.Down, k.Filter},
+		{k.Select, k.SelectAll, k.Invert},
+		{k.Delete, k.Exclude, k.KeepNext},
+		{k.SortSize, k.SortLastUsed, k.SortPath},
+		{k.Details, k.Help, k.Exit},
+	}
+}
+
+func defaultKeyMap() KeyMap {
+	return KeyMap{
+		Up: key.NewBinding(
+			key.WithKeys("up", "k"),
+			key.WithHelp("↑/k", "up"),
+		),
+		Down: key.NewBinding(
+			key.WithKeys("down", "j"),
+			key.WithHelp("↓/j", "down"),
+		),
+		Select: key.NewBinding(
+			key.WithKeys(" "),
+			key.WithHelp("space", "select"),
+		),
+		SelectAll: key.NewBinding(
+			key.WithKeys("a"),
+			key.WithHelp("a", "select all"),
+		),
+		Invert: key.NewBinding(
+			key.WithKeys("i"),
+			key.WithHelp("i", "invert selection"),
+		),
+		Delete: key.NewBinding(
+			key.WithKeys("w", "backspace"),
+			key.WithHelp("w/backspace", "delete"),
+		),
+		Exclude: key.NewBinding(
+			key.WithKeys("e", "enter"),
+			key.WithHelp("e/enter", "exclude"),
+		),
+		KeepNext: key.NewBinding(
+			key.WithKeys("c"),
+			key.WithHelp("c", "keep another copy"),
+		),
+		SortSize: key.NewBinding(
+			key.WithKeys("s"),
+			key.WithHelp("s", "sort by size"),
+		),
+		SortLastUsed: key.NewBinding(
+			key.WithKeys("t"),
+			key.WithHelp("t", "sort by last used"),
+		),
+		SortPath: key.NewBinding(
+			key.WithKeys("p"),
+			key.WithHelp("p", "sort by path"),
+		),
+		Filter: key.NewBinding(
+			key.WithKeys("/"),
+			key.WithHelp("/", "filter"),
+		),
+		Details: key.NewBinding(
+			key.WithKeys("d"),
+			key.WithHelp("d", "details"),
+			// It's only needed when the window is too narrow to show the details next to the table.
+			key.WithDisabled(),
+		),
+		Help: key.NewBinding(
+			key.WithKeys("?"),
+			key.WithHelp("?", "more"),
+		),
+		Exit: key.NewBinding(
+			key.WithKeys("q", "ctrl+c"),
+			key.WithHelp("q/ctrl+c", "quit"),
+		),
+	}
+}
+
+type sortColumn int
+
+const (
+	// sortNone keeps the order the analyzers returned the files in.
+	sortNone sortColumn = iota
+	sortSize
+	sortLastUsed
+	sortPath
+)
+
+type actionKind int
+
+const (
+	actionDelete actionKind = iota
+	actionExclude
+)
+
+// batchAction is an action on the selected files that is waiting for the user to confirm it.
+type batchAction struct {
+	kind  actionKind
+	files []clean.CleanableFile
 }
 
 type model struct {
@@ -49,70 +173,456 @@ type model struct {
 	help           help.Model
 	keyMap         KeyMap
 	windowWidth    int
+	windowHeight   int
 	dialogWidth    int
 	dialogHeight   int
+	showDetails    bool // showDetails shows the dialog on top of the table, when it doesn't fit next to it.
 	tableWidth     int
 	totalReclaimed int64
 	total          int64
+	spinner        spinner.Model
+	root           string
+	sizeMode       storage.SizeMode // sizeMode decides whether the allocated size, the apparent size or both are shown.
+	analyzers      []clean.Analyzer
+	fileCh         <-chan clean.Event // fileCh receives the files found by the analyzers.
+	progress       *clean.Progress
+	analyzing      bool // analyzing is true until all analyzers are done.
 	cleanableFiles []clean.CleanableFile
+	visible        []clean.CleanableFile // visible holds the files shown in the table, i.e. filtered and sorted.
+	sortBy         sortColumn
+	sortDesc       bool
+	filter         string
+	filtering      bool            // filtering is true while the filter is being typed.
+	selected       map[string]bool // selected holds the paths of the selected files.
+	confirm        *batchAction    // confirm is the batch action waiting for confirmation, nil when there is none.
 	inProgressWg   *sync.WaitGroup
+	actionCtx      context.Context // actionCtx is cancelled to skip the actions that haven't started yet.
+	journal        *history.Journal
+	sessionID      string
+	results        *sessionResults
+}
+
+// filesMsg holds the files that the analyzers have found, or retracted, since the last filesMsg.
+type filesMsg []clean.Event
+
+type analysisDoneMsg struct{}
+
+// maxFilesPerMsg limits how many files are added to the table at once.
+const maxFilesPerMsg = 100
+
+// waitForFiles waits for the analyzers to find files. Files that are found at the same time are batched
+// to avoid rebuilding the table for every single file.
+func waitForFiles(fileCh <-chan clean.Event) tea.Cmd {
+	return func() tea.Msg {
+		event, ok := <-fileCh
+		if !ok {
+			return analysisDoneMsg{}
+		}
+		files := filesMsg{event}
+		for len(files) < maxFilesPerMsg {
+			select {
+			case event, ok := <-fileCh:
+				if !ok {
+					// The next wait returns analysisDoneMsg immediately.
+					return files
+				}
+				files = append(files, event)
+			default:
+				return files
+			}
+		}
+		return files
+	}
 }
 
 func (m model) Init() tea.Cmd {
-	//return m.spinner.Tick
-	return nil
+	return tea.Batch(m.spinner.Tick, waitForFiles(m.fileCh))
 }
 
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmd tea.Cmd
 	switch msg := msg.(type) {
+	case filesMsg:
+		for _, event := range msg {
+			if event.Retracted {
+				m.retract(event.File)
+				continue
+			}
+			m.total += event.File.Size
+			m.fitPath(displayPath(event.File))
+			m.cleanableFiles = append(m.cleanableFiles, event.File)
+		}
+		m.refreshRows()
+		return m, waitForFiles(m.fileCh)
+	case analysisDoneMsg:
+		m.analyzing = false
+		m.resize()
+		return m, nil
+	case spinner.TickMsg:
+		if !m.analyzing {
+			// Stop ticking once there's no progress left to show.
+			return m, nil
+		}
+		m.spinner, cmd = m.spinner.Update(msg)
+		return m, cmd
 	case tea.WindowSizeMsg:
-		height := msg.Height - 5
 		m.windowWidth = msg.Width
-		m.table.SetHeight(height)
+		m.windowHeight = msg.Height
 		m.dialogWidth = msg.Width - m.tableWidth - 14
-		m.dialogHeight = height + 3
+		m.resize()
 	case tea.KeyMsg:
-		switch msg.String() {
-		case "esc":
-			if m.table.Focused() {
+		if m.showDetails {
+			return m.updateDetails(msg)
+		}
+		if m.confirm != nil {
+			return m.updateConfirm(msg)
+		}
+		if m.filtering {
+			return m.updateFilter(msg)
+		}
+		switch {
+		case msg.String() == "esc":
+			if m.filter != "" {
+				m.filter = ""
+				m.refreshRows()
+			} else if m.table.Focused() {
 				m.table.Blur()
 			} else {
 				m.table.Focus()
 			}
-		case "q", "ctrl+c":
+		case key.Matches(msg, m.keyMap.Exit):
 			return m, tea.Quit
-		case "e", "enter":
-			cursor := m.table.Cursor()
-			if len(m.table.Rows()) > 0 && cursor < len(m.table.Rows()) {
-				file := m.cleanableFiles[cursor]
-				m.total -= file.Size
-				m.asyncAction(func() {
-					file.Exclude()
-				})
-				slices.Delete(m.cleanableFiles, cursor, cursor+1)
-				m.table.SetRows(slices.Delete(m.table.Rows(), cursor, cursor+1))
+		case key.Matches(msg, m.keyMap.Help):
+			m.help.ShowAll = !m.help.ShowAll
+			m.resize()
+			return m, nil
+		case key.Matches(msg, m.keyMap.Filter):
+			m.filtering = true
+			return m, nil
+		case key.Matches(msg, m.keyMap.Details):
+			m.showDetails = true
+			return m, nil
+		case key.Matches(msg, m.keyMap.SortSize):
+			m.sort(sortSize)
+			return m, nil
+		case key.Matches(msg, m.keyMap.SortLastUsed):
+			m.sort(sortLastUsed)
+			return m, nil
+		case key.Matches(msg, m.keyMap.SortPath):
+			m.sort(sortPath)
+			return m, nil
+		case key.Matches(msg, m.keyMap.Select):
+			if file, ok := m.cursorFile(); ok {
+				m.selected[file.Path] = !m.selected[file.Path]
+				m.refreshRows()
+				m.table.MoveDown(1)
 			}
-		case "w", "backspace":
-			cursor := m.table.Cursor()
-			if len(m.table.Rows()) > 0 && cursor < len(m.table.Rows()) {
-				file := m.cleanableFiles[cursor]
-				m.total += file.Size
-				m.asyncAction(func() {
-					err := file.Remove()
-					if err != nil {
-						log.Printf("error putting %q in the trash: %v", file.Path, err)
-					}
-				})
-				slices.Delete(m.cleanableFiles, cursor, cursor+1)
-				m.table.SetRows(slices.Delete(m.table.Rows(), cursor, cursor+1))
+			return m, nil
+		case key.Matches(msg, m.keyMap.SelectAll):
+			// Select all visible files unless all of them already are selected, in which case they're deselected.
+			selectAll := slices.ContainsFunc(m.visible, func(file clean.CleanableFile) bool {
+				return !m.selected[file.Path]
+			})
+			for _, file := range m.visible {
+				m.selected[file.Path] = selectAll
+			}
+			m.refreshRows()
+			return m, nil
+		case key.Matches(msg, m.keyMap.Invert):
+			for _, file := range m.visible {
+				m.selected[file.Path] = !m.selected[file.Path]
+			}
+			m.refreshRows()
+			return m, nil
+		case key.Matches(msg, m.keyMap.Exclude):
+			return m.act(actionExclude), nil
+		case key.Matches(msg, m.keyMap.Delete):
+			return m.act(actionDelete), nil
+		case key.Matches(msg, m.keyMap.KeepNext):
+			if file, ok := m.cursorFile(); ok && file.KeepOne {
+				m.keepNext(file)
 			}
+			return m, nil
 		}
 	}
 	m.table, cmd = m.table.Update(msg)
 	return m, cmd
 }
 
+// updateDetails handles the keys while the dialog is shown on top of the table.
+func (m model) updateDetails(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case key.Matches(msg, m.keyMap.Exit):
+		return m, tea.Quit
+	case key.Matches(msg, m.keyMap.Details), msg.String() == "esc":
+		m.showDetails = false
+	}
+	return m, nil
+}
+
+// updateFilter handles the keys typed while editing the filter. The table is filtered as you type.
+func (m model) updateFilter(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyCtrlC:
+		return m, tea.Quit
+	case tea.KeyEnter:
+		m.filtering = false
+		return m, nil
+	case tea.KeyEsc:
+		m.filtering = false
+		m.filter = ""
+	case tea.KeyBackspace:
+		runes := []rune(m.filter)
+		if len(runes) > 0 {
+			m.filter = string(runes[:len(runes)-1])
+		}
+	case tea.KeyRunes, tea.KeySpace:
+		m.filter += string(msg.Runes)
+	default:
+		return m, nil
+	}
+	m.refreshRows()
+	m.table.GotoTop()
+	return m, nil
+}
+
+// sort sorts the table by column. Sorting by the same column again reverses the order.
+func (m *model) sort(column sortColumn) {
+	if m.sortBy == column {
+		m.sortDesc = !m.sortDesc
+	} else {
+		m.sortBy = column
+		// Biggest and oldest first is what you're most likely looking for.
+		m.sortDesc = column == sortSize
+	}
+	m.refreshRows()
+	m.table.GotoTop()
+}
+
+// resize fits the table to the window, leaving room for the help which is taller when all of it is shown
+// and the status line which is shown during the analysis.
+func (m *model) resize() {
+	height := m.windowHeight - 5
+	if m.help.ShowAll {
+		height -= lipgloss.Height(m.help.View(m.keyMap)) - 1
+	}
+	if m.analyzing {
+		height--
+	}
+	m.table.SetHeight(height)
+	m.dialogHeight = m.windowHeight - 2
+	m.keyMap.Details.SetEnabled(m.narrow())
+	if !m.narrow() {
+		m.showDetails = false
+	}
+}
+
+// narrow checks if the window is too narrow for the dialog to be shown next to the table.
+func (m model) narrow() bool {
+	return m.dialogWidth < minDialogWidth
+}
+
+// fitPath widens the path column if path doesn't fit in it.
+func (m *model) fitPath(path string) {
+	columns := m.table.Columns()
+	width := len(strings.TrimPrefix(path, m.root))
+	if width <= columns[1].Width {
+		return
+	}
+	m.tableWidth += width - columns[1].Width
+	m.dialogWidth = m.windowWidth - m.tableWidth - 14
+	columns[1].Width = width
+	m.table.SetColumns(columns)
+	m.resize()
+}
+
+// updateConfirm handles the answer to the confirmation prompt of a batch action.
+func (m model) updateConfirm(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	action := m.confirm
+	m.confirm = nil
+	switch msg.String() {
+	case "y", "Y":
+		return m.apply(action.kind, action.files), nil
+	case "ctrl+c":
+		return m, tea.Quit
+	}
+	// Anything else cancels the action.
+	return m, nil
+}
+
+// act performs the action on the selected files after asking for confirmation,
+// or directly on the file under the cursor if nothing is selected.
+func (m model) act(kind actionKind) model {
+	selected := m.selectedFiles()
+	if len(selected) > 0 {
+		m.confirm = &batchAction{kind: kind, files: selected}
+		return m
+	}
+	if file, ok := m.cursorFile(); ok {
+		return m.apply(kind, []clean.CleanableFile{file})
+	}
+	return m
+}
+
+// apply performs the action on the files in the background and removes them from the table.
+func (m model) apply(kind actionKind, files []clean.CleanableFile) model {
+	handled := make(map[string]bool)
+	for _, file := range files {
+		handled[file.Path] = true
+		delete(m.selected, file.Path)
+		switch kind {
+		case actionExclude:
+			m.total -= file.Size
+			m.results.addExclusion()
+		case actionDelete:
+			m.totalReclaimed += file.Size
+			m.asyncAction(func() {
+				m.remove(file)
+			})
+		}
+	}
+	if kind == actionExclude {
+		// Exclusions are written to the same file so there's no point in doing them concurrently.
+		m.asyncAction(func() {
+			for _, file := range files {
+				file.Exclude()
+			}
+		})
+	}
+	m.cleanableFiles = slices.DeleteFunc(m.cleanableFiles, func(file clean.CleanableFile) bool {
+		return handled[file.Path]
+	})
+	m.refreshRows()
+	m.table.SetCursor(m.table.Cursor())
+	return m
+}
+
+// retract removes the file from the table, if it's still there, since an analyzer that comes first has claimed it.
+func (m *model) retract(file clean.CleanableFile) {
+	i := slices.IndexFunc(m.cleanableFiles, func(f clean.CleanableFile) bool {
+		// Another copy of a duplicate may have been kept since it was found.
+		return f.Analyzer == file.Analyzer && (f.Path == file.Path || f.KeepOne && slices.Contains(f.PathsToRemove, file.Path))
+	})
+	if i < 0 {
+		return
+	}
+	m.total -= m.cleanableFiles[i].Size
+	delete(m.selected, m.cleanableFiles[i].Path)
+	m.cleanableFiles = slices.Delete(m.cleanableFiles, i, i+1)
+}
+
+// keepNext makes the next copy of a duplicate the one that's kept, see clean.CleanableFile.KeepNext.
+func (m *model) keepNext(file clean.CleanableFile) {
+	next := file.KeepNext()
+	i := slices.IndexFunc(m.cleanableFiles, func(f clean.CleanableFile) bool {
+		return f.Path == file.Path
+	})
+	if i < 0 {
+		return
+	}
+	m.cleanableFiles[i] = next
+	if m.selected[file.Path] {
+		delete(m.selected, file.Path)
+		m.selected[next.Path] = true
+	}
+	m.fitPath(displayPath(next))
+	m.refreshRows()
+}
+
+// cursorFile returns the file under the cursor.
+func (m model) cursorFile() (clean.CleanableFile, bool) {
+	cursor := m.table.Cursor()
+	if cursor < 0 || cursor >= len(m.visible) {
+		return clean.CleanableFile{}, false
+	}
+	return m.visible[cursor], true
+}
+
+func (m model) selectedFiles() []clean.CleanableFile {
+	var files []clean.CleanableFile
+	for _, file := range m.cleanableFiles {
+		if m.selected[file.Path] {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// refreshRows updates the rows of the table to match the files, the filter, the sort order and the selection.
+func (m *model) refreshRows() {
+	m.visible = nil
+	for _, file := range m.cleanableFiles {
+		if util.FuzzyMatch(m.filter, strings.TrimPrefix(file.Path, m.root)) {
+			m.visible = append(m.visible, file)
+		}
+	}
+	if m.sortBy != sortNone {
+		slices.SortStableFunc(m.visible, func(a, b clean.CleanableFile) int {
+			result := 0
+			switch m.sortBy {
+			case sortSize:
+				result = cmp.Compare(a.Size, b.Size)
+			case sortLastUsed:
+				result = a.LastUsed.Compare(b.LastUsed)
+			case sortPath:
+				result = strings.Compare(strings.ToLower(a.Path), strings.ToLower(b.Path))
+			}
+			if m.sortDesc {
+				return -result
+			}
+			return result
+		})
+	}
+
+	rows := make([]table.Row, 0, len(m.visible))
+	for _, file := range m.visible {
+		rows = append(rows, m.fileRow(file))
+	}
+	m.table.SetColumns(m.columns())
+	m.table.SetRows(rows)
+}
+
+// columns returns the columns of the table with the sort order and the filter in the titles.
+func (m model) columns() []table.Column {
+	columns := m.table.Columns()
+	titles := map[sortColumn]string{sortPath: "Folder", sortSize: "Size", sortLastUsed: "Last Used"}
+	for i, column := range []sortColumn{sortPath, sortSize, sortLastUsed} {
+		title := titles[column]
+		if column == m.sortBy {
+			title += " ▲"
+			if m.sortDesc {
+				title = titles[column] + " ▼"
+			}
+		}
+		if column == sortPath && (m.filter != "" || m.filtering) {
+			title += fmt.Sprintf(" /%s (%d/%d)", m.filter, len(m.visible), len(m.cleanableFiles))
+		}
+		columns[i+1].Title = title
+	}
+	return columns
+}
+
+func (m model) fileRow(file clean.CleanableFile) table.Row {
+	mark := " "
+	if m.selected[file.Path] {
+		mark = "●"
+	}
+	return table.Row{
+		mark,
+		strings.TrimPrefix(displayPath(file), m.root),
+		file.Usage().Format(m.sizeMode),
+		file.LastUsed.Format(time.DateTime),
+	}
+}
+
+// displayPath returns the path shown in the table. Duplicates show the copy that's kept and how many are removed.
+func displayPath(file clean.CleanableFile) string {
+	if file.KeepOne {
+		return fmt.Sprintf("%s (+%d copies)", file.Path, len(file.PathsToRemove))
+	}
+	return file.Path
+}
+
 func (m model) asyncAction(action func()) {
 	m.inProgressWg.Add(1)
 	go func() {
@@ -121,20 +631,53 @@ func (m model) asyncAction(action func()) {
 	}()
 }
 
+// remove puts the file in the trash and writes the outcome to the journal.
+func (m model) remove(file clean.CleanableFile) {
+	if m.actionCtx.Err() != nil {
+		m.results.addRemoval(file, errRemovalCancelled)
+		return
+	}
+	items, err := file.Remove()
+	entry := history.Entry{
+		Action:   history.ActionRemove,
+		Session:  m.sessionID,
+		Analyzer: file.Analyzer,
+		Path:     file.Path,
+		Paths:    file.PathsToRemove,
+		Trashed:  items,
+		Size:     file.Size,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	m.results.addRemoval(file, err)
+	journalErr := m.journal.Append(entry)
+	if journalErr != nil {
+		m.results.addJournalErr(journalErr)
+	}
+}
+
 func (m model) View() string {
-	if m.windowWidth <= 185 {
-		// If the window is too narrow then skip rendering the help dialog.
+	if !m.narrow() {
+		return lipgloss.JoinHorizontal(lipgloss.Top,
+			lipgloss.JoinVertical(lipgloss.Top,
+				m.tableView(),
+				m.bottomView(),
+			),
+			m.dialogView(m.dialogWidth, m.dialogHeight),
+		)
+	}
+	if m.showDetails {
+		// The window is too narrow for the dialog to be next to the table, so it takes the place of the table.
+		back := key.NewBinding(key.WithKeys("d", "esc"), key.WithHelp("d/esc", "back"))
 		return lipgloss.JoinVertical(lipgloss.Top,
-			m.tableView(),
-			m.bottomView(),
+			m.dialogView(m.windowWidth-4, m.windowHeight-3),
+			" "+m.help.ShortHelpView([]key.Binding{back, m.keyMap.Exit}),
 		)
 	}
-	return lipgloss.JoinHorizontal(lipgloss.Top,
-		lipgloss.JoinVertical(lipgloss.Top,
-			m.tableView(),
-			m.bottomView(),
-		),
-		m.dialogView(),
+	return lipgloss.JoinVertical(lipgloss.Top,
+		m.tableView(),
+		m.bottomView(),
 	)
 }
 
@@ -143,32 +686,127 @@ func (m model) tableView() string {
 }
 
 func (m model) bottomView() string {
-	return baseStyle.Render(
-		lipgloss.JoinHorizontal(lipgloss.Right,
-			" "+m.help.ShortHelpView(m.keyMap.ShortHelp()),
-			m.reclaimedSpaceView(),
-		))
+	left := m.help.View(m.keyMap)
+	if m.filtering {
+		left = m.filterView()
+	} else if m.confirm != nil {
+		left = m.confirmView()
+	}
+	view := lipgloss.JoinHorizontal(lipgloss.Right,
+		" "+left,
+		m.reclaimedSpaceView(),
+	)
+	if m.analyzing {
+		view = lipgloss.JoinVertical(lipgloss.Left, " "+m.statusView(), view)
+	}
+	return baseStyle.Render(view)
 }
 
-func (m model) dialogView() string {
-	in := `# disk clean
+func (m model) statusView() string {
+	status := fmt.Sprintf("%s Scanned %d directories, %s analyzed. Still running: %s",
+		m.spinner.View(),
+		m.progress.Dirs(),
+		storage.FormatSize(m.progress.Bytes()),
+		strings.Join(m.progress.Running(), ", "),
+	)
+	if failed := m.progress.FailedDirs(); failed > 0 {
+		status += fmt.Sprintf(". %d directories could not be scanned", failed)
+	}
+	return status
+}
+
+var confirmStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("229"))
+
+func (m model) confirmView() string {
+	verb := "Delete"
+	if m.confirm.kind == actionExclude {
+		verb = "Exclude"
+	}
+	size := int64(0)
+	for _, file := range m.confirm.files {
+		size += file.Size
+	}
+	return confirmStyle.Render(fmt.Sprintf("%s %d selected items (%s)? y/n", verb, len(m.confirm.files), storage.FormatSize(size)))
+}
+
+func (m model) filterView() string {
+	return confirmStyle.Render(fmt.Sprintf("/%s█", m.filter)) + m.help.Styles.ShortDesc.Render("  enter apply • esc clear")
+}
+
+// analyzersView lists what the analyzers that are run suggest to remove.
+func (m model) analyzersView() string {
+	var b strings.Builder
+	for _, analyzer := range m.analyzers {
+		fmt.Fprintf(&b, "- %s\n", analyzer.Description())
+	}
+	return b.String()
+}
+
+// detailView describes the file under the cursor, including whether and how it can be restored once it's removed.
+func (m model) detailView() string {
+	file, ok := m.cursorFile()
+	if !ok {
+		return ""
+	}
+	var b strings.Builder
+	// Names like __pycache__ would be rendered as emphasis if they weren't in code spans.
+	fmt.Fprintf(&b, "## %s\n\n", codeSpan(filepath.Base(file.Path)))
+	fmt.Fprintf(&b, "- Path: %s\n", codeSpan(file.Path))
+	fmt.Fprintf(&b, "- Size: %s\n", file.Usage().Format(m.sizeMode))
+	fmt.Fprintf(&b, "- Last used: %s\n", file.LastUsed.Format(time.DateTime))
+	if file.Category != "" {
+		fmt.Fprintf(&b, "- Category: %s\n", file.Category)
+	}
+	if file.KeepOne {
+		b.WriteString("- Kept: this file, press `c` to keep another copy\n")
+		b.WriteString("- Removed copies:\n")
+		for _, path := range file.PathsToRemove {
+			fmt.Fprintf(&b, "  - %s\n", codeSpan(path))
+		}
+		return b.String() + "\n"
+	}
+	switch {
+	case file.Restore != "":
+		fmt.Fprintf(&b, "- Regenerable: yes, restore it with `%s`\n", file.Restore)
+	case file.Regenerable:
+		b.WriteString("- Regenerable: yes\n")
+	case file.Analyzer == clean.AnalyzerClutter && file.Category != clutter.GitIgnoredCategory:
+		b.WriteString("- Regenerable: **no**, there's no lockfile to restore the same versions from\n")
+	default:
+		b.WriteString("- Regenerable: **no**, make sure you don't need it anymore\n")
+	}
+	return b.String() + "\n"
+}
+
+// codeSpan returns s as a markdown code span. The span is delimited by more backticks than there are in a row in s.
+func codeSpan(s string) string {
+	fence := "`"
+	for strings.Contains(s, fence) {
+		fence += "`"
+	}
+	if strings.HasPrefix(s, "`") || strings.HasSuffix(s, "`") {
+		s = " " + s + " "
+	}
+	return fence + s + fence
+}
+
+func (m model) dialogView(width, height int) string {
+	in := m.detailView() + `# disk clean
 
 This is a list of pesky space hoggers that **disk clean** _thinks_ can be removed safely.
 Don't worry if you accidentally delete something, deleting from this list means moving it to the recycling bin.
-Speaking of which, to complete the cleaning you'll have to empty your bin.
+Run **disk trash restore** to put something back, and **disk trash empty** to permanently reclaim the space.
+Everything you delete is recorded, run **disk history** to see it and **disk undo** to restore the last session.
 
 Examples of files and folders it will suggest:
-- Clutter in the form caches, dependency folders, build folders, etc. above a given size and age.
-- Steam games you haven't played in a while.
-- Movies and TV shows that are easy to get a hold of even if you delete them.
-
+` + m.analyzersView() + `
 If you exclude a file it will be excluded for all future runs of the **disk clean** command.
-To reset your excluded files, delete the "$HOME/.disk/user_config_cache" file. 
+To reset your excluded files, run **disk cache clear excluded_folders**.
 `
 	r, err := glamour.NewTermRenderer(
 		// detect background color and pick either the default dark or light theme
 		glamour.WithAutoStyle(),
-		glamour.WithWordWrap(m.dialogWidth),
+		glamour.WithWordWrap(width),
 	)
 	if err != nil {
 		log.Fatal(err)
@@ -178,21 +816,139 @@ To reset your excluded files, delete the "$HOME/.disk/user_config_cache" file.
 		log.Fatal(err)
 	}
 	return baseStyle.
-		Height(m.dialogHeight).Render(out)
+		Height(height).Render(out)
 }
 
 var rightStyle = lipgloss.NewStyle().Align(lipgloss.Right).PaddingRight(1)
 
 func (m model) reclaimedSpaceView() string {
+	text := fmt.Sprintf("Reclaimed space: %s/%s", storage.FormatSize(m.totalReclaimed), storage.FormatSize(m.total))
+	if selected := m.selectedFiles(); len(selected) > 0 {
+		size := int64(0)
+		for _, file := range selected {
+			size += file.Size
+		}
+		text = fmt.Sprintf("Selected: %d (%s)  %s", len(selected), storage.FormatSize(size), text)
+	}
 	return rightStyle.
-		Width(m.tableWidth - 67).
-		Render(fmt.Sprintf("Reclaimed space: %s/%s", storage.FormatSize(m.totalReclaimed), storage.FormatSize(m.total)))
+		Width(max(m.tableWidth-67, lipgloss.Width(text)+1)).
+		Render(text)
+}
+
+// warnFailedDirs tells the user that the result is incomplete if some directories couldn't be read.
+func warnFailedDirs(progress *clean.Progress) {
+	if failed := progress.FailedDirs(); failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d directories could not be scanned, e.g. because of missing permissions.\n", failed)
+	}
+}
+
+// warnAccessTimes tells the user that the last used times are off if they're based on access times that the file
+// system doesn't update.
+func warnAccessTimes(root string, ageMode storage.AgeMode) {
+	if ageMode == storage.ModTimeAge {
+		return
+	}
+	// With relatime the access times are updated at most once a day, which is plenty for an age in days.
+	option, err := storage.AccessTimeOption(root)
+	if err == nil && option == "noatime" {
+		fmt.Fprintf(os.Stderr, "%s is on a file system mounted with noatime, so access times aren't updated and files may seem unused when they aren't.\n", root)
+	}
+}
+
+// printSummary prints the reclaimable space per analyzer, clutter category and top-level directory.
+func printSummary(summary clean.Summary) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	sections := []struct {
+		title  string
+		groups []clean.Group
+	}{
+		{"Analyzer", summary.Analyzers},
+		{"Category", summary.Categories},
+		{"Directory", summary.Directories},
+	}
+	for _, section := range sections {
+		if len(section.groups) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "%s\tItems\tSize\n", section.title)
+		for _, group := range section.groups {
+			fmt.Fprintf(w, "%s\t%d\t%s\n", group.Name, group.Count, storage.FormatSize(group.Size))
+		}
+		fmt.Fprintln(w, "\t\t")
+	}
+	fmt.Fprintf(w, "Reclaimable:\t%d\t%s\n", summary.Total.Count, storage.FormatSize(summary.Total.Size))
+	w.Flush()
+}
+
+// newCleanModel creates the table that the files on fileCh are streamed into.
+func newCleanModel(root string, sizeMode storage.SizeMode, analyzers []clean.Analyzer, fileCh <-chan clean.Event, progress *clean.Progress, actionCtx context.Context) model {
+	markColWidth := 1
+	pathColWidth := minTableWidth
+	sizeColWidth := 8
+	if sizeMode == storage.BothSizes {
+		sizeColWidth = 20
+	}
+	lastUsedColWidth := 20
+	columns := []table.Column{
+		{Title: "", Width: markColWidth},
+		{Title: "Folder", Width: pathColWidth},
+		{Title: "Size", Width: sizeColWidth},
+		{Title: "Last Used", Width: lastUsedColWidth},
+	}
+
+	tableKeyMap := table.DefaultKeyMap()
+	// Space is used for selecting rows instead of paging.
+	tableKeyMap.PageDown.SetKeys("f", "pgdown")
+	t := table.New(table.WithColumns(columns), table.WithFocused(true), table.WithKeyMap(tableKeyMap))
+	s := table.DefaultStyles()
+	s.Header = s.Header.
+		BorderForeground(lipgloss.Color("240")).
+		Bold(true)
+	s.Selected = s.Selected.
+		Foreground(lipgloss.Color("229")).
+		Background(lipgloss.Color("57")).
+		Bold(false)
+	t.SetStyles(s)
+
+	tableWidth := markColWidth + pathColWidth + sizeColWidth + lastUsedColWidth
+
+	m := model{
+		table:        t,
+		help:         help.New(),
+		keyMap:       defaultKeyMap(),
+		tableWidth:   tableWidth,
+		spinner:      spinner.New(spinner.WithSpinner(spinner.Dot)),
+		root:         root,
+		sizeMode:     sizeMode,
+		analyzers:    analyzers,
+		fileCh:       fileCh,
+		progress:     progress,
+		analyzing:    true,
+		selected:     make(map[string]bool),
+		inProgressWg: &sync.WaitGroup{},
+		actionCtx:    actionCtx,
+		journal:      history.NewJournal(config.GetAppDir()),
+		sessionID:    history.NewSessionID(),
+		results:      &sessionResults{},
+	}
+	m.refreshRows()
+	return m
 }
 
 func NewCmdClean() *cobra.Command {
 	var minSize int
 	var minAge int
 	var maxPlaytime int
+	var format string
+	var dryRun bool
+	var analyzers []string
+	var oneFileSystem bool
+	var includeUnregenerable bool
+	var gitMode bool
+	var minFileSize int
+	var fileCategories []string
+	var ageBy string
+	var sizeFlags sizeModeFlags
 
 	var cmd = &cobra.Command{
 		Use:   "clean <path>",
@@ -203,108 +959,123 @@ Examples of files and folders it will suggest:
 - Clutter in the form caches, dependency folders, build folders, etc. above a given size and age.
 - Steam games you haven't played in a while.
 - Movies and TV shows that are easy to get a hold of even if you delete them. 
+- Git repositories you haven't touched in a while where everything is pushed, so they can be cloned again.
+- Identical copies of the same file, of which one is kept.
+- Large files you haven't touched in a while, such as archives, disk images and installers.
+
+Use --analyzers to only run some of the analyzers, e.g. --analyzers clutter,games.
+Use --format to skip the TUI and write the result to stdout, e.g. when running in CI or a cron job.
+Use --dry-run to see how much space you would get back before you start deleting anything.
 `,
 		Run: func(cmd *cobra.Command, args []string) {
 			// To be nice on the user's CPU this command will only use 1/2 of the available CPUs.
 			runtime.GOMAXPROCS(mathx.DivCeil(runtime.NumCPU(), 2))
 
 			root := args[0]
-
-			var rows []table.Row
-			longestPath := 0
-			total := int64(0)
-
-			cleanableFiles := clean.Clean(clean.Args{
-				Root:        root,
-				MinAge:      minAge,
-				MinSize:     minSize,
-				MaxPlaytime: maxPlaytime,
-			})
-
-			for _, file := range cleanableFiles {
-				path := strings.TrimPrefix(file.Path, root)
-				if len(path) > longestPath {
-					longestPath = len(path)
+			if format != "" && !slices.Contains(clean.Formats, format) {
+				log.Fatalf("unsupported format %q, expected one of %s", format, strings.Join(clean.Formats, ", "))
+			}
+			for _, category := range fileCategories {
+				if !slices.Contains(largefiles.Categories(), category) {
+					log.Fatalf("unknown file category %q, expected one of %s", category, strings.Join(largefiles.Categories(), ", "))
 				}
-				rows = append(rows, table.Row{
-					path,
-					storage.FormatSize(file.Size),
-					file.ModTime.Format(time.DateTime),
-				})
-				total += file.Size
 			}
-
-			sizeColWidth := 8
-			lastUsedColWidth := 20
-			if longestPath < minTableWidth {
-				longestPath = minTableWidth
+			sizeMode := sizeFlags.sizeMode()
+			ageMode, err := storage.ParseAgeMode(ageBy)
+			if err != nil {
+				log.Fatal(err)
 			}
-			columns := []table.Column{
-				{Title: "Folder", Width: longestPath},
-				{Title: "Size", Width: sizeColWidth},
-				{Title: "Last Used", Width: lastUsedColWidth},
+
+			cleanArgs := clean.Args{
+				Root:                 root,
+				MinAge:               minAge,
+				MinSize:              minSize,
+				MaxPlaytime:          maxPlaytime,
+				Analyzers:            analyzers,
+				OneFileSystem:        oneFileSystem,
+				SizeMode:             sizeMode,
+				IncludeUnregenerable: includeUnregenerable,
+				Git:                  gitMode,
+				MinFileSize:          minFileSize,
+				FileCategories:       fileCategories,
+				AgeMode:              ageMode,
 			}
 
-			keyMap := KeyMap{
-				Up: key.NewBinding(
-					key.WithKeys("up", "k"),
-					key.WithHelp("↑/k", "up"),
-				),
-				Down: key.NewBinding(
-					key.WithKeys("down", "j"),
-					key.WithHelp("↓/j", "down"),
-				),
-				Delete: key.NewBinding(
-					key.WithKeys("w", "backspace"),
-					key.WithHelp("w/backspace", "delete"),
-				),
-				Exclude: key.NewBinding(
-					key.WithKeys("e", "enter"),
-					key.WithHelp("e/enter", "exclude"),
-				),
-				Exit: key.NewBinding(
-					key.WithKeys("q", "ctrl+c"),
-					key.WithHelp("q/ctrl+c", "quit"),
-				),
+			if format != "" || dryRun {
+				ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+				defer stop()
+				progress := &clean.Progress{}
+				cleanableFiles, err := clean.Clean(ctx, cleanArgs, progress)
+				if err != nil {
+					log.Fatal(err)
+				}
+				if ctx.Err() != nil {
+					log.Fatal("Interrupted")
+				}
+				warnFailedDirs(progress)
+				warnAccessTimes(root, ageMode)
+				if dryRun {
+					printSummary(clean.Summarize(root, cleanableFiles))
+					return
+				}
+				err = clean.WriteReport(os.Stdout, cleanableFiles, format)
+				if err != nil {
+					log.Fatal(err)
+				}
+				return
 			}
 
-			t := table.New(table.WithColumns(columns), table.WithRows(rows), table.WithFocused(true))
-			s := table.DefaultStyles()
-			s.Header = s.Header.
-				BorderForeground(lipgloss.Color("240")).
-				Bold(true)
-			s.Selected = s.Selected.
-				Foreground(lipgloss.Color("229")).
-				Background(lipgloss.Color("57")).
-				Bold(false)
-			t.SetStyles(s)
-
-			tableWidth := longestPath + sizeColWidth + lastUsedColWidth
-
-			m := model{
-				table:          t,
-				help:           help.New(),
-				keyMap:         keyMap,
-				tableWidth:     tableWidth,
-				total:          total,
-				cleanableFiles: cleanableFiles,
-				inProgressWg:   &sync.WaitGroup{},
+			// The warning is shown before the alt-screen takes over so that it's there when the table is left.
+			warnAccessTimes(root, ageMode)
+			// The files are streamed into the table as they're found, the path column is widened when needed.
+			progress := &clean.Progress{}
+			cleanAnalyzers, err := clean.NewAnalyzers(analyzers, cleanArgs, &progress.Progress)
+			if err != nil {
+				log.Fatal(err)
 			}
+			// The analysis is cancelled if the TUI is exited before it's done.
+			ctx, cancel := context.WithCancel(cmd.Context())
+			defer cancel()
+			fileCh := clean.Stream(ctx, root, cleanAnalyzers, progress)
+			// The actions have their own context since they outlive the TUI.
+			actionCtx, cancelActions := context.WithCancel(context.Background())
+			defer cancelActions()
+
+			m := newCleanModel(root, sizeMode, cleanAnalyzers, fileCh, progress, actionCtx)
 
-			_, err := tea.NewProgram(m, tea.WithMouseCellMotion(), tea.WithAltScreen()).Run()
+			// Anything logged by the analyzers while the alt-screen is active is lost, so it's printed afterward instead.
+			var logs bytes.Buffer
+			log.SetOutput(&logs)
+			_, err = tea.NewProgram(m, tea.WithMouseCellMotion(), tea.WithAltScreen()).Run()
+			cancel()
+			log.SetOutput(os.Stderr)
+			os.Stderr.Write(logs.Bytes())
 			if err != nil {
 				log.Fatal(err)
 			}
+			warnFailedDirs(progress)
 
-			// TODO: Run spinner.
+			_, _ = tea.NewProgram(newWaitModel(m.inProgressWg, cancelActions)).Run()
+			// The spinner may have failed, either way the actions have to finish before they're reported on.
 			m.inProgressWg.Wait()
-			// TODO: Print deletion report. x files deleted, x GB reclaimed.
+			m.results.printReport(os.Stdout)
 		},
 	}
 
 	cmd.Flags().IntVarP(&minSize, "min-size", "s", 50, "Minimum size of files to include in analysis results specified in megabytes.")
 	cmd.Flags().IntVarP(&minAge, "min-age", "a", 90, "Minimum age of files to include in analysis results specified in days.")
 	cmd.Flags().IntVarP(&maxPlaytime, "max-playtime", "p", 20, "Maximum playtime of games to include in analysis results specified in hours.")
+	cmd.Flags().StringVarP(&format, "format", "f", "", "Skip the TUI and write the result to stdout as 'json', 'csv' or 'ndjson'.")
+	cmd.Flags().BoolVarP(&dryRun, "dry-run", "n", false, "Skip the TUI and print a summary of how much space can be reclaimed.")
+	cmd.Flags().BoolVarP(&oneFileSystem, "one-file-system", "x", false, "Skip directories on different file systems, e.g. mounts.")
+	cmd.Flags().StringSliceVar(&analyzers, "analyzers", clean.Analyzers(), "Comma-separated list of the analyzers to run.")
+	cmd.Flags().BoolVar(&includeUnregenerable, "include-unregenerable", false, "Include dependency folders such as node_modules that don't have a lockfile to restore them from.")
+	cmd.Flags().BoolVar(&gitMode, "git", false, "Also suggest the folders that git repositories ignore, and never anything that they track.")
+	cmd.Flags().IntVar(&minFileSize, "min-file-size", 500, "Minimum size of the files that the large analyzer suggests specified in megabytes.")
+	cmd.Flags().StringVar(&ageBy, "age-by", storage.AgeModeModTime, "Tell when clutter and large files were last used by when they were modified ('mtime'), accessed ('atime') or the 'newest' of the two.")
+	cmd.Flags().StringSliceVar(&fileCategories, "file-categories", nil, fmt.Sprintf("Only suggest large files in these categories: %s. All large files are suggested by default.", strings.Join(largefiles.Categories(), ", ")))
+	sizeFlags.register(cmd)
+	cmd.MarkFlagsMutuallyExclusive("format", "dry-run")
 
 	return cmd
 }
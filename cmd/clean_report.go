@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/charmbracelet/bubbles/spinner"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/sebastianappelberg/disk/pkg/clean"
+	"github.com/sebastianappelberg/disk/pkg/storage"
+	"io"
+	"sync"
+)
+
+// errRemovalCancelled is the outcome of the removals that hadn't started when the actions were cancelled.
+var errRemovalCancelled = errors.New("cancelled before it was put in the trash")
+
+// removalResult is the outcome of putting a single file in the trash.
+type removalResult struct {
+	file clean.CleanableFile
+	err  error
+}
+
+// sessionResults collects the outcome of the actions taken in the clean TUI. The removals happen in
+// the background so they're collected behind a mutex and reported once the TUI has exited, since
+// anything logged while the alt-screen is active is lost.
+type sessionResults struct {
+	mu          sync.Mutex
+	removals    []removalResult
+	excluded    int
+	journalErrs []error
+}
+
+func (r *sessionResults) addRemoval(file clean.CleanableFile, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.removals = append(r.removals, removalResult{file: file, err: err})
+}
+
+func (r *sessionResults) addExclusion() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.excluded++
+}
+
+func (r *sessionResults) addJournalErr(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.journalErrs = append(r.journalErrs, err)
+}
+
+var (
+	reportErrorStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
+	reportTitleStyle = lipgloss.NewStyle().Bold(true)
+)
+
+// printReport prints how many items were removed and excluded, how much space was reclaimed and every removal that failed.
+func (r *sessionResults) printReport(w io.Writer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.removals) == 0 && r.excluded == 0 {
+		return
+	}
+	removed := 0
+	reclaimed := int64(0)
+	var failed []removalResult
+	for _, removal := range r.removals {
+		if removal.err != nil {
+			failed = append(failed, removal)
+			continue
+		}
+		removed++
+		reclaimed += removal.file.Size
+	}
+
+	fmt.Fprintln(w, reportTitleStyle.Render("Deletion report"))
+	fmt.Fprintf(w, "Removed:   %d items\n", removed)
+	fmt.Fprintf(w, "Excluded:  %d items\n", r.excluded)
+	fmt.Fprintf(w, "Reclaimed: %s\n", storage.FormatSize(reclaimed))
+	if len(failed) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, reportErrorStyle.Render(fmt.Sprintf("Failed to remove %d items:", len(failed))))
+		for _, removal := range failed {
+			fmt.Fprintf(w, "  %s: %v\n", removal.file.Path, removal.err)
+		}
+	}
+	for _, err := range r.journalErrs {
+		fmt.Fprintln(w, reportErrorStyle.Render(fmt.Sprintf("Error writing to the history: %v", err)))
+	}
+	if removed > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Run \"disk trash empty\" to permanently reclaim the space or \"disk undo\" to restore everything.")
+	}
+}
+
+type actionsDoneMsg struct{}
+
+// waitModel shows a spinner until all the actions taken in the clean TUI have finished.
+type waitModel struct {
+	spinner      spinner.Model
+	inProgressWg *sync.WaitGroup
+	cancel       context.CancelFunc // cancel cancels the actions that haven't started yet.
+	cancelling   bool
+	done         bool
+}
+
+func newWaitModel(inProgressWg *sync.WaitGroup, cancel context.CancelFunc) waitModel {
+	return waitModel{
+		spinner:      spinner.New(spinner.WithSpinner(spinner.Dot)),
+		inProgressWg: inProgressWg,
+		cancel:       cancel,
+	}
+}
+
+func (m waitModel) Init() tea.Cmd {
+	return tea.Batch(m.spinner.Tick, func() tea.Msg {
+		m.inProgressWg.Wait()
+		return actionsDoneMsg{}
+	})
+}
+
+func (m waitModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case actionsDoneMsg:
+		m.done = true
+		return m, tea.Quit
+	case tea.KeyMsg:
+		// The removals that are in progress can't be aborted halfway, so an interrupt only cancels the ones that
+		// haven't started and the wait goes on until the rest are done, otherwise the report would be incomplete.
+		if msg.String() == "ctrl+c" && !m.cancelling {
+			m.cancelling = true
+			m.cancel()
+		}
+	case spinner.TickMsg:
+		var cmd tea.Cmd
+		m.spinner, cmd = m.spinner.Update(msg)
+		return m, cmd
+	}
+	return m, nil
+}
+
+func (m waitModel) View() string {
+	if m.done {
+		return ""
+	}
+	if m.cancelling {
+		return fmt.Sprintf("%s Cancelling, waiting for the files that are already on their way to the trash...\n", m.spinner.View())
+	}
+	return fmt.Sprintf("%s Putting files in the trash...\n", m.spinner.View())
+}
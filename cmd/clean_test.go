@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sebastianappelberg/disk/pkg/clean"
+	"github.com/sebastianappelberg/disk/pkg/storage"
+)
+
+func TestCleanModelDetailsAt80Columns(t *testing.T) {
+	fileCh := make(chan clean.Event)
+	close(fileCh)
+	m := tea.Model(newCleanModel("/src", storage.ApparentSize, nil, fileCh, &clean.Progress{}, context.Background()))
+	m, _ = m.Update(filesMsg{{File: clean.CleanableFile{Path: "/src/__pycache__", ModTime: time.Now(), Category: "python"}}})
+	m, _ = m.Update(tea.WindowSizeMsg{Width: 80, Height: 40})
+
+	if view := m.View(); strings.Contains(view, "Last used:") {
+		t.Fatalf("the details are shown next to the table at 80 columns:\n%s", view)
+	}
+	m, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("d")})
+	view := m.View()
+	if !strings.Contains(view, "Last used:") {
+		t.Fatalf("the details aren't shown after pressing d:\n%s", view)
+	}
+	// The underscores would be taken for emphasis and dropped if the name wasn't escaped.
+	if !strings.Contains(view, "__pycache__") || !strings.Contains(view, "/src/__pycache__") {
+		t.Errorf("the name isn't rendered as is:\n%s", view)
+	}
+	for _, line := range strings.Split(view, "\n") {
+		if width := len([]rune(line)); width > 80 {
+			t.Errorf("line is %d columns wide, the window is 80: %q", width, line)
+		}
+	}
+
+	m, _ = m.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	if view := m.View(); strings.Contains(view, "Last used:") {
+		t.Errorf("the details are still shown after pressing esc:\n%s", view)
+	}
+}
+
+func TestCleanModelRetract(t *testing.T) {
+	fileCh := make(chan clean.Event)
+	close(fileCh)
+	m := tea.Model(newCleanModel("/src", storage.ApparentSize, nil, fileCh, &clean.Progress{}, context.Background()))
+	movie := clean.CleanableFile{Path: "/src/app/movie.mkv", Size: 10, Analyzer: clean.AnalyzerLargeFiles, PathsToRemove: []string{"/src/app/movie.mkv"}}
+	kept := clean.CleanableFile{Path: "/src/a.zip", Size: 5, Analyzer: clean.AnalyzerDuplicates, PathsToRemove: []string{"/src/b.zip"}, KeepOne: true}
+	m, _ = m.Update(filesMsg{{File: movie}, {File: kept}})
+	// The other copy is kept before the duplicate is retracted.
+	swapped := m.(model)
+	swapped.keepNext(kept)
+	m, _ = swapped.Update(filesMsg{
+		{File: movie, Retracted: true},
+		{File: kept, Retracted: true},
+		{File: clean.CleanableFile{Path: "/src/app", Size: 100, Analyzer: clean.AnalyzerClutter, PathsToRemove: []string{"/src/app"}}},
+	})
+
+	got := m.(model)
+	if len(got.cleanableFiles) != 1 || got.cleanableFiles[0].Path != "/src/app" {
+		t.Errorf("cleanableFiles = %+v; want only /src/app", got.cleanableFiles)
+	}
+	if got.total != 100 {
+		t.Errorf("total = %d; want 100", got.total)
+	}
+}
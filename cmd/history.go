@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/sebastianappelberg/disk/pkg/config"
+	"github.com/sebastianappelberg/disk/pkg/history"
+	"github.com/sebastianappelberg/disk/pkg/storage"
+	"github.com/spf13/cobra"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+func NewCmdHistory() *cobra.Command {
+	var sessions int
+
+	var cmd = &cobra.Command{
+		Use:   "history",
+		Short: "Show what has been removed by disk clean and disk tree -i, grouped by session.",
+		Run: func(cmd *cobra.Command, args []string) {
+			journal := history.NewJournal(config.GetAppDir())
+			all, err := journal.Sessions()
+			if err != nil {
+				log.Fatal(err)
+			}
+			if len(all) == 0 {
+				fmt.Println("Nothing has been removed yet.")
+				return
+			}
+			if sessions > 0 && len(all) > sessions {
+				all = all[len(all)-sessions:]
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, '\t', 0)
+			// Most recent session first, since that's the one that's most likely to be undone.
+			for i := len(all) - 1; i >= 0; i-- {
+				session := all[i]
+				fmt.Fprintf(w, "Session %s (%s): %d items, %s\n", session.ID, session.Start.Format(time.DateTime), len(session.Entries), storage.FormatSize(session.Size()))
+				for _, entry := range session.Entries {
+					status := "removed"
+					if entry.Failed() {
+						status = "failed: " + entry.Error
+					}
+					fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\n", entry.Timestamp.Format(time.DateTime), entry.Analyzer, storage.FormatSize(entry.Size), entry.Path, status)
+				}
+			}
+			w.Flush()
+		},
+	}
+
+	cmd.Flags().IntVarP(&sessions, "sessions", "n", 10, "Number of sessions to show, 0 shows all of them.")
+
+	return cmd
+}
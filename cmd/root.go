@@ -12,11 +12,25 @@ func NewCmdRoot() *cobra.Command {
 		Short:   "disk is a tool that helps you identify files that you can remove.",
 		Long:    "disk is a tool that helps you identify files that you can remove.",
 		Version: version,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			loadUserConfig(cmd, args)
+		},
 	}
 
+	// The help doesn't run PersistentPreRun, load the config so that it shows the defaults from it.
+	defaultHelp := cmd.HelpFunc()
+	cmd.SetHelpFunc(func(cmd *cobra.Command, args []string) {
+		loadUserConfig(cmd, nil)
+		defaultHelp(cmd, args)
+	})
+
 	// Subcommands
+	cmd.AddCommand(NewCmdCache())
 	cmd.AddCommand(NewCmdClean())
+	cmd.AddCommand(NewCmdHistory())
+	cmd.AddCommand(NewCmdTrash())
 	cmd.AddCommand(NewCmdTree())
+	cmd.AddCommand(NewCmdUndo())
 	cmd.AddCommand(NewCmdUsage())
 
 	return cmd
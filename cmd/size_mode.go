@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"log"
+
+	"github.com/sebastianappelberg/disk/pkg/storage"
+	"github.com/spf13/cobra"
+)
+
+// sizeModeFlags are the flags that decide whether the disk space that files use, their apparent size or both is shown.
+type sizeModeFlags struct {
+	mode         string
+	apparentSize bool
+}
+
+func (f *sizeModeFlags) register(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&f.mode, "size-mode", storage.SizeModeAllocated, "Show the 'allocated' size of files, i.e. the disk space they use, their 'apparent' size or 'both'.")
+	cmd.Flags().BoolVar(&f.apparentSize, "apparent-size", false, "Show the number of bytes in files instead of the disk space they use, same as --size-mode=apparent.")
+}
+
+// sizeMode returns the size mode that the flags ask for and exits if it's invalid.
+func (f *sizeModeFlags) sizeMode() storage.SizeMode {
+	if f.apparentSize {
+		return storage.ApparentSize
+	}
+	mode, err := storage.ParseSizeMode(f.mode)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return mode
+}
@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/sebastianappelberg/disk/pkg/storage"
+	"github.com/sebastianappelberg/disk/pkg/trash"
+	"github.com/sebastianappelberg/disk/pkg/util"
+	"github.com/spf13/cobra"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+func NewCmdTrash() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "trash",
+		Short: "List, restore and empty the files and folders that disk has put in the trash.",
+		Long: `List, restore and empty the files and folders that disk has put in the trash.
+
+Only items that were removed with disk are affected, the rest of the trash is left alone.`,
+	}
+
+	cmd.AddCommand(newCmdTrashList())
+	cmd.AddCommand(newCmdTrashRestore())
+	cmd.AddCommand(newCmdTrashEmpty())
+
+	return cmd
+}
+
+func newCmdTrashList() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "list",
+		Short: "List the items that disk has put in the trash.",
+		Run: func(cmd *cobra.Command, args []string) {
+			items := trash.List()
+			if len(items) == 0 {
+				fmt.Println("There are no items from disk in the trash.")
+				return
+			}
+			total := int64(0)
+			w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, '\t', 0)
+			fmt.Fprintln(w, "Item\tOriginal path\tSize\tDeleted")
+			for _, item := range items {
+				total += item.Size
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", item.Name, item.OriginalPath, storage.FormatSize(item.Size), item.DeletedAt.Format(time.DateTime))
+			}
+			fmt.Fprintf(w, "Total:\t\t%s\t\n", storage.FormatSize(total))
+			w.Flush()
+		},
+	}
+
+	return cmd
+}
+
+func newCmdTrashRestore() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "restore <item>...",
+		Short: "Restore items from the trash to their original location.",
+		Long: `Restore items from the trash to their original location.
+
+An item is either the name shown by "disk trash list" or the original path of the item.`,
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			items := trash.List()
+			failed := false
+			for _, arg := range args {
+				item, ok := findTrashItem(items, arg)
+				if !ok {
+					log.Printf("%q isn't an item that disk has put in the trash", arg)
+					failed = true
+					continue
+				}
+				err := trash.Restore(item)
+				if err != nil {
+					log.Printf("error restoring %q: %v", item.Name, err)
+					failed = true
+					continue
+				}
+				fmt.Printf("Restored %s\n", item.OriginalPath)
+			}
+			if failed {
+				os.Exit(1)
+			}
+		},
+	}
+
+	return cmd
+}
+
+// findTrashItem finds the item by its name in the trash or by its original path.
+func findTrashItem(items []trash.Item, nameOrPath string) (trash.Item, bool) {
+	for _, item := range items {
+		if item.Name == nameOrPath || item.OriginalPath == nameOrPath {
+			return item, true
+		}
+	}
+	return trash.Item{}, false
+}
+
+func newCmdTrashEmpty() *cobra.Command {
+	var olderThan string
+	var yes bool
+
+	var cmd = &cobra.Command{
+		Use:   "empty",
+		Short: "Permanently delete the items that disk has put in the trash.",
+		Run: func(cmd *cobra.Command, args []string) {
+			age, err := util.ParseDuration(olderThan)
+			if err != nil {
+				log.Fatal(err)
+			}
+			deletedBefore := time.Now().Add(-age)
+
+			var items []trash.Item
+			total := int64(0)
+			for _, item := range trash.List() {
+				if item.DeletedAt.Before(deletedBefore) {
+					items = append(items, item)
+					total += item.Size
+				}
+			}
+			if len(items) == 0 {
+				fmt.Println("There is nothing to empty.")
+				return
+			}
+			if !yes && !confirm(fmt.Sprintf("Permanently delete %d items (%s)?", len(items), storage.FormatSize(total))) {
+				return
+			}
+
+			reclaimed := int64(0)
+			deleted := 0
+			for _, item := range items {
+				err = trash.Delete(item)
+				if err != nil {
+					log.Printf("error deleting %q: %v", item.Name, err)
+					continue
+				}
+				reclaimed += item.Size
+				deleted++
+			}
+			fmt.Printf("Permanently deleted %d items, reclaimed %s.\n", deleted, storage.FormatSize(reclaimed))
+		},
+	}
+
+	cmd.Flags().StringVarP(&olderThan, "older-than", "o", "0d", "Only delete items that were put in the trash longer ago than this, e.g. '30d', '2w' or '12h'.")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Don't ask for confirmation.")
+
+	return cmd
+}
+
+// confirm asks the user a yes or no question on stdin. Anything but yes is treated as no.
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
@@ -2,9 +2,14 @@ package cmd
 
 import (
 	"fmt"
+	"log"
+	"path/filepath"
 	"sort"
 
+	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss/tree"
+	"github.com/sebastianappelberg/disk/pkg/config"
+	"github.com/sebastianappelberg/disk/pkg/history"
 	"github.com/sebastianappelberg/disk/pkg/storage"
 	"github.com/spf13/cobra"
 )
@@ -12,32 +17,62 @@ import (
 func NewCmdTree() *cobra.Command {
 	var depth int
 	var sortBy string
+	var oneFileSystem bool
+	var followSymlinks bool
+	var sizeFlags sizeModeFlags
+	var interactive bool
 
 	var cmd = &cobra.Command{
 		Use:   "tree <path>",
 		Short: "Print folders and files along with their sizes, in a tree structure.",
+		Long: `Prints folders and files along with their sizes, in a tree structure.
+
+Use --interactive to explore the folders in a TUI instead, where folders are loaded as you open them
+and files and folders can be moved to the trash. What's moved to the trash can be restored with "disk undo".
+`,
 		Run: func(cmd *cobra.Command, args []string) {
-			root := args[0]
-			walker := storage.NewTreeWalker()
+			root := filepath.Clean(args[0])
+			var options []storage.FileWalkerOption[storage.File]
+			if oneFileSystem {
+				options = append(options, storage.WithOneFileSystem[storage.File]())
+			}
+			if followSymlinks {
+				options = append(options, storage.WithFollowSymlinks[storage.File]())
+			}
+			walker := storage.NewTreeWalker(options...)
+			if interactive {
+				result, err := tea.NewProgram(newTreeModel(root, walker, sizeFlags.sizeMode(), sortBy, history.NewJournal(config.GetAppDir())), tea.WithAltScreen()).Run()
+				if err != nil {
+					log.Fatal(err)
+				}
+				if m := result.(treeModel); m.trashedCount > 0 {
+					fmt.Printf("Moved %d items (%s) to the trash.\n", m.trashedCount, m.trashed.Format(sizeFlags.sizeMode()))
+				}
+				return
+			}
 			folder := walker.GetTree(root, depth)
-			t := buildTreeFromFolder(folder, sortBy)
+			t := buildTreeFromFolder(folder, sortBy, sizeFlags.sizeMode())
 			fmt.Println(t)
 		},
 	}
 
 	cmd.Flags().IntVarP(&depth, "depth", "d", 1, "Depth of the tree structure.")
 	cmd.Flags().StringVarP(&sortBy, "sort", "s", "name", "Sort by 'name' or 'size'.")
+	cmd.Flags().BoolVarP(&oneFileSystem, "one-file-system", "x", false, "Skip directories on different file systems, e.g. mounts.")
+	cmd.Flags().BoolVarP(&followSymlinks, "follow-symlinks", "L", false, "Follow symlinks instead of counting the size of the link itself.")
+	cmd.Flags().BoolVarP(&interactive, "interactive", "i", false, "Explore the folders in a TUI instead of printing the tree.")
+	sizeFlags.register(cmd)
 
 	return cmd
 }
 
-func sortChildren(children []storage.Tree, sortBy string) []storage.Tree {
+func sortChildren(children []storage.Tree, sortBy string, sizeMode storage.SizeMode) []storage.Tree {
 	sorted := make([]storage.Tree, len(children))
 	copy(sorted, children)
 
 	if sortBy == "size" {
 		sort.Slice(sorted, func(i, j int) bool {
-			return sorted[i].Size > sorted[j].Size // Sort descending by size
+			return sorted[i].Size.Size(sizeMode) > sorted[j].Size.Size(sizeMode) // Sort descending by size
 		})
 	} else {
 		sort.Slice(sorted, func(i, j int) bool {
@@ -48,13 +83,13 @@ func sortChildren(children []storage.Tree, sortBy string) []storage.Tree {
 	return sorted
 }
 
-func buildTreeFromFolder(folder storage.Tree, sortBy string) *tree.Tree {
-	t := tree.Root(fmt.Sprintf("%s: %s", folder.Name, storage.FormatSize(folder.Size)))
+func buildTreeFromFolder(folder storage.Tree, sortBy string, sizeMode storage.SizeMode) *tree.Tree {
+	t := tree.Root(fmt.Sprintf("%s: %s", folder.Name, folder.Size.Format(sizeMode)))
 
-	children := sortChildren(folder.Children, sortBy)
+	children := sortChildren(folder.Children, sortBy, sizeMode)
 
 	for _, subfolder := range children {
-		t.Child(buildTreeFromFolder(subfolder, sortBy))
+		t.Child(buildTreeFromFolder(subfolder, sortBy, sizeMode))
 	}
 	return t
 }
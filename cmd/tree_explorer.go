@@ -0,0 +1,494 @@
+package cmd
+
+import (
+	"cmp"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/help"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/table"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/sebastianappelberg/disk/pkg/history"
+	"github.com/sebastianappelberg/disk/pkg/storage"
+	"github.com/sebastianappelberg/disk/pkg/trash"
+	"github.com/sebastianappelberg/disk/pkg/util"
+)
+
+const (
+	barWidth        = 20
+	minNameColWidth = 30
+	treeSortSize    = "size"
+	treeSortName    = "name"
+	// treeJournalName is what the explorer is called in the history, in place of the analyzer.
+	treeJournalName = "tree"
+)
+
+type treeKeyMap struct {
+	Up       key.Binding
+	Down     key.Binding
+	Open     key.Binding
+	Back     key.Binding
+	SortSize key.Binding
+	SortName key.Binding
+	Trash    key.Binding
+	Help     key.Binding
+	Exit     key.Binding
+}
+
+func (k treeKeyMap) ShortHelp() []key.Binding {
+	return []key.Binding{k.Up, k.Down, k.Open, k.Back, k.Trash, k.Help, k.Exit}
+}
+
+func (k treeKeyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{
+		{k.Up, k.Down},
+		{k.Open, k.Back},
+		{k.SortSize, k.SortName},
+		{k.Trash},
+		{k.Help, k.Exit},
+	}
+}
+
+func defaultTreeKeyMap() treeKeyMap {
+	return treeKeyMap{
+		Up: key.NewBinding(
+			key.WithKeys("up", "k"),
+			key.WithHelp("↑/k", "up"),
+		),
+		Down: key.NewBinding(
+			key.WithKeys("down", "j"),
+			key.WithHelp("↓/j", "down"),
+		),
+		Open: key.NewBinding(
+			key.WithKeys("enter", "right", "l"),
+			key.WithHelp("enter/→", "open folder"),
+		),
+		Back: key.NewBinding(
+			key.WithKeys("backspace", "left", "h"),
+			key.WithHelp("backspace/←", "go up"),
+		),
+		SortSize: key.NewBinding(
+			key.WithKeys("s"),
+			key.WithHelp("s", "sort by size"),
+		),
+		SortName: key.NewBinding(
+			key.WithKeys("n"),
+			key.WithHelp("n", "sort by name"),
+		),
+		Trash: key.NewBinding(
+			key.WithKeys("d", "delete"),
+			key.WithHelp("d", "move to trash"),
+		),
+		Help: key.NewBinding(
+			key.WithKeys("?"),
+			key.WithHelp("?", "more"),
+		),
+		Exit: key.NewBinding(
+			key.WithKeys("q", "ctrl+c"),
+			key.WithHelp("q/ctrl+c", "quit"),
+		),
+	}
+}
+
+// treeLoadedMsg is sent when the content of a folder has been loaded.
+type treeLoadedMsg struct {
+	path string
+	tree storage.Tree
+}
+
+// trashedMsg is sent when a file or folder has been moved to the trash, or failed to be.
+type trashedMsg struct {
+	path       string
+	size       storage.Usage
+	err        error
+	journalErr error // journalErr is set if it was moved to the trash but couldn't be written to the history.
+}
+
+// treeLevel is a folder above the one that's shown, along with the cursor position to go back to.
+type treeLevel struct {
+	path   string
+	cursor int
+}
+
+// treeModel is an ncdu-like explorer of the folders under root. Folders are loaded one at a time as they're opened.
+type treeModel struct {
+	table        table.Model
+	help         help.Model
+	keyMap       treeKeyMap
+	spinner      spinner.Model
+	walker       *storage.TreeWalker
+	sizeMode     storage.SizeMode
+	windowWidth  int
+	windowHeight int
+	path         string                  // path is the folder that's shown.
+	parents      []treeLevel             // parents are the folders above path, up to the root, the closest one last.
+	loaded       map[string]storage.Tree // loaded holds the folders that have been loaded by their path.
+	loading      bool
+	entries      []storage.Tree // entries holds the content of path in the order it's shown in the table.
+	sortBy       string
+	sortDesc     bool
+	confirm      *storage.Tree // confirm is the entry waiting for confirmation before it's moved to the trash.
+	err          error
+	trashed      storage.Usage // trashed is the total size of everything that has been moved to the trash.
+	trashedCount int
+	journal      *history.Journal // journal records what's moved to the trash so that it can be undone.
+	sessionID    string
+}
+
+func newTreeModel(root string, walker *storage.TreeWalker, sizeMode storage.SizeMode, sortBy string, journal *history.Journal) treeModel {
+	tableKeyMap := table.DefaultKeyMap()
+	// Space and the arrow keys are used for navigating the folders instead of paging.
+	tableKeyMap.PageDown.SetKeys("f", "pgdown")
+	tableKeyMap.HalfPageDown.SetKeys("ctrl+d")
+	tableKeyMap.HalfPageUp.SetKeys("ctrl+u")
+	t := table.New(table.WithFocused(true), table.WithKeyMap(tableKeyMap))
+	s := table.DefaultStyles()
+	s.Header = s.Header.
+		BorderForeground(lipgloss.Color("240")).
+		Bold(true)
+	s.Selected = s.Selected.
+		Foreground(lipgloss.Color("229")).
+		Background(lipgloss.Color("57")).
+		Bold(false)
+	t.SetStyles(s)
+
+	m := treeModel{
+		table:     t,
+		help:      help.New(),
+		keyMap:    defaultTreeKeyMap(),
+		spinner:   spinner.New(spinner.WithSpinner(spinner.Dot)),
+		walker:    walker,
+		sizeMode:  sizeMode,
+		path:      root,
+		loaded:    make(map[string]storage.Tree),
+		loading:   true,
+		sortBy:    sortBy,
+		sortDesc:  sortBy == treeSortSize,
+		journal:   journal,
+		sessionID: history.NewSessionID(),
+	}
+	m.table.SetColumns(m.columns())
+	return m
+}
+
+// loadTree loads the content of the folder at path in the background.
+func loadTree(walker *storage.TreeWalker, path string) tea.Cmd {
+	return func() tea.Msg {
+		return treeLoadedMsg{path: path, tree: walker.GetTree(path, 1)}
+	}
+}
+
+// putInTrash is used to move entries to the trash. It's a variable so that it can be replaced in tests.
+var putInTrash = trash.PutItems
+
+// trashEntry moves the file or folder at path to the trash in the background and writes it to the journal,
+// just like disk clean does, so that it can be undone.
+func (m treeModel) trashEntry(path string, size storage.Usage) tea.Cmd {
+	journal, sessionID, sizeMode := m.journal, m.sessionID, m.sizeMode
+	return func() tea.Msg {
+		items, err := putInTrash(path)
+		entry := history.Entry{
+			Action:   history.ActionRemove,
+			Session:  sessionID,
+			Analyzer: treeJournalName,
+			Path:     path,
+			Paths:    []string{path},
+			Trashed:  items,
+			Size:     size.Size(sizeMode),
+		}
+		if err != nil {
+			entry.Error = err.Error()
+		}
+		return trashedMsg{path: path, size: size, err: err, journalErr: journal.Append(entry)}
+	}
+}
+
+func (m treeModel) Init() tea.Cmd {
+	return tea.Batch(m.spinner.Tick, loadTree(m.walker, m.path))
+}
+
+func (m treeModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+	switch msg := msg.(type) {
+	case treeLoadedMsg:
+		m.loaded[msg.path] = msg.tree
+		if msg.path == m.path {
+			m.loading = false
+			m.refreshRows()
+			m.table.GotoTop()
+			m.resize()
+		}
+		return m, nil
+	case trashedMsg:
+		if msg.err != nil {
+			m.err = fmt.Errorf("could not move to the trash: %w", msg.err)
+			return m, nil
+		}
+		m.removeEntry(msg.path, msg.size)
+		if msg.journalErr != nil {
+			m.err = fmt.Errorf("moved to the trash, but it can't be undone since the history couldn't be written: %w", msg.journalErr)
+		}
+		return m, nil
+	case spinner.TickMsg:
+		if !m.loading {
+			return m, nil
+		}
+		m.spinner, cmd = m.spinner.Update(msg)
+		return m, cmd
+	case tea.WindowSizeMsg:
+		m.windowWidth = msg.Width
+		m.windowHeight = msg.Height
+		m.help.Width = msg.Width - 3
+		m.table.SetColumns(m.columns())
+		m.refreshRows()
+		m.resize()
+	case tea.KeyMsg:
+		m.err = nil
+		if m.confirm != nil {
+			return m.updateConfirm(msg)
+		}
+		switch {
+		case key.Matches(msg, m.keyMap.Exit):
+			return m, tea.Quit
+		case key.Matches(msg, m.keyMap.Help):
+			m.help.ShowAll = !m.help.ShowAll
+			m.resize()
+			return m, nil
+		case m.loading:
+			// Nothing but quitting makes sense until the folder has been loaded.
+			return m, nil
+		case key.Matches(msg, m.keyMap.Open):
+			return m.open()
+		case key.Matches(msg, m.keyMap.Back):
+			m.back()
+			return m, nil
+		case key.Matches(msg, m.keyMap.SortSize):
+			m.sort(treeSortSize)
+			return m, nil
+		case key.Matches(msg, m.keyMap.SortName):
+			m.sort(treeSortName)
+			return m, nil
+		case key.Matches(msg, m.keyMap.Trash):
+			if entry, ok := m.cursorEntry(); ok {
+				m.confirm = &entry
+			}
+			return m, nil
+		}
+	}
+	m.table, cmd = m.table.Update(msg)
+	return m, cmd
+}
+
+// updateConfirm handles the answer to the question whether the entry should be moved to the trash.
+func (m treeModel) updateConfirm(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	entry := m.confirm
+	m.confirm = nil
+	switch msg.String() {
+	case "y", "Y":
+		return m, m.trashEntry(util.SimpleJoin(m.path, entry.Name), entry.Size)
+	case "ctrl+c":
+		return m, tea.Quit
+	}
+	// Anything else cancels.
+	return m, nil
+}
+
+// open shows the content of the folder under the cursor, loading it first if it hasn't been loaded before.
+func (m treeModel) open() (tea.Model, tea.Cmd) {
+	entry, ok := m.cursorEntry()
+	if !ok || !entry.IsDir {
+		return m, nil
+	}
+	m.parents = append(m.parents, treeLevel{path: m.path, cursor: m.table.Cursor()})
+	m.path = util.SimpleJoin(m.path, entry.Name)
+	if _, ok := m.loaded[m.path]; ok {
+		m.refreshRows()
+		m.table.GotoTop()
+		return m, nil
+	}
+	m.loading = true
+	m.entries = nil
+	m.table.SetRows(nil)
+	return m, tea.Batch(m.spinner.Tick, loadTree(m.walker, m.path))
+}
+
+// back shows the folder above the current one, unless the current one is the root.
+func (m *treeModel) back() {
+	if len(m.parents) == 0 {
+		return
+	}
+	parent := m.parents[len(m.parents)-1]
+	m.parents = m.parents[:len(m.parents)-1]
+	m.path = parent.path
+	m.refreshRows()
+	m.table.SetCursor(parent.cursor)
+}
+
+// sort sorts the entries by size or name. Sorting by the same thing again reverses the order.
+func (m *treeModel) sort(sortBy string) {
+	if m.sortBy == sortBy {
+		m.sortDesc = !m.sortDesc
+	} else {
+		m.sortBy = sortBy
+		// Biggest first is what you're most likely looking for.
+		m.sortDesc = sortBy == treeSortSize
+	}
+	m.refreshRows()
+	m.table.GotoTop()
+}
+
+// removeEntry removes the entry at path from the loaded folders once it's been moved to the trash.
+// The folders above it shrink by its size.
+func (m *treeModel) removeEntry(path string, size storage.Usage) {
+	m.trashed = m.trashed.Add(size)
+	m.trashedCount++
+	for loadedPath, tree := range m.loaded {
+		if loadedPath == path || isInside(path, loadedPath) {
+			delete(m.loaded, loadedPath)
+			continue
+		}
+		if !isInside(loadedPath, path) {
+			continue
+		}
+		tree.Size = tree.Size.Sub(size)
+		children := make([]storage.Tree, 0, len(tree.Children))
+		for _, child := range tree.Children {
+			childPath := util.SimpleJoin(loadedPath, child.Name)
+			if childPath == path {
+				continue
+			}
+			if isInside(childPath, path) {
+				// The folder on the way down to the entry shrinks as well.
+				child.Size = child.Size.Sub(size)
+			}
+			children = append(children, child)
+		}
+		tree.Children = children
+		m.loaded[loadedPath] = tree
+	}
+	m.refreshRows()
+	m.table.SetCursor(m.table.Cursor())
+}
+
+// isInside tells if path is somewhere inside the folder dir.
+func isInside(dir, path string) bool {
+	return strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+// cursorEntry returns the entry under the cursor.
+func (m treeModel) cursorEntry() (storage.Tree, bool) {
+	cursor := m.table.Cursor()
+	if cursor < 0 || cursor >= len(m.entries) {
+		return storage.Tree{}, false
+	}
+	return m.entries[cursor], true
+}
+
+// refreshRows updates the rows of the table to match the content of the current folder and the sort order.
+func (m *treeModel) refreshRows() {
+	tree := m.loaded[m.path]
+	m.entries = slices.Clone(tree.Children)
+	slices.SortStableFunc(m.entries, func(a, b storage.Tree) int {
+		var result int
+		if m.sortBy == treeSortSize {
+			result = cmp.Compare(a.Size.Size(m.sizeMode), b.Size.Size(m.sizeMode))
+		} else {
+			result = strings.Compare(a.Name, b.Name)
+		}
+		if m.sortDesc {
+			return -result
+		}
+		return result
+	})
+	rows := make([]table.Row, 0, len(m.entries))
+	for _, entry := range m.entries {
+		rows = append(rows, m.entryRow(entry, tree.Size.Size(m.sizeMode)))
+	}
+	m.table.SetColumns(m.columns())
+	m.table.SetRows(rows)
+}
+
+// columns returns the columns of the table with the sort order in the titles. The name column fills the window.
+func (m treeModel) columns() []table.Column {
+	sizeColWidth := 8
+	if m.sizeMode == storage.BothSizes {
+		sizeColWidth = 20
+	}
+	percentColWidth := 6
+	nameColWidth := max(minNameColWidth, m.windowWidth-sizeColWidth-barWidth-2-percentColWidth-10)
+	titles := map[string]string{treeSortSize: "Size", treeSortName: "Name"}
+	for sortBy := range titles {
+		if sortBy == m.sortBy {
+			if m.sortDesc {
+				titles[sortBy] += " ▼"
+			} else {
+				titles[sortBy] += " ▲"
+			}
+		}
+	}
+	return []table.Column{
+		{Title: titles[treeSortSize], Width: sizeColWidth},
+		{Title: "", Width: barWidth + 2},
+		{Title: "%", Width: percentColWidth},
+		{Title: titles[treeSortName], Width: nameColWidth},
+	}
+}
+
+// entryRow renders an entry with a bar that shows how much of its parent it takes up.
+func (m treeModel) entryRow(entry storage.Tree, parentSize int64) table.Row {
+	var fraction float64
+	if parentSize > 0 {
+		fraction = float64(entry.Size.Size(m.sizeMode)) / float64(parentSize)
+	}
+	filled := min(barWidth, int(fraction*barWidth+0.5))
+	name := entry.Name
+	if entry.IsDir {
+		name += "/"
+	}
+	return table.Row{
+		entry.Size.Format(m.sizeMode),
+		"[" + strings.Repeat("█", filled) + strings.Repeat(" ", barWidth-filled) + "]",
+		fmt.Sprintf("%5.1f%%", fraction*100),
+		name,
+	}
+}
+
+// resize fits the table to the window, leaving room for the header and the help which is taller when all of it is shown.
+func (m *treeModel) resize() {
+	height := m.windowHeight - 6
+	if m.help.ShowAll {
+		height -= lipgloss.Height(m.help.View(m.keyMap)) - 1
+	}
+	m.table.SetHeight(max(height, 1))
+}
+
+func (m treeModel) View() string {
+	return lipgloss.JoinVertical(lipgloss.Top,
+		m.headerView(),
+		baseStyle.Render(m.table.View()),
+		baseStyle.Width(max(m.windowWidth-2, 0)).Render(" "+m.bottomView()),
+	)
+}
+
+func (m treeModel) headerView() string {
+	if m.loading {
+		return fmt.Sprintf(" %s Loading %s", m.spinner.View(), m.path)
+	}
+	tree := m.loaded[m.path]
+	return confirmStyle.Render(fmt.Sprintf(" %s  %s  Items: %d", m.path, tree.Size.Format(m.sizeMode), len(tree.Children)))
+}
+
+func (m treeModel) bottomView() string {
+	if m.confirm != nil {
+		return confirmStyle.Render(fmt.Sprintf("Move %s (%s) to the trash? y/n", m.confirm.Name, m.confirm.Size.Format(m.sizeMode)))
+	}
+	if m.err != nil {
+		return confirmStyle.Render(fmt.Sprintf("Error: %v", m.err))
+	}
+	return m.help.View(m.keyMap)
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sebastianappelberg/disk/internal/testutil"
+	"github.com/sebastianappelberg/disk/pkg/config"
+	"github.com/sebastianappelberg/disk/pkg/history"
+	"github.com/sebastianappelberg/disk/pkg/storage"
+	"github.com/sebastianappelberg/disk/pkg/trash"
+)
+
+func TestMain(m *testing.M) {
+	testutil.Main(m, config.SetAppDir)
+}
+
+func TestTreeModelTrashIsJournaled(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "junk")
+	err := os.WriteFile(path, []byte("junk"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := putInTrash
+	putInTrash = func(paths ...string) ([]trash.Item, error) {
+		return []trash.Item{{Name: "junk", OriginalPath: paths[0], DeletedAt: time.Now(), Size: 4}}, nil
+	}
+	t.Cleanup(func() { putInTrash = original })
+
+	journal := history.NewJournal(t.TempDir())
+	m := newTreeModel(root, storage.NewTreeWalker(), storage.ApparentSize, treeSortName, journal)
+	msg := m.trashEntry(path, storage.Usage{Apparent: 4})()
+	result, _ := m.Update(msg)
+
+	if err := result.(treeModel).err; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sessions, err := journal.Sessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || len(sessions[0].Entries) != 1 {
+		t.Fatalf("expected a single session with a single entry, got %+v", sessions)
+	}
+	entry := sessions[0].Entries[0]
+	if entry.Path != path || len(entry.Trashed) != 1 || entry.Trashed[0].OriginalPath != path || entry.Size != 4 {
+		t.Errorf("unexpected entry: %+v", entry)
+	}
+}
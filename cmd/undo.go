@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/sebastianappelberg/disk/pkg/config"
+	"github.com/sebastianappelberg/disk/pkg/history"
+	"github.com/sebastianappelberg/disk/pkg/storage"
+	"github.com/spf13/cobra"
+	"log"
+	"os"
+	"strconv"
+)
+
+func NewCmdUndo() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "undo [n]",
+		Short: "Restore everything that was removed in the last n sessions of disk clean or disk tree -i.",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			n := 1
+			if len(args) == 1 {
+				var err error
+				n, err = strconv.Atoi(args[0])
+				if err != nil || n < 1 {
+					log.Fatalf("invalid number of sessions %q", args[0])
+				}
+			}
+
+			journal := history.NewJournal(config.GetAppDir())
+			entries, err := journal.Undo(n)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if len(entries) == 0 {
+				fmt.Println("There is nothing to undo.")
+				return
+			}
+			restored := int64(0)
+			failed := false
+			for _, entry := range entries {
+				if entry.Failed() {
+					log.Println(entry.Error)
+					failed = true
+					continue
+				}
+				restored += entry.Size
+				fmt.Printf("Restored %s\n", entry.Path)
+			}
+			if restored > 0 {
+				fmt.Printf("Restored %s in total.\n", storage.FormatSize(restored))
+			}
+			if failed {
+				os.Exit(1)
+			}
+		},
+	}
+
+	return cmd
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/sebastianappelberg/disk/pkg/config"
+	"github.com/spf13/cobra"
+	"log"
+	"os"
+	"strings"
+)
+
+// loadUserConfig merges the user config into the folder lists and sets the flags of cmd that it overrides.
+// The .diskrc is looked up from the path that's given, or the working directory.
+func loadUserConfig(cmd *cobra.Command, args []string) {
+	dir := "."
+	if len(args) > 0 {
+		if info, err := os.Stat(args[0]); err == nil && info.IsDir() {
+			dir = args[0]
+		}
+	}
+	flags, paths, err := config.LoadUserConfig(dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for name, value := range flags {
+		flag := cmd.Flags().Lookup(name)
+		// The config applies to all commands, so flags that a command doesn't have are skipped.
+		if flag == nil || flag.Changed {
+			continue
+		}
+		s := flagValue(value)
+		err = flag.Value.Set(s)
+		if err != nil {
+			log.Fatalf("invalid value for the flag %s in %s: %v", name, strings.Join(paths, ", "), err)
+		}
+		flag.DefValue = flag.Value.String()
+	}
+}
+
+// flagValue formats a JSON value the way it's written on the command line.
+func flagValue(value any) string {
+	values, ok := value.([]any)
+	if !ok {
+		return fmt.Sprint(value)
+	}
+	s := make([]string, len(values))
+	for i, v := range values {
+		s[i] = fmt.Sprint(v)
+	}
+	return strings.Join(s, ",")
+}
@@ -0,0 +1,50 @@
+// Package testutil holds the helpers that tests share to set up files and git repositories.
+package testutil
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// Main runs the tests in m with an app dir of their own, so that they don't read or write the caches and the
+// index of whoever runs them. It's meant to be called from TestMain with config.SetAppDir, which is passed in
+// since the tests of the config package use testutil as well.
+func Main(m *testing.M, setAppDir func(dir string)) {
+	dir, err := os.MkdirTemp("", "disk-test")
+	if err != nil {
+		panic(err)
+	}
+	setAppDir(dir)
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// WriteFile writes content to the file at path, creating the folders above it.
+func WriteFile(t testing.TB, path string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Git runs git in dir with a user and a default branch of its own, so that it doesn't depend on the git config of
+// whoever runs the tests. The test is skipped when git isn't installed.
+func Git(t testing.TB, dir string, args ...string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git isn't installed")
+	}
+	cmd := exec.Command("git", append([]string{
+		"-c", "user.name=test", "-c", "user.email=test@example.com", "-c", "init.defaultBranch=main",
+	}, args...)...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+}
@@ -2,72 +2,253 @@ package cache
 
 import (
 	"encoding/gob"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
 	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// schemaVersion is the version of the format that caches are written in. Caches written before the
+// format was versioned are version 0, which can still be read.
+const schemaVersion = 1
+
+const (
+	fileSuffix    = "_cache"
+	backupSuffix  = ".bak"
+	corruptSuffix = ".corrupt"
+	lockSuffix    = ".lock"
+)
+
+var errUnsupportedVersion = errors.New("unsupported cache version")
+
 type Cache[T any] struct {
 	dir    string
 	path   string
-	buffer *sync.Map
+	ttl    time.Duration
+	buffer *sync.Map // buffer maps keys to *item[T].
+	// mu guards changed, which holds the keys that have been put or deleted since the cache was last flushed.
+	// Only those are written over what other processes have flushed in the meantime.
+	mu      sync.Mutex
+	changed map[string]bool
 }
 
-func NewCache[T any](dir, name string) *Cache[T] {
-	var storedCache cacheStruct[T]
-	buffer := &sync.Map{}
+type item[T any] struct {
+	value   T
+	touched atomic.Int64 // touched is when the value was last put or read, in Unix seconds.
+}
 
-	cache := &Cache[T]{dir: dir, path: filepath.Join(dir, name+"_cache"), buffer: buffer}
+func newItem[T any](value T, touched time.Time) *item[T] {
+	i := &item[T]{value: value}
+	i.touched.Store(touched.Unix())
+	return i
+}
 
-	file, err := os.Open(cache.path)
-	if err != nil {
-		return cache
+type Option[T any] func(*Cache[T])
+
+// WithTTL makes the cache evict values that haven't been put or read for ttl, so that it doesn't grow forever.
+func WithTTL[T any](ttl time.Duration) Option[T] {
+	return func(c *Cache[T]) {
+		c.ttl = ttl
 	}
-	defer file.Close()
+}
 
-	err = gob.NewDecoder(file).Decode(&storedCache)
+// NewCache loads the cache called name from dir. If the cache is corrupt it's moved aside and the backup
+// that's kept from the previous flush is loaded instead.
+func NewCache[T any](dir, name string, options ...Option[T]) *Cache[T] {
+	cache := &Cache[T]{
+		dir:     dir,
+		path:    filepath.Join(dir, name+fileSuffix),
+		buffer:  &sync.Map{},
+		changed: make(map[string]bool),
+	}
+	for _, option := range options {
+		option(cache)
+	}
+
+	storedCache, err := cache.read()
 	if err != nil {
 		return cache
 	}
+	now := time.Now()
 	for k, v := range storedCache.Value {
-		buffer.Store(k, v)
+		touched, ok := storedCache.Touched[k]
+		if !ok {
+			// Values from before it was tracked are treated as new.
+			touched = now
+		}
+		if !cache.expired(touched, now) {
+			cache.buffer.Store(k, newItem(v, touched))
+		}
 	}
 	return cache
 }
 
 // Internal structure for cached values
 type cacheStruct[T any] struct {
+	Version int
 	Created time.Time
 	Value   map[string]T
+	// Touched is when each value was last put or read.
+	Touched map[string]time.Time
+}
+
+// read reads the cache from disk, or the backup if the cache can't be read.
+func (c *Cache[T]) read() (cacheStruct[T], error) {
+	storedCache, err := readFile[T](c.path)
+	if err == nil {
+		return storedCache, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) && !errors.Is(err, errUnsupportedVersion) {
+		// It's kept around instead of being overwritten on the next flush, since it may hold things the user cares about.
+		log.Printf("The cache %s is corrupt and has been moved to %s: %v", c.path, c.path+corruptSuffix, err)
+		_ = os.Rename(c.path, c.path+corruptSuffix)
+	}
+	backup, backupErr := readFile[T](c.path + backupSuffix)
+	if backupErr != nil {
+		return cacheStruct[T]{}, err
+	}
+	return backup, nil
+}
+
+func readFile[T any](path string) (cacheStruct[T], error) {
+	var storedCache cacheStruct[T]
+	file, err := os.Open(path)
+	if err != nil {
+		return storedCache, err
+	}
+	defer file.Close()
+
+	err = gob.NewDecoder(file).Decode(&storedCache)
+	if err != nil {
+		return storedCache, err
+	}
+	if storedCache.Version > schemaVersion {
+		return storedCache, fmt.Errorf("%w %d in %s", errUnsupportedVersion, storedCache.Version, path)
+	}
+	return storedCache, nil
+}
+
+func (c *Cache[T]) expired(touched, now time.Time) bool {
+	return c.ttl > 0 && now.Sub(touched) > c.ttl
 }
 
 // Put stores a value in the cache. Nothing is written to disk though.
 func (c *Cache[T]) Put(key string, value T) {
-	c.buffer.Store(key, value)
+	c.buffer.Store(key, newItem(value, time.Now()))
+	c.markChanged(key)
+}
+
+func (c *Cache[T]) markChanged(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.changed[key] = true
 }
 
-// Flush writes the cache to disk.
-func (c *Cache[T]) Flush() {
+// Flush writes the cache to disk. The changes are merged with the ones that other processes have flushed since
+// the cache was loaded. The cache is written to a temporary file that replaces the old one, so it's never left
+// half-written if disk crashes, and the old one is kept as a backup.
+func (c *Cache[T]) Flush() error {
 	err := os.MkdirAll(c.dir, os.ModePerm)
 	if err != nil {
-		return
+		return err
 	}
+	unlock, err := lockFile(c.path + lockSuffix)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.merge()
 
-	flushBuffer := make(map[string]T)
+	now := time.Now()
+	cacheVal := cacheStruct[T]{
+		Version: schemaVersion,
+		Created: now,
+		Value:   make(map[string]T),
+		Touched: make(map[string]time.Time),
+	}
 	c.buffer.Range(func(k, v interface{}) bool {
-		flushBuffer[k.(string)] = v.(T)
+		i := v.(*item[T])
+		touched := time.Unix(i.touched.Load(), 0)
+		if c.expired(touched, now) {
+			c.buffer.Delete(k)
+			return true
+		}
+		cacheVal.Value[k.(string)] = i.value
+		cacheVal.Touched[k.(string)] = touched
 		return true
 	})
 
-	cacheVal := cacheStruct[T]{Created: time.Now(), Value: flushBuffer}
-	file, err := os.Create(c.path)
+	err = c.write(cacheVal)
+	if err != nil {
+		return err
+	}
+	clear(c.changed)
+	return nil
+}
+
+// merge loads what other processes have flushed into the buffer, except for the keys that have been changed
+// by this process. It has to be called with the lock held.
+func (c *Cache[T]) merge() {
+	storedCache, err := readFile[T](c.path)
 	if err != nil {
 		return
 	}
-	defer file.Close()
+	c.buffer.Range(func(k, _ interface{}) bool {
+		key := k.(string)
+		if _, ok := storedCache.Value[key]; !ok && !c.changed[key] {
+			// Another process has deleted it.
+			c.buffer.Delete(key)
+		}
+		return true
+	})
+	for k, v := range storedCache.Value {
+		if c.changed[k] {
+			continue
+		}
+		touched, ok := storedCache.Touched[k]
+		if !ok {
+			touched = time.Now()
+		}
+		if existing, ok := c.buffer.Load(k); ok {
+			// Reads by this process count too.
+			touched = time.Unix(max(touched.Unix(), existing.(*item[T]).touched.Load()), 0)
+		}
+		c.buffer.Store(k, newItem(v, touched))
+	}
+}
+
+func (c *Cache[T]) write(cacheVal cacheStruct[T]) error {
+	file, err := os.CreateTemp(c.dir, filepath.Base(c.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	err = gob.NewEncoder(file).Encode(cacheVal)
+	if err == nil {
+		err = file.Sync()
+	}
+	closeErr := file.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
 
-	gob.NewEncoder(file).Encode(cacheVal)
+	err = os.Rename(c.path, c.path+backupSuffix)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return os.Rename(file.Name(), c.path)
 }
 
 // Get retrieves a value from the cache. If it didn't find the value in the buffer the second value is false.
@@ -77,5 +258,20 @@ func (c *Cache[T]) Get(key string) (T, bool) {
 		var zero T
 		return zero, false
 	}
-	return val.(T), ok
+	i := val.(*item[T])
+	i.touched.Store(time.Now().Unix())
+	return i.value, ok
+}
+
+// Delete removes a value from the cache. Nothing is written to disk though.
+func (c *Cache[T]) Delete(key string) {
+	c.buffer.Delete(key)
+	c.markChanged(key)
+}
+
+// Range calls f for every value in the cache. If f returns false, Range stops the iteration.
+func (c *Cache[T]) Range(f func(key string, value T) bool) {
+	c.buffer.Range(func(k, v interface{}) bool {
+		return f(k.(string), v.(*item[T]).value)
+	})
 }
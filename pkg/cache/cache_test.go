@@ -0,0 +1,138 @@
+package cache
+
+import (
+	"encoding/gob"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFlushMerges(t *testing.T) {
+	dir := t.TempDir()
+	a := NewCache[string](dir, "test")
+	b := NewCache[string](dir, "test")
+	a.Put("a", "1")
+	b.Put("b", "2")
+	if err := a.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewCache[string](dir, "test")
+	for key, expected := range map[string]string{"a": "1", "b": "2"} {
+		if got, ok := c.Get(key); !ok || got != expected {
+			t.Errorf("Get(%q) = %q, %v; want %q, true", key, got, ok, expected)
+		}
+	}
+
+	// A delete is merged as well.
+	c.Delete("a")
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := NewCache[string](dir, "test").Get("a"); ok {
+		t.Error("Get(\"a\") found a value that was deleted by another cache")
+	}
+}
+
+func TestCorruptCacheRecovers(t *testing.T) {
+	dir := t.TempDir()
+	cache := NewCache[string](dir, "test")
+	cache.Put("key", "value")
+	if err := cache.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	// The second flush keeps the first one as a backup.
+	if err := cache.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "test_cache")
+	if err := os.WriteFile(path, []byte("garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, ok := NewCache[string](dir, "test").Get("key")
+	if !ok || got != "value" {
+		t.Errorf("Get(\"key\") = %q, %v; want \"value\", true from the backup", got, ok)
+	}
+	if _, err := os.Stat(path + corruptSuffix); err != nil {
+		t.Errorf("the corrupt cache wasn't kept: %v", err)
+	}
+}
+
+func TestTTL(t *testing.T) {
+	dir := t.TempDir()
+	cache := NewCache(dir, "test", WithTTL[string](time.Hour))
+	cache.Put("old", "1")
+	cache.Put("new", "2")
+	old, _ := cache.buffer.Load("old")
+	old.(*item[string]).touched.Store(time.Now().Add(-2 * time.Hour).Unix())
+	if err := cache.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := NewCache(dir, "test", WithTTL[string](time.Hour))
+	if _, ok := reloaded.Get("old"); ok {
+		t.Error("Get(\"old\") found a value that should have expired")
+	}
+	if _, ok := reloaded.Get("new"); !ok {
+		t.Error("Get(\"new\") didn't find a value that shouldn't have expired")
+	}
+}
+
+func TestLegacyCache(t *testing.T) {
+	dir := t.TempDir()
+	file, err := os.Create(filepath.Join(dir, "test_cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy := struct {
+		Created time.Time
+		Value   map[string]string
+	}{Created: time.Now(), Value: map[string]string{"key": "value"}}
+	err = gob.NewEncoder(file).Encode(legacy)
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, ok := NewCache[string](dir, "test").Get("key")
+	if !ok || got != "value" {
+		t.Errorf("Get(\"key\") = %q, %v; want \"value\", true", got, ok)
+	}
+}
+
+func TestListAndClear(t *testing.T) {
+	dir := t.TempDir()
+	cache := NewCache[int](dir, "test")
+	cache.Put("a", 1)
+	cache.Put("b", 2)
+	if err := cache.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := List(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 1 || stats[0].Name != "test" || stats[0].Entries != 2 || stats[0].Version != schemaVersion {
+		t.Errorf("List() = %+v; want a single cache called test with 2 entries", stats)
+	}
+
+	if err := Clear(dir, "test"); err != nil {
+		t.Fatal(err)
+	}
+	stats, err = List(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 0 {
+		t.Errorf("List() = %+v after Clear; want no caches", stats)
+	}
+}
@@ -0,0 +1,26 @@
+//go:build !windows
+
+package cache
+
+import (
+	"golang.org/x/sys/unix"
+	"os"
+)
+
+// lockFile takes an exclusive lock on the file at path, which is created if it doesn't exist, and waits until
+// other processes have released it. The returned function releases the lock.
+func lockFile(path string) (func(), error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	err = unix.Flock(int(file.Fd()), unix.LOCK_EX)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return func() {
+		_ = unix.Flock(int(file.Fd()), unix.LOCK_UN)
+		file.Close()
+	}, nil
+}
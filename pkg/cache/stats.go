@@ -0,0 +1,96 @@
+package cache
+
+import (
+	"encoding/gob"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Stats describes a cache that's stored in a directory.
+type Stats struct {
+	Name    string
+	Size    int64     // Size is the size of the cache file in bytes.
+	Entries int       // Entries is the number of values in the cache, or -1 if it was written before they were counted.
+	Flushed time.Time // Flushed is when the cache was last written.
+	Version int
+	Err     error // Err is set if the cache couldn't be read.
+}
+
+// header is the part of cacheStruct that doesn't depend on the type of the values, gob skips the rest.
+type header struct {
+	Version int
+	Created time.Time
+	Touched map[string]time.Time
+}
+
+// List returns the stats of the caches that are stored in dir, sorted by name.
+func List(dir string) ([]Stats, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+fileSuffix))
+	if err != nil {
+		return nil, err
+	}
+	var result []Stats
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		stats := Stats{
+			Name:    strings.TrimSuffix(filepath.Base(path), fileSuffix),
+			Size:    info.Size(),
+			Flushed: info.ModTime(),
+			Entries: -1,
+		}
+		h, err := readHeader(path)
+		if err != nil {
+			stats.Err = err
+		} else {
+			stats.Version = h.Version
+			if h.Version > 0 {
+				stats.Entries = len(h.Touched)
+			}
+		}
+		result = append(result, stats)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
+func readHeader(path string) (header, error) {
+	var h header
+	file, err := os.Open(path)
+	if err != nil {
+		return h, err
+	}
+	defer file.Close()
+	err = gob.NewDecoder(file).Decode(&h)
+	return h, err
+}
+
+// Clear removes the cache called name from dir, along with its backup.
+func Clear(dir, name string) error {
+	path := filepath.Join(dir, name+fileSuffix)
+	unlock, err := lockFile(path + lockSuffix)
+	if errors.Is(err, fs.ErrNotExist) {
+		// There's no dir, so there's no cache either.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	for _, p := range []string{path, path + backupSuffix, path + corruptSuffix} {
+		err = os.Remove(p)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package clean
+
+import (
+	"context"
+	"fmt"
+	"github.com/sebastianappelberg/disk/pkg/storage"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Candidate is a file or folder that an analyzer suggests to remove.
+type Candidate struct {
+	Path    string
+	ModTime time.Time
+	// LastUsed is when the candidate was last used, which Args.AgeMode decides for clutter and large files. It's
+	// ModTime if it's left empty.
+	LastUsed time.Time
+	// Size is the size that Args.SizeMode asks for. It's what the totals are based on.
+	Size int64
+	// Usage holds both the allocated and the apparent size of the candidate. If it's left empty both are Size.
+	Usage         storage.Usage
+	Category      string   // Category is an optional grouping within the analyzer, e.g. "javascript" for clutter.
+	PathsToRemove []string // PathsToRemove are all paths that need to be removed to fully remove the candidate.
+	// Regenerable is true if the candidate can be restored after it's removed, e.g. by reinstalling or rebuilding it.
+	Regenerable bool
+	Restore     string // Restore is the command that restores the candidate, e.g. "npm ci", if it's known.
+	// KeepOne is true if Path is kept when the candidate is removed and only PathsToRemove, e.g. the copies of a
+	// duplicate file, are removed.
+	KeepOne bool
+}
+
+// Analyzer finds candidates to remove.
+type Analyzer interface {
+	// Name is the name used to select the analyzer, e.g. with the --analyzers flag.
+	Name() string
+	// Description describes what kind of files the analyzer suggests to remove.
+	Description() string
+	// Analyze sends the candidates it finds under root on the returned channel and closes it when it's done.
+	// It should stop and close the channel when ctx is cancelled.
+	Analyze(ctx context.Context, root string) (<-chan Candidate, error)
+}
+
+// AnalyzerFactory creates an analyzer from the arguments of a clean. The analyzer should count
+// the directories and bytes it scans in progress, which may be nil.
+type AnalyzerFactory func(args Args, progress *storage.Progress) Analyzer
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]AnalyzerFactory)
+	// registered holds the names of the analyzers in the order they were registered.
+	registered []string
+)
+
+// Register makes an analyzer available by name. Analyzers outside this package, e.g. third-party ones,
+// register themselves in an init function. Register panics if an analyzer with the same name already exists.
+func Register(name string, factory AnalyzerFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if factory == nil {
+		panic("clean: Register factory is nil")
+	}
+	if _, ok := registry[name]; ok {
+		panic("clean: Register called twice for analyzer " + name)
+	}
+	registry[name] = factory
+	registered = append(registered, name)
+}
+
+// Analyzers returns the names of all registered analyzers in the order they were registered.
+func Analyzers() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return slices.Clone(registered)
+}
+
+// NewAnalyzers creates the analyzers with the given names, or all registered analyzers if names is empty.
+func NewAnalyzers(names []string, args Args, progress *storage.Progress) ([]Analyzer, error) {
+	if len(names) == 0 {
+		names = Analyzers()
+	}
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	var analyzers []Analyzer
+	for _, name := range names {
+		factory, ok := registry[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown analyzer %q, expected one of %s", name, strings.Join(registered, ", "))
+		}
+		analyzers = append(analyzers, factory(args, progress))
+	}
+	return analyzers, nil
+}
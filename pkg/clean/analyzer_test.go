@@ -0,0 +1,200 @@
+package clean
+
+import (
+	"context"
+	"errors"
+	"github.com/sebastianappelberg/disk/pkg/storage"
+	"slices"
+	"testing"
+)
+
+type fakeAnalyzer struct {
+	name       string
+	candidates []Candidate
+	err        error
+}
+
+func (a fakeAnalyzer) Name() string {
+	return a.name
+}
+
+func (a fakeAnalyzer) Description() string {
+	return "Fake files."
+}
+
+func (a fakeAnalyzer) Analyze(ctx context.Context, _ string) (<-chan Candidate, error) {
+	if a.err != nil {
+		return nil, a.err
+	}
+	ch := make(chan Candidate)
+	go func() {
+		defer close(ch)
+		for _, candidate := range a.candidates {
+			if !send(ctx, ch, candidate) {
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func TestRegister(t *testing.T) {
+	// The registry is global so the analyzer is still registered if the test is run more than once.
+	if !slices.Contains(Analyzers(), "fake") {
+		Register("fake", func(args Args, _ *storage.Progress) Analyzer {
+			return fakeAnalyzer{name: "fake", candidates: []Candidate{{Path: args.Root}}}
+		})
+	}
+	if !slices.Contains(Analyzers(), "fake") {
+		t.Fatalf("Analyzers() = %v; want it to contain %q", Analyzers(), "fake")
+	}
+
+	analyzers, err := NewAnalyzers([]string{"fake", AnalyzerGames}, Args{Root: "/fake"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(analyzers) != 2 || analyzers[0].Name() != "fake" || analyzers[1].Name() != AnalyzerGames {
+		t.Errorf("NewAnalyzers() = %v; want the fake and games analyzers", analyzers)
+	}
+
+	_, err = NewAnalyzers([]string{"unknown"}, Args{}, nil)
+	if err == nil {
+		t.Errorf("NewAnalyzers() with an unknown analyzer should fail")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Register() should panic when an analyzer is registered twice")
+		}
+	}()
+	Register("fake", func(Args, *storage.Progress) Analyzer { return fakeAnalyzer{} })
+}
+
+func TestStream(t *testing.T) {
+	analyzers := []Analyzer{
+		fakeAnalyzer{name: "a", candidates: []Candidate{{Path: "/a/1", Size: 1}, {Path: "/a/2", Size: 2, Category: "two"}}},
+		fakeAnalyzer{name: "broken", err: errors.New("broken")},
+		fakeAnalyzer{name: "b", candidates: []Candidate{{Path: "/b/1", Size: 3}}},
+	}
+	progress := &Progress{}
+
+	var files []CleanableFile
+	for event := range Stream(context.Background(), "/", analyzers, progress) {
+		files = append(files, event.File)
+	}
+
+	slices.SortFunc(files, func(a, b CleanableFile) int {
+		return int(a.Size - b.Size)
+	})
+	expected := []CleanableFile{
+		{Path: "/a/1", Size: 1, Analyzer: "a"},
+		{Path: "/a/2", Size: 2, Analyzer: "a", Category: "two"},
+		{Path: "/b/1", Size: 3, Analyzer: "b"},
+	}
+	if len(files) != len(expected) {
+		t.Fatalf("Stream() = %+v; want %+v", files, expected)
+	}
+	for i := range expected {
+		if files[i].Path != expected[i].Path || files[i].Analyzer != expected[i].Analyzer || files[i].Category != expected[i].Category {
+			t.Errorf("Stream()[%d] = %+v; want %+v", i, files[i], expected[i])
+		}
+	}
+	if running := progress.Running(); len(running) != 0 {
+		t.Errorf("Running() = %v after the analysis; want none", running)
+	}
+}
+
+func TestStreamCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	analyzers := []Analyzer{
+		fakeAnalyzer{name: "a", candidates: make([]Candidate, 100)},
+	}
+	ch := Stream(ctx, "/", analyzers, &Progress{})
+	<-ch
+	cancel()
+	// The channel has to be closed even though most of the candidates are never received.
+	for range ch {
+	}
+}
+
+func TestStreamOverlap(t *testing.T) {
+	// The large files analyzer comes first here but last in priority, the files it shares with the others are theirs.
+	analyzers := []Analyzer{
+		fakeAnalyzer{name: AnalyzerLargeFiles, candidates: []Candidate{
+			{Path: "/repo/video.iso", Size: 10, PathsToRemove: []string{"/repo/video.iso"}},
+			{Path: "/dups/kept.zip", Size: 10, PathsToRemove: []string{"/dups/kept.zip"}},
+			{Path: "/media/movie.mkv", Size: 10, PathsToRemove: []string{"/media/movie.mkv"}},
+			{Path: "/backup.tar", Size: 10, PathsToRemove: []string{"/backup.tar"}},
+		}},
+		fakeAnalyzer{name: AnalyzerMedia, candidates: []Candidate{
+			{Path: "/media/movie.mkv", Size: 10, PathsToRemove: []string{"/media/movie.mkv"}},
+			{Path: "/dups/copy.zip", Size: 10, PathsToRemove: []string{"/dups/copy.zip"}},
+		}},
+		fakeAnalyzer{name: AnalyzerDuplicates, candidates: []Candidate{
+			{Path: "/dups/kept.zip", Size: 10, PathsToRemove: []string{"/dups/copy.zip"}, KeepOne: true},
+		}},
+		fakeAnalyzer{name: AnalyzerRepos, candidates: []Candidate{
+			{Path: "/repo", Size: 100, PathsToRemove: []string{"/repo"}},
+		}},
+	}
+
+	// The analyzers run concurrently, so the files that are left in the end have to be the same whichever order
+	// they turn up in.
+	files := make(map[string]CleanableFile)
+	var total int64
+	for event := range Stream(context.Background(), "/", analyzers, &Progress{}) {
+		if event.Retracted {
+			total -= files[event.File.Path].Size
+			delete(files, event.File.Path)
+			continue
+		}
+		if _, ok := files[event.File.Path]; ok {
+			t.Errorf("%s is sent while it's already there", event.File.Path)
+		}
+		files[event.File.Path] = event.File
+		total += event.File.Size
+	}
+	var got []string
+	for _, file := range files {
+		got = append(got, file.Analyzer+":"+file.Path)
+	}
+	slices.Sort(got)
+	expected := []string{"duplicates:/dups/kept.zip", "large:/backup.tar", "media:/media/movie.mkv", "repos:/repo"}
+	if !slices.Equal(got, expected) {
+		t.Errorf("Stream() = %v; want %v", got, expected)
+	}
+	if total != 130 {
+		t.Errorf("the sizes of the files add up to %d; want 130", total)
+	}
+}
+
+func TestStreamRetract(t *testing.T) {
+	ch := make(chan Event, 10)
+	s := &stream{ctx: context.Background(), ch: ch, files: make([][]CleanableFile, len(priority))}
+	large := CleanableFile{Path: "/photos/a.iso", Analyzer: AnalyzerLargeFiles, PathsToRemove: []string{"/photos/a.iso"}}
+	duplicate := CleanableFile{Path: "/repo/a.iso", Analyzer: AnalyzerDuplicates, PathsToRemove: []string{"/photos/a.iso"}, KeepOne: true}
+	repo := CleanableFile{Path: "/repo", Analyzer: AnalyzerRepos, PathsToRemove: []string{"/repo"}}
+	// Each file comes before the one found before it in priority.
+	for _, file := range []CleanableFile{large, duplicate, repo} {
+		s.add(rank(file.Analyzer), file)
+	}
+	close(ch)
+
+	var got []string
+	for event := range ch {
+		change := "+"
+		if event.Retracted {
+			change = "-"
+		}
+		got = append(got, change+event.File.Analyzer+":"+event.File.Path)
+	}
+	// The large file is only blocked by the duplicate, so it's back once the repository takes the duplicate's place.
+	expected := []string{
+		"+large:/photos/a.iso",
+		"-large:/photos/a.iso", "+duplicates:/repo/a.iso",
+		"-duplicates:/repo/a.iso", "+repos:/repo", "+large:/photos/a.iso",
+	}
+	if !slices.Equal(got, expected) {
+		t.Errorf("events = %v; want %v", got, expected)
+	}
+}
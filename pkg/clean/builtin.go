@@ -0,0 +1,350 @@
+package clean
+
+import (
+	"context"
+	"errors"
+	"github.com/sebastianappelberg/disk/pkg/clutter"
+	"github.com/sebastianappelberg/disk/pkg/duplicates"
+	"github.com/sebastianappelberg/disk/pkg/games"
+	"github.com/sebastianappelberg/disk/pkg/largefiles"
+	"github.com/sebastianappelberg/disk/pkg/media"
+	"github.com/sebastianappelberg/disk/pkg/repos"
+	"github.com/sebastianappelberg/disk/pkg/storage"
+	"log"
+	"time"
+)
+
+func init() {
+	Register(AnalyzerClutter, newClutterAnalyzer)
+	Register(AnalyzerGames, newGamesAnalyzer)
+	Register(AnalyzerMedia, newMediaAnalyzer)
+	Register(AnalyzerRepos, newReposAnalyzer)
+	Register(AnalyzerDuplicates, newDuplicatesAnalyzer)
+	Register(AnalyzerLargeFiles, newLargeFilesAnalyzer)
+}
+
+// send sends the candidate on ch unless ctx is cancelled first, in which case it returns false.
+func send(ctx context.Context, ch chan<- Candidate, candidate Candidate) bool {
+	select {
+	case ch <- candidate:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+type clutterAnalyzer struct {
+	analyzer *clutter.Analyzer
+	sizeMode storage.SizeMode
+}
+
+func newClutterAnalyzer(args Args, progress *storage.Progress) Analyzer {
+	options := []clutter.AnalyzerOption{
+		clutter.WithSizeFilter(args.MinSize),
+		clutter.WithMinAgeFilter(args.minAgeTime()),
+		clutter.WithProgress(progress),
+		clutter.WithSizeMode(args.SizeMode),
+		clutter.WithAgeMode(args.AgeMode),
+	}
+	if args.OneFileSystem {
+		options = append(options, clutter.WithOneFileSystem())
+	}
+	if args.IncludeUnregenerable {
+		options = append(options, clutter.WithUnregenerable())
+	}
+	if args.Git {
+		options = append(options, clutter.WithGit())
+	}
+	return clutterAnalyzer{
+		analyzer: clutter.NewAnalyzer(options...),
+		sizeMode: args.SizeMode,
+	}
+}
+
+func (a clutterAnalyzer) Name() string {
+	return AnalyzerClutter
+}
+
+func (a clutterAnalyzer) Description() string {
+	return "Clutter in the form caches, dependency folders, build folders, etc. above a given size and age."
+}
+
+func (a clutterAnalyzer) Analyze(ctx context.Context, root string) (<-chan Candidate, error) {
+	ch := make(chan Candidate)
+	go func() {
+		defer close(ch)
+		for file := range a.analyzer.Stream(ctx, root) {
+			candidate := Candidate{
+				Path:          file.GetPath(),
+				ModTime:       file.ModTime,
+				LastUsed:      file.LastUsed,
+				Size:          file.Usage().Size(a.sizeMode),
+				Usage:         file.Usage(),
+				Category:      file.Category,
+				PathsToRemove: file.GetPaths(),
+				Regenerable:   file.Regenerable,
+				Restore:       file.Restore,
+			}
+			if !send(ctx, ch, candidate) {
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+type gamesAnalyzer struct {
+	analyzer *games.Analyzer
+}
+
+func newGamesAnalyzer(args Args, _ *storage.Progress) Analyzer {
+	return gamesAnalyzer{
+		analyzer: games.NewAnalyzer(
+			games.WithMaxPlaytime(time.Duration(args.MaxPlaytime)*time.Hour),
+			games.WithLastPlayedBefore(args.minAgeTime()),
+		),
+	}
+}
+
+func (a gamesAnalyzer) Name() string {
+	return AnalyzerGames
+}
+
+func (a gamesAnalyzer) Description() string {
+	return "Steam games you haven't played in a while."
+}
+
+func (a gamesAnalyzer) Analyze(ctx context.Context, _ string) (<-chan Candidate, error) {
+	ch := make(chan Candidate)
+	go func() {
+		defer close(ch)
+		// The Steam libraries are scanned here rather than before returning, so that it doesn't hold up the others.
+		gms, err := a.analyzer.Analyze()
+		if err != nil && !errors.Is(err, games.ErrSteamNotFound) {
+			log.Printf("Error running the %s analyzer: %v", a.Name(), err)
+			return
+		}
+		// If Steam isn't installed there simply aren't any games to remove.
+		for _, g := range gms {
+			candidate := Candidate{
+				Path:          g.Path,
+				ModTime:       g.LastPlayed,
+				Size:          g.Size,
+				PathsToRemove: g.GetPaths(),
+				// Games can be installed again from Steam.
+				Regenerable: true,
+			}
+			if !send(ctx, ch, candidate) {
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+type mediaAnalyzer struct {
+	analyzer *media.Analyzer
+	sizeMode storage.SizeMode
+}
+
+func newMediaAnalyzer(args Args, progress *storage.Progress) Analyzer {
+	options := []media.AnalyzerOption{
+		media.WithProgress(progress),
+	}
+	if args.OneFileSystem {
+		options = append(options, media.WithOneFileSystem())
+	}
+	return mediaAnalyzer{
+		analyzer: media.NewAnalyzer(options...),
+		sizeMode: args.SizeMode,
+	}
+}
+
+func (a mediaAnalyzer) Name() string {
+	return AnalyzerMedia
+}
+
+func (a mediaAnalyzer) Description() string {
+	return "Movies and TV shows that are easy to get a hold of even if you delete them."
+}
+
+func (a mediaAnalyzer) Analyze(ctx context.Context, root string) (<-chan Candidate, error) {
+	ch := make(chan Candidate)
+	go func() {
+		defer close(ch)
+		for file := range a.analyzer.Stream(ctx, root) {
+			candidate := Candidate{
+				Path:          file.GetPath(),
+				ModTime:       file.ModTime,
+				Size:          file.Usage().Size(a.sizeMode),
+				Usage:         file.Usage(),
+				PathsToRemove: file.GetPaths(),
+				// The analyzer only suggests media that's easy to get a hold of again.
+				Regenerable: true,
+			}
+			if !send(ctx, ch, candidate) {
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+type reposAnalyzer struct {
+	analyzer *repos.Analyzer
+	sizeMode storage.SizeMode
+}
+
+func newReposAnalyzer(args Args, progress *storage.Progress) Analyzer {
+	options := []repos.AnalyzerOption{
+		repos.WithSizeFilter(args.MinSize),
+		repos.WithMinAgeFilter(args.minAgeTime()),
+		repos.WithProgress(progress),
+		repos.WithSizeMode(args.SizeMode),
+	}
+	if args.OneFileSystem {
+		options = append(options, repos.WithOneFileSystem())
+	}
+	return reposAnalyzer{
+		analyzer: repos.NewAnalyzer(options...),
+		sizeMode: args.SizeMode,
+	}
+}
+
+func (a reposAnalyzer) Name() string {
+	return AnalyzerRepos
+}
+
+func (a reposAnalyzer) Description() string {
+	return "Git repositories you haven't touched in a while where everything is pushed, so they can be cloned again."
+}
+
+func (a reposAnalyzer) Analyze(ctx context.Context, root string) (<-chan Candidate, error) {
+	ch := make(chan Candidate)
+	go func() {
+		defer close(ch)
+		for repo := range a.analyzer.Stream(ctx, root) {
+			candidate := Candidate{
+				Path:          repo.GetPath(),
+				ModTime:       repo.LastActivity,
+				Size:          repo.Usage().Size(a.sizeMode),
+				Usage:         repo.Usage(),
+				Category:      "git",
+				PathsToRemove: repo.GetPaths(),
+				// Nothing is lost since everything has been pushed.
+				Regenerable: true,
+			}
+			if repo.URL != "" {
+				candidate.Restore = "git clone " + repo.URL
+			}
+			if !send(ctx, ch, candidate) {
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+type duplicatesAnalyzer struct {
+	analyzer *duplicates.Analyzer
+	sizeMode storage.SizeMode
+}
+
+func newDuplicatesAnalyzer(args Args, progress *storage.Progress) Analyzer {
+	options := []duplicates.AnalyzerOption{
+		duplicates.WithSizeFilter(args.MinSize),
+		duplicates.WithProgress(progress),
+		duplicates.WithSizeMode(args.SizeMode),
+	}
+	if args.OneFileSystem {
+		options = append(options, duplicates.WithOneFileSystem())
+	}
+	return duplicatesAnalyzer{
+		analyzer: duplicates.NewAnalyzer(options...),
+		sizeMode: args.SizeMode,
+	}
+}
+
+func (a duplicatesAnalyzer) Name() string {
+	return AnalyzerDuplicates
+}
+
+func (a duplicatesAnalyzer) Description() string {
+	return "Identical copies of the same file, of which one is kept."
+}
+
+func (a duplicatesAnalyzer) Analyze(ctx context.Context, root string) (<-chan Candidate, error) {
+	ch := make(chan Candidate)
+	go func() {
+		defer close(ch)
+		for group := range a.analyzer.Stream(ctx, root) {
+			candidate := Candidate{
+				Path:          group.GetPath(),
+				ModTime:       group.ModTime(),
+				Size:          group.Usage().Size(a.sizeMode),
+				Usage:         group.Usage(),
+				PathsToRemove: group.GetPaths(),
+				// Nothing is lost since one of the copies is kept.
+				Regenerable: true,
+				KeepOne:     true,
+			}
+			if !send(ctx, ch, candidate) {
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+type largeFilesAnalyzer struct {
+	analyzer *largefiles.Analyzer
+	sizeMode storage.SizeMode
+}
+
+func newLargeFilesAnalyzer(args Args, progress *storage.Progress) Analyzer {
+	options := []largefiles.AnalyzerOption{
+		largefiles.WithSizeFilter(args.MinFileSize),
+		largefiles.WithMinAgeFilter(args.minAgeTime()),
+		largefiles.WithCategories(args.FileCategories...),
+		largefiles.WithProgress(progress),
+		largefiles.WithSizeMode(args.SizeMode),
+		largefiles.WithAgeMode(args.AgeMode),
+	}
+	if args.OneFileSystem {
+		options = append(options, largefiles.WithOneFileSystem())
+	}
+	return largeFilesAnalyzer{
+		analyzer: largefiles.NewAnalyzer(options...),
+		sizeMode: args.SizeMode,
+	}
+}
+
+func (a largeFilesAnalyzer) Name() string {
+	return AnalyzerLargeFiles
+}
+
+func (a largeFilesAnalyzer) Description() string {
+	return "Large files you haven't touched in a while, such as archives, disk images and installers."
+}
+
+func (a largeFilesAnalyzer) Analyze(ctx context.Context, root string) (<-chan Candidate, error) {
+	ch := make(chan Candidate)
+	go func() {
+		defer close(ch)
+		for file := range a.analyzer.Stream(ctx, root) {
+			candidate := Candidate{
+				Path:          file.GetPath(),
+				ModTime:       file.ModTime,
+				LastUsed:      file.LastUsed,
+				Size:          file.Usage().Size(a.sizeMode),
+				Usage:         file.Usage(),
+				Category:      file.Category,
+				PathsToRemove: file.GetPaths(),
+			}
+			if !send(ctx, ch, candidate) {
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
@@ -1,11 +1,16 @@
 package clean
 
 import (
-	"github.com/sebastianappelberg/disk/pkg/clutter"
+	"cmp"
+	"context"
 	"github.com/sebastianappelberg/disk/pkg/config"
-	"github.com/sebastianappelberg/disk/pkg/games"
-	"github.com/sebastianappelberg/disk/pkg/media"
+	"github.com/sebastianappelberg/disk/pkg/storage"
 	"github.com/sebastianappelberg/disk/pkg/trash"
+	"log"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -14,13 +19,50 @@ type Args struct {
 	MinAge      int
 	MinSize     int
 	MaxPlaytime int
+	Analyzers   []string // Analyzers are the names of the analyzers to run, all registered analyzers are run if it's empty.
+	// OneFileSystem makes the analyzers stay on the file system that Root is on.
+	OneFileSystem bool
+	// SizeMode decides whether the size of a file, which MinSize applies to, is its allocated or apparent size.
+	SizeMode storage.SizeMode
+	// IncludeUnregenerable includes dependency folders that can't be restored the way they were since there's no lockfile.
+	IncludeUnregenerable bool
+	// Git makes the clutter analyzer suggest what git repositories ignore, and never anything that they track.
+	Git bool
+	// MinFileSize is the minimum size of the files that the large files analyzer suggests, in megabytes.
+	MinFileSize int
+	// FileCategories limits the large files analyzer to files in these categories, e.g. "archives".
+	FileCategories []string
+	// AgeMode decides whether MinAge applies to when clutter and large files were last modified or accessed.
+	AgeMode storage.AgeMode
 }
 
+// minAgeTime returns the time that files have to be older than to be included.
+func (a Args) minAgeTime() time.Time {
+	return time.Now().AddDate(0, 0, -a.MinAge)
+}
+
+const (
+	AnalyzerClutter    = "clutter"
+	AnalyzerGames      = "games"
+	AnalyzerMedia      = "media"
+	AnalyzerRepos      = "repos"
+	AnalyzerDuplicates = "duplicates"
+	AnalyzerLargeFiles = "large"
+)
+
 type CleanableFile struct {
-	Path          string
-	ModTime       time.Time
-	Size          int64
-	PathsToRemove []string
+	Path          string    `json:"path"`
+	ModTime       time.Time `json:"modTime"`
+	LastUsed      time.Time `json:"lastUsed"`           // LastUsed is when the file was last used, see Candidate.LastUsed.
+	Size          int64     `json:"size"`               // Size is the allocated or apparent size, depending on Args.SizeMode.
+	AllocatedSize int64     `json:"allocatedSize"`      // AllocatedSize is the disk space that the file uses.
+	ApparentSize  int64     `json:"apparentSize"`       // ApparentSize is the number of bytes in the file.
+	Analyzer      string    `json:"analyzer"`           // Analyzer is the name of the analyzer that marked the file as cleanable.
+	Category      string    `json:"category,omitempty"` // Category is the clutter category of the file, e.g. "javascript".
+	PathsToRemove []string  `json:"pathsToRemove"`
+	Regenerable   bool      `json:"regenerable"`       // Regenerable is true if the file can be restored after it's removed.
+	Restore       string    `json:"restore,omitempty"` // Restore is the command that restores the file, e.g. "npm ci".
+	KeepOne       bool      `json:"keepOne,omitempty"` // KeepOne is true if Path is kept and only PathsToRemove are removed.
 }
 
 // Removable is to be implemented by any file
@@ -29,61 +71,354 @@ type Removable interface {
 	GetPaths() []string
 }
 
-func (f CleanableFile) Remove() error {
-	return trash.Put(f.PathsToRemove...)
+// Remove puts the file in the trash and returns the resulting trash items.
+func (f CleanableFile) Remove() ([]trash.Item, error) {
+	return trash.PutItems(f.PathsToRemove...)
+}
+
+// Usage returns both the allocated and the apparent size of the file.
+func (f CleanableFile) Usage() storage.Usage {
+	return storage.Usage{Allocated: f.AllocatedSize, Apparent: f.ApparentSize}
 }
 
 func (f CleanableFile) Exclude() {
 	config.ExcludeFolder(f.Path)
+	if f.KeepOne {
+		// Whichever of the files is kept the next time, it's still excluded.
+		for _, path := range f.PathsToRemove {
+			config.ExcludeFolder(path)
+		}
+	}
+}
+
+// KeepNext returns the file with the next of PathsToRemove kept instead of Path, which is removed instead.
+// Files that aren't KeepOne are returned as they are.
+func (f CleanableFile) KeepNext() CleanableFile {
+	if !f.KeepOne || len(f.PathsToRemove) == 0 {
+		return f
+	}
+	next := f
+	next.Path = f.PathsToRemove[0]
+	next.PathsToRemove = append(slices.Clone(f.PathsToRemove[1:]), f.Path)
+	return next
 }
 
-func Clean(args Args) []CleanableFile {
-	minAge := time.Now().AddDate(0, 0, -args.MinAge)
-	clutterAnalyzer := clutter.NewAnalyzer(
-		clutter.WithSizeFilter(args.MinSize),
-		clutter.WithMinAgeFilter(minAge),
-	)
-	gamesAnalyzer := games.NewAnalyzer(
-		games.WithMaxPlaytime(time.Duration(args.MaxPlaytime)*time.Hour),
-		games.WithLastPlayedBefore(minAge),
-	)
-	mediaAnalyzer := media.NewAnalyzer()
-	files := clutterAnalyzer.Analyze(args.Root)
-	// TODO: Could probably get all analyzers on the same format.
-	var cleanables []CleanableFile
-	for _, file := range files {
-		cleanables = append(cleanables, CleanableFile{
-			Path:          file.GetPath(),
-			ModTime:       file.ModTime,
-			Size:          file.Size,
-			PathsToRemove: file.GetPaths(),
-		})
-	}
-	gms, err := gamesAnalyzer.Analyze()
-	if err == nil {
-		for _, g := range gms {
-			cleanables = append(cleanables, CleanableFile{
-				Path:          g.Path,
-				ModTime:       g.LastPlayed,
-				Size:          g.Size,
-				PathsToRemove: g.GetPaths(),
+// Progress reports how far the analysis has come. It's safe to read while the analysis is running.
+type Progress struct {
+	storage.Progress
+	mu      sync.Mutex
+	running []string
+}
+
+// Running returns the names of the analyzers that are still running.
+func (p *Progress) Running() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Clone(p.running)
+}
+
+func (p *Progress) start(analyzer string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.running = append(p.running, analyzer)
+}
+
+func (p *Progress) done(analyzer string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.running = slices.DeleteFunc(p.running, func(name string) bool {
+		return name == analyzer
+	})
+}
+
+// Clean runs the analyzers selected by args and returns the files that can be removed, grouped by analyzer
+// and sorted by path. The progress of the analysis is reported to progress, which may be nil.
+func Clean(ctx context.Context, args Args, progress *Progress) ([]CleanableFile, error) {
+	if progress == nil {
+		progress = &Progress{}
+	}
+	analyzers, err := NewAnalyzers(args.Analyzers, args, &progress.Progress)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, analyzer := range analyzers {
+		names = append(names, analyzer.Name())
+	}
+
+	var result []CleanableFile
+	for event := range Stream(ctx, args.Root, analyzers, progress) {
+		if event.Retracted {
+			// Files that are sent never overlap, so the path is enough to tell which one it is.
+			result = slices.DeleteFunc(result, func(file CleanableFile) bool {
+				return file.Path == event.File.Path
 			})
+			continue
 		}
+		result = append(result, event.File)
 	}
-	mediaFiles := mediaAnalyzer.Analyze(args.Root)
-	for _, file := range mediaFiles {
-		cleanables = append(cleanables, CleanableFile{
-			Path:          file.GetPath(),
-			ModTime:       file.ModTime,
-			Size:          file.Size,
-			PathsToRemove: file.GetPaths(),
-		})
-	}
-	var filteredResult []CleanableFile
-	for _, file := range cleanables {
-		if !config.UserExcludedFolders[file.Path] {
-			filteredResult = append(filteredResult, file)
+	slices.SortFunc(result, func(a, b CleanableFile) int {
+		return cmp.Or(
+			cmp.Compare(slices.Index(names, a.Analyzer), slices.Index(names, b.Analyzer)),
+			strings.Compare(a.Path, b.Path),
+		)
+	})
+	return result, nil
+}
+
+// priority is the order in which the analyzers get to claim a file when more than one of them suggests it, or
+// something in it. Folders come first since they're removed as a whole, then the copies of duplicates since the
+// copy that's kept mustn't be removed by another analyzer. Analyzers that aren't listed come last.
+var priority = []string{AnalyzerClutter, AnalyzerGames, AnalyzerRepos, AnalyzerDuplicates, AnalyzerMedia, AnalyzerLargeFiles}
+
+// Event is a change to the files that Stream has found: a file that can be removed, or a file that was sent before
+// and has been retracted since a file that comes first in priority turned up and overlaps it.
+type Event struct {
+	File CleanableFile
+	// Retracted is true if File was sent before and mustn't be removed after all.
+	Retracted bool
+}
+
+// Stream runs the analyzers concurrently and sends the files that can be removed on the returned channel as soon as
+// they're found. The channel is closed once all analyzers are done. Analyzers that fail to start are logged and
+// skipped.
+//
+// A file is never suggested twice, nor a file in a folder that's suggested: the analyzer that comes first in
+// priority gets it. Since the analyzers run at the same time, a file may turn up after the files it overlaps have
+// been sent, in which case they're retracted. Once the channel is closed, the files that are left are the same
+// whatever order they were found in.
+func Stream(ctx context.Context, root string, analyzers []Analyzer, progress *Progress) <-chan Event {
+	analyzers = slices.Clone(analyzers)
+	slices.SortStableFunc(analyzers, func(a, b Analyzer) int {
+		return cmp.Compare(rank(a.Name()), rank(b.Name()))
+	})
+	results := make(chan streamResult)
+	var wg sync.WaitGroup
+	for i, analyzer := range analyzers {
+		candidates, err := analyzer.Analyze(ctx, root)
+		if err != nil {
+			log.Printf("Error running the %s analyzer: %v", analyzer.Name(), err)
+			continue
 		}
+		progress.start(analyzer.Name())
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer progress.done(analyzer.Name())
+			for candidate := range candidates {
+				if config.IsExcluded(candidate.Path) {
+					continue
+				}
+				select {
+				case results <- streamResult{rank: i, file: newCleanableFile(analyzer.Name(), candidate)}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	ch := make(chan Event)
+	go func() {
+		defer close(ch)
+		s := &stream{ctx: ctx, ch: ch, files: make([][]CleanableFile, len(analyzers))}
+		for result := range results {
+			s.add(result.rank, result.file)
+		}
+	}()
+	return ch
+}
+
+// rank returns the position of the analyzer in priority.
+func rank(name string) int {
+	if i := slices.Index(priority, name); i >= 0 {
+		return i
+	}
+	return len(priority)
+}
+
+// streamResult is a file that an analyzer found.
+type streamResult struct {
+	rank int
+	file CleanableFile
+}
+
+// fileID is the position of a file among the files that Stream has received, by the rank of its analyzer.
+type fileID struct {
+	rank int
+	i    int
+}
+
+// stream decides which of the files that the analyzers find are sent. It makes the same choice as going through
+// the files of the analyzers in the order of their priority would, leaving out the ones that are claimed.
+type stream struct {
+	ctx context.Context
+	ch  chan<- Event
+	// files holds the files of every analyzer in the order they were found, including the ones that weren't sent.
+	files [][]CleanableFile
+	// sent holds the files that have been sent and haven't been retracted, in the order they were claimed.
+	sent   []fileID
+	claims claims
+}
+
+func (s *stream) add(rank int, file CleanableFile) {
+	id := fileID{rank: rank, i: len(s.files[rank])}
+	s.files[rank] = append(s.files[rank], file)
+	overlapping := s.overlapping(file)
+	if slices.ContainsFunc(overlapping, func(other fileID) bool { return other.rank <= rank }) {
+		return
+	}
+	if len(overlapping) == 0 {
+		// None of the files that have been sent overlap it, so nothing else changes.
+		s.claim(id)
+		s.send(Event{File: file})
+		return
+	}
+	s.redo(id)
+}
+
+// redo decides again which of the files that come after id in priority are sent, as if id had been found before
+// them. The ones that aren't sent anymore are retracted, and the ones that they were blocking may be sent now.
+func (s *stream) redo(id fileID) {
+	before := s.sent
+	wasSent := make(map[fileID]bool)
+	s.sent = nil
+	s.claims = claims{}
+	for _, other := range before {
+		if other.rank <= id.rank {
+			s.claim(other)
+		} else {
+			wasSent[other] = true
+		}
+	}
+	s.claim(id)
+	sends := []fileID{id}
+	for rank := id.rank + 1; rank < len(s.files); rank++ {
+		for i, file := range s.files[rank] {
+			if len(s.overlapping(file)) > 0 {
+				continue
+			}
+			other := fileID{rank: rank, i: i}
+			s.claim(other)
+			if wasSent[other] {
+				delete(wasSent, other)
+			} else {
+				sends = append(sends, other)
+			}
+		}
+	}
+	// The retractions go first so that the files that are sent in the meantime never overlap.
+	for _, other := range before {
+		if wasSent[other] {
+			s.send(Event{File: s.file(other), Retracted: true})
+		}
+	}
+	for _, other := range sends {
+		s.send(Event{File: s.file(other)})
+	}
+}
+
+func (s *stream) file(id fileID) CleanableFile {
+	return s.files[id.rank][id.i]
+}
+
+// overlapping returns the files that have been sent that overlap file.
+func (s *stream) overlapping(file CleanableFile) []fileID {
+	var ids []fileID
+	for _, path := range file.paths() {
+		ids = append(ids, s.claims.overlapping(path)...)
+	}
+	return ids
+}
+
+func (s *stream) claim(id fileID) {
+	for _, path := range s.file(id).paths() {
+		s.claims.add(id, path)
+	}
+	s.sent = append(s.sent, id)
+}
+
+func (s *stream) send(event Event) {
+	select {
+	case s.ch <- event:
+	case <-s.ctx.Done():
+	}
+}
+
+// paths returns the paths that the file claims, including the one that's kept.
+func (f CleanableFile) paths() []string {
+	return append([]string{f.Path}, f.PathsToRemove...)
+}
+
+// claims holds the paths of the files that have been sent, including the ones that are kept, and the folders that
+// they're in.
+type claims struct {
+	// paths maps the claimed paths to the file that claimed them.
+	paths map[string]fileID
+	// below maps the folders to the files that have claimed something in them.
+	below map[string][]fileID
+}
+
+// overlapping returns the files that have claimed path or a folder above it, or something in it if it's a folder.
+func (c *claims) overlapping(path string) []fileID {
+	path = filepath.Clean(path)
+	ids := slices.Clone(c.below[path])
+	for {
+		if id, ok := c.paths[path]; ok {
+			ids = append(ids, id)
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return ids
+		}
+		path = parent
+	}
+}
+
+func (c *claims) add(id fileID, path string) {
+	if c.paths == nil {
+		c.paths = make(map[string]fileID)
+		c.below = make(map[string][]fileID)
+	}
+	path = filepath.Clean(path)
+	c.paths[path] = id
+	for parent := filepath.Dir(path); ; parent = filepath.Dir(parent) {
+		if ids := c.below[parent]; len(ids) > 0 && ids[len(ids)-1] == id {
+			// The file has claimed something else in the folder, so it's in the ones above it as well.
+			return
+		}
+		c.below[parent] = append(c.below[parent], id)
+		if filepath.Dir(parent) == parent {
+			return
+		}
+	}
+}
+
+func newCleanableFile(analyzer string, candidate Candidate) CleanableFile {
+	usage := candidate.Usage
+	if usage == (storage.Usage{}) {
+		usage = storage.Usage{Allocated: candidate.Size, Apparent: candidate.Size}
+	}
+	lastUsed := candidate.LastUsed
+	if lastUsed.IsZero() {
+		lastUsed = candidate.ModTime
+	}
+	return CleanableFile{
+		Path:          candidate.Path,
+		ModTime:       candidate.ModTime,
+		LastUsed:      lastUsed,
+		Size:          candidate.Size,
+		AllocatedSize: usage.Allocated,
+		ApparentSize:  usage.Apparent,
+		Analyzer:      analyzer,
+		Category:      candidate.Category,
+		PathsToRemove: candidate.PathsToRemove,
+		Regenerable:   candidate.Regenerable,
+		Restore:       candidate.Restore,
+		KeepOne:       candidate.KeepOne,
 	}
-	return filteredResult
 }
@@ -0,0 +1,76 @@
+package clean
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	FormatJSON   = "json"
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+// Formats lists the formats supported by WriteReport.
+var Formats = []string{FormatJSON, FormatCSV, FormatNDJSON}
+
+// csvPathSeparator separates the paths to remove since they all have to fit in a single column.
+const csvPathSeparator = ";"
+
+// WriteReport writes the files to w in the given format.
+func WriteReport(w io.Writer, files []CleanableFile, format string) error {
+	// Make sure that an empty result is written as [] and not null.
+	if files == nil {
+		files = []CleanableFile{}
+	}
+	switch format {
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(files)
+	case FormatNDJSON:
+		encoder := json.NewEncoder(w)
+		for _, file := range files {
+			err := encoder.Encode(file)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case FormatCSV:
+		return writeCSV(w, files)
+	}
+	return fmt.Errorf("unsupported format %q, expected one of %s", format, strings.Join(Formats, ", "))
+}
+
+func writeCSV(w io.Writer, files []CleanableFile) error {
+	writer := csv.NewWriter(w)
+	err := writer.Write([]string{"path", "size", "modTime", "lastUsed", "analyzer", "category", "pathsToRemove", "regenerable", "restore", "keepOne"})
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		err = writer.Write([]string{
+			file.Path,
+			strconv.FormatInt(file.Size, 10),
+			file.ModTime.Format(time.RFC3339),
+			file.LastUsed.Format(time.RFC3339),
+			file.Analyzer,
+			file.Category,
+			strings.Join(file.PathsToRemove, csvPathSeparator),
+			strconv.FormatBool(file.Regenerable),
+			file.Restore,
+			strconv.FormatBool(file.KeepOne),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,116 @@
+package clean
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+var reportFiles = []CleanableFile{
+	{
+		Path:          "/home/user/src/app/node_modules",
+		ModTime:       time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		LastUsed:      time.Date(2024, 2, 3, 4, 5, 6, 0, time.UTC),
+		Size:          1024,
+		Analyzer:      AnalyzerClutter,
+		Category:      "javascript",
+		PathsToRemove: []string{"/home/user/src/app/node_modules"},
+		Regenerable:   true,
+		Restore:       "npm ci",
+	},
+	{
+		Path:          "/games/common/Game",
+		ModTime:       time.Date(2023, 5, 6, 7, 8, 9, 0, time.UTC),
+		LastUsed:      time.Date(2023, 5, 6, 7, 8, 9, 0, time.UTC),
+		Size:          2048,
+		Analyzer:      AnalyzerGames,
+		PathsToRemove: []string{"/games/common/Game", "/games/appmanifest_1.acf"},
+	},
+	{
+		Path:          "/home/user/photos/beach.jpg",
+		ModTime:       time.Date(2022, 8, 9, 10, 11, 12, 0, time.UTC),
+		LastUsed:      time.Date(2022, 8, 9, 10, 11, 12, 0, time.UTC),
+		Size:          4096,
+		Analyzer:      AnalyzerDuplicates,
+		PathsToRemove: []string{"/home/user/backup/beach.jpg"},
+		KeepOne:       true,
+	},
+}
+
+func TestWriteReport_JSON(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteReport(&buf, reportFiles, FormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []CleanableFile
+	err = json.Unmarshal(buf.Bytes(), &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(reportFiles) {
+		t.Fatalf("got %d files, want %d", len(got), len(reportFiles))
+	}
+	if got[1].Analyzer != AnalyzerGames || len(got[1].PathsToRemove) != 2 {
+		t.Errorf("unexpected file: %+v", got[1])
+	}
+	if !got[0].LastUsed.Equal(reportFiles[0].LastUsed) || !got[0].ModTime.Equal(reportFiles[0].ModTime) {
+		t.Errorf("got modTime %v and lastUsed %v, want %v and %v", got[0].ModTime, got[0].LastUsed, reportFiles[0].ModTime, reportFiles[0].LastUsed)
+	}
+}
+
+func TestWriteReport_JSONEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteReport(&buf, nil, FormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(buf.String()) != "[]" {
+		t.Errorf("got %q, want []", buf.String())
+	}
+}
+
+func TestWriteReport_NDJSON(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteReport(&buf, reportFiles, FormatNDJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != len(reportFiles) {
+		t.Fatalf("got %d lines, want %d", len(lines), len(reportFiles))
+	}
+	var got CleanableFile
+	err = json.Unmarshal([]byte(lines[0]), &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Path != reportFiles[0].Path {
+		t.Errorf("got path %q, want %q", got.Path, reportFiles[0].Path)
+	}
+}
+
+func TestWriteReport_CSV(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteReport(&buf, reportFiles, FormatCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `path,size,modTime,lastUsed,analyzer,category,pathsToRemove,regenerable,restore,keepOne
+/home/user/src/app/node_modules,1024,2024-01-02T03:04:05Z,2024-02-03T04:05:06Z,clutter,javascript,/home/user/src/app/node_modules,true,npm ci,false
+/games/common/Game,2048,2023-05-06T07:08:09Z,2023-05-06T07:08:09Z,games,,/games/common/Game;/games/appmanifest_1.acf,false,,false
+/home/user/photos/beach.jpg,4096,2022-08-09T10:11:12Z,2022-08-09T10:11:12Z,duplicates,,/home/user/backup/beach.jpg,false,,true
+`
+	if buf.String() != expected {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), expected)
+	}
+}
+
+func TestWriteReport_UnsupportedFormat(t *testing.T) {
+	err := WriteReport(&bytes.Buffer{}, reportFiles, "xml")
+	if err == nil {
+		t.Error("expected an error for unsupported format")
+	}
+}
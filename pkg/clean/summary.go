@@ -0,0 +1,86 @@
+package clean
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// outsideRoot is the directory name used for files that aren't located under the analyzed root, e.g. Steam games.
+const outsideRoot = "(outside root)"
+
+// Group is the number of files and the total size of a group of cleanable files.
+type Group struct {
+	Name  string
+	Count int
+	Size  int64
+}
+
+// Summary answers how much space would be reclaimed by removing all cleanable files.
+type Summary struct {
+	Total       Group
+	Analyzers   []Group // Analyzers groups the files by the analyzer that found them.
+	Categories  []Group // Categories groups the clutter files by their category in clutter_folders.json.
+	Directories []Group // Directories groups the files by the top-level directory under root that they are located in.
+}
+
+// Summarize groups the files by analyzer, clutter category and top-level directory under root.
+// The groups are sorted by size in descending order.
+func Summarize(root string, files []CleanableFile) Summary {
+	analyzers := make(map[string]*Group)
+	categories := make(map[string]*Group)
+	directories := make(map[string]*Group)
+	summary := Summary{Total: Group{Name: "Total"}}
+
+	for _, file := range files {
+		summary.Total.add(file)
+		addToGroup(analyzers, file.Analyzer, file)
+		if file.Category != "" {
+			addToGroup(categories, file.Category, file)
+		}
+		addToGroup(directories, topLevelDir(root, file.Path), file)
+	}
+
+	summary.Analyzers = sortedGroups(analyzers)
+	summary.Categories = sortedGroups(categories)
+	summary.Directories = sortedGroups(directories)
+	return summary
+}
+
+func (g *Group) add(file CleanableFile) {
+	g.Count++
+	g.Size += file.Size
+}
+
+func addToGroup(groups map[string]*Group, name string, file CleanableFile) {
+	group, ok := groups[name]
+	if !ok {
+		group = &Group{Name: name}
+		groups[name] = group
+	}
+	group.add(file)
+}
+
+func sortedGroups(groups map[string]*Group) []Group {
+	result := make([]Group, 0, len(groups))
+	for _, group := range groups {
+		result = append(result, *group)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Size == result[j].Size {
+			return result[i].Name < result[j].Name
+		}
+		return result[i].Size > result[j].Size
+	})
+	return result
+}
+
+// topLevelDir returns the first path element of path relative to root.
+func topLevelDir(root, path string) string {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return outsideRoot
+	}
+	first, _, _ := strings.Cut(rel, string(filepath.Separator))
+	return first
+}
@@ -0,0 +1,73 @@
+package clean
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSummarize(t *testing.T) {
+	root := filepath.FromSlash("/home/user")
+	files := []CleanableFile{
+		{Path: filepath.FromSlash("/home/user/src/app/node_modules"), Size: 100, Analyzer: AnalyzerClutter, Category: "javascript"},
+		{Path: filepath.FromSlash("/home/user/src/web/node_modules"), Size: 200, Analyzer: AnalyzerClutter, Category: "javascript"},
+		{Path: filepath.FromSlash("/home/user/go/pkg/mod"), Size: 50, Analyzer: AnalyzerClutter, Category: "golang"},
+		{Path: filepath.FromSlash("/home/user/Videos/Movie"), Size: 1000, Analyzer: AnalyzerMedia},
+		{Path: filepath.FromSlash("/games/common/Game"), Size: 500, Analyzer: AnalyzerGames},
+	}
+
+	summary := Summarize(root, files)
+
+	if summary.Total.Count != 5 || summary.Total.Size != 1850 {
+		t.Errorf("unexpected total: %+v", summary.Total)
+	}
+	expectGroups(t, "analyzers", summary.Analyzers, []Group{
+		{Name: AnalyzerMedia, Count: 1, Size: 1000},
+		{Name: AnalyzerGames, Count: 1, Size: 500},
+		{Name: AnalyzerClutter, Count: 3, Size: 350},
+	})
+	expectGroups(t, "categories", summary.Categories, []Group{
+		{Name: "javascript", Count: 2, Size: 300},
+		{Name: "golang", Count: 1, Size: 50},
+	})
+	expectGroups(t, "directories", summary.Directories, []Group{
+		{Name: "Videos", Count: 1, Size: 1000},
+		{Name: outsideRoot, Count: 1, Size: 500},
+		{Name: "src", Count: 2, Size: 300},
+		{Name: "go", Count: 1, Size: 50},
+	})
+}
+
+func expectGroups(t *testing.T, name string, got, expected []Group) {
+	t.Helper()
+	if len(got) != len(expected) {
+		t.Fatalf("%s: got %+v, want %+v", name, got, expected)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("%s[%d]: got %+v, want %+v", name, i, got[i], expected[i])
+		}
+	}
+}
+
+func TestTopLevelDir(t *testing.T) {
+	tests := []struct {
+		root     string
+		path     string
+		expected string
+	}{
+		{"/home/user", "/home/user/src/app", "src"},
+		{"/home/user", "/home/user/src", "src"},
+		{"/home/user/", "/home/user/src/app", "src"},
+		{"/home/user", "/games/common/Game", outsideRoot},
+		{"/home/user", "/home/username/src", outsideRoot},
+		{"/", "/home/user", "home"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got := topLevelDir(filepath.FromSlash(tt.root), filepath.FromSlash(tt.path))
+			if got != tt.expected {
+				t.Errorf("topLevelDir(%q, %q) = %q; want %q", tt.root, tt.path, got, tt.expected)
+			}
+		})
+	}
+}
@@ -1,10 +1,11 @@
 package clutter
 
 import (
+	"context"
 	"github.com/sebastianappelberg/disk/pkg/config"
 	"github.com/sebastianappelberg/disk/pkg/storage"
+	"os"
 	"sort"
-	"strings"
 	"sync"
 	"time"
 )
@@ -13,6 +14,20 @@ const (
 	defaultMinSize = 50 * storage.MegaByte
 )
 
+// Clutter is a folder or file that can be removed to free up space.
+type Clutter struct {
+	storage.File
+	// Regenerable is true if the folder can be restored after it's removed. Dependency folders such as node_modules
+	// are only regenerable if there's a lockfile next to them.
+	Regenerable bool
+	// Restore is the command that restores the folder, e.g. "npm ci", if it's known.
+	Restore string
+	// Category is the category of the folder in clutter_folders.json, or "gitignored".
+	Category string
+	// LastUsed is when the folder was last modified or when a file in it was last accessed, see WithAgeMode.
+	LastUsed time.Time
+}
+
 type AnalyzerOption func(*Analyzer)
 
 func WithMinAgeFilter(minAge time.Time) AnalyzerOption {
@@ -29,51 +44,122 @@ func WithSizeFilter(size int) AnalyzerOption {
 	}
 }
 
+// WithProgress makes the analyzer count the directories and bytes it scans in progress.
+func WithProgress(progress *storage.Progress) AnalyzerOption {
+	return func(a *Analyzer) {
+		a.progress = progress
+	}
+}
+
+// WithOneFileSystem makes the analyzer stay on the file system that the root is on.
+func WithOneFileSystem() AnalyzerOption {
+	return func(a *Analyzer) {
+		a.oneFileSystem = true
+	}
+}
+
+// WithUnregenerable makes the analyzer include dependency folders that can't be restored the way they were,
+// since there's no lockfile next to them.
+func WithUnregenerable() AnalyzerOption {
+	return func(a *Analyzer) {
+		a.includeUnregenerable = true
+	}
+}
+
+// WithGit makes the analyzer suggest the folders that git ignores, as long as there's nothing tracked in them.
+// Nothing that's tracked by git is suggested, not even the usual clutter.
+func WithGit() AnalyzerOption {
+	return func(a *Analyzer) {
+		a.repos = &gitRepos{}
+	}
+}
+
+// WithAgeMode decides whether the age filter applies to when the folders were modified, when the files in them were
+// last accessed or whichever is the most recent.
+func WithAgeMode(mode storage.AgeMode) AnalyzerOption {
+	return func(a *Analyzer) {
+		a.ageMode = mode
+	}
+}
+
+// WithSizeMode decides whether the size filter applies to the allocated or the apparent size of the folders.
+func WithSizeMode(mode storage.SizeMode) AnalyzerOption {
+	return func(a *Analyzer) {
+		a.sizeMode = mode
+	}
+}
+
 type Analyzer struct {
-	walker         *storage.FileWalker[storage.File]
-	sizeCalculator *storage.SizeCalculator
-	minSize        int64
-	minAge         time.Time
+	walker               *storage.FileWalker[Clutter]
+	sizeCalculator       *storage.SizeCalculator
+	progress             *storage.Progress
+	oneFileSystem        bool
+	includeUnregenerable bool
+	// repos is only set in git mode.
+	repos    *gitRepos
+	minSize  int64
+	sizeMode storage.SizeMode
+	minAge   time.Time
+	ageMode  storage.AgeMode
 }
 
 func NewAnalyzer(options ...AnalyzerOption) *Analyzer {
 	defaultMinAge := time.Now().AddDate(0, 0, -90)
 	sizeAnalyzer := &Analyzer{
-		walker: storage.NewFileWalker[storage.File](
-			storage.WithMapper(storage.IdentityMapper),
-			storage.WithDecisionFilter[storage.File](decisionFilter),
-		),
-		sizeCalculator: storage.NewSizeCalculator(),
-		minSize:        defaultMinSize,
-		minAge:         defaultMinAge,
+		minSize: defaultMinSize,
+		minAge:  defaultMinAge,
 	}
 	for _, option := range options {
 		option(sizeAnalyzer)
 	}
+	filter := decisionFilter
+	if sizeAnalyzer.repos != nil {
+		filter = sizeAnalyzer.gitDecisionFilter
+	}
+	walkerOptions := []storage.FileWalkerOption[Clutter]{
+		storage.WithMapper(clutterMapper),
+		storage.WithDecisionFilter[Clutter](filter),
+		storage.WithProgress[Clutter](sizeAnalyzer.progress),
+	}
+	var sizeWalkerOptions []storage.FileWalkerOption[storage.File]
+	if sizeAnalyzer.oneFileSystem {
+		walkerOptions = append(walkerOptions, storage.WithOneFileSystem[Clutter]())
+		sizeWalkerOptions = append(sizeWalkerOptions, storage.WithOneFileSystem[storage.File]())
+	}
+	sizeAnalyzer.walker = storage.NewFileWalker[Clutter](walkerOptions...)
+	sizeAnalyzer.sizeCalculator = storage.NewSizeCalculator(
+		storage.WithSizeProgress(sizeAnalyzer.progress),
+		storage.WithWalkerOptions(sizeWalkerOptions...),
+	)
 	return sizeAnalyzer
 }
 
-func decisionFilter(file storage.File) storage.FilterDecision {
-	fileName := strings.ToLower(file.Name)
-	if config.ClutterFolders[fileName] {
+func decisionFilter(file storage.File, siblings []os.DirEntry) storage.FilterDecision {
+	if _, ok := config.ClutterPatterns.Match(file.Base, file.Name, file.IsDir, siblings); ok {
 		return storage.Include | storage.Skip
 	}
-	if config.UnsafeFolders[fileName] {
+	if _, ok := config.UnsafePatterns.Match(file.Base, file.Name, file.IsDir, siblings); ok {
 		return storage.Skip
 	}
 	return storage.Continue
 }
 
+func clutterMapper(file storage.File, siblings []os.DirEntry) Clutter {
+	category, ok := config.ClutterPatterns.Match(file.Base, file.Name, file.IsDir, siblings)
+	if !ok {
+		// Only the git filter includes folders that don't match the patterns. Being ignored by git says nothing
+		// about whether they can be recreated, so they aren't regenerable.
+		return Clutter{File: file, Category: GitIgnoredCategory}
+	}
+	regenerable, restore := regeneration(file.Name, siblings)
+	return Clutter{File: file, Regenerable: regenerable, Restore: restore, Category: category}
+}
+
 // Analyze returns a sorted list of candidates to delete.
-func (a *Analyzer) Analyze(root string) []storage.File {
-	foldersCh := a.walker.GetFiles(root)
-	sizeCh := a.calculateFolderSizes(foldersCh)
-
-	var files []storage.File
-	for file := range sizeCh {
-		if file.Size >= a.minSize && file.ModTime.Before(a.minAge) {
-			files = append(files, file)
-		}
+func (a *Analyzer) Analyze(ctx context.Context, root string) []Clutter {
+	var files []Clutter
+	for file := range a.Stream(ctx, root) {
+		files = append(files, file)
 	}
 	// Path feels the most intuitive when reading through a list.
 	sort.Slice(files, func(i, j int) bool {
@@ -82,22 +168,62 @@ func (a *Analyzer) Analyze(root string) []storage.File {
 	return files
 }
 
-func (a *Analyzer) calculateFolderSizes(files <-chan storage.File) <-chan storage.File {
-	var wg sync.WaitGroup
-	ch := make(chan storage.File, 200)
-
-	for file := range files {
-		wg.Add(1)
-		go func(f storage.File) {
-			defer wg.Done()
-			if f.IsDir {
-				f.Size = a.sizeCalculator.GetSize(f.GetPath())
-			}
-			ch <- f
-		}(file)
+// Stream sends the candidates to delete on the returned channel as soon as their size is known.
+// The channel is closed when the analysis is done or ctx is cancelled.
+func (a *Analyzer) Stream(ctx context.Context, root string) <-chan Clutter {
+	if a.repos != nil {
+		a.repos.prepare(root)
 	}
+	foldersCh := a.walker.GetFiles(ctx, root)
+	sizeCh := a.calculateFolderSizes(ctx, foldersCh)
 
+	ch := make(chan Clutter)
 	go func() {
+		defer close(ch)
+		for file := range sizeCh {
+			if file.Usage().Size(a.sizeMode) >= a.minSize && file.LastUsed.Before(a.minAge) {
+				select {
+				case ch <- file:
+				case <-ctx.Done():
+				}
+			}
+		}
+	}()
+	return ch
+}
+
+func (a *Analyzer) calculateFolderSizes(ctx context.Context, files <-chan Clutter) <-chan Clutter {
+	var wg sync.WaitGroup
+	ch := make(chan Clutter, 200)
+
+	go func() {
+		for file := range files {
+			if !file.Regenerable && file.Category != GitIgnoredCategory && !a.includeUnregenerable {
+				// There's no point in calculating the size of what won't be suggested. Ignored folders are
+				// suggested either way, since git mode is what asked for them.
+				continue
+			}
+			wg.Add(1)
+			go func(f Clutter) {
+				defer wg.Done()
+				accessTime := f.AccessTime
+				if f.IsDir {
+					var size storage.Usage
+					if a.ageMode == storage.ModTimeAge {
+						size = a.sizeCalculator.GetSize(ctx, f.GetPath())
+					} else {
+						// The access time of the folder itself only tells when it was last listed.
+						size, accessTime = a.sizeCalculator.GetSizeAndAccessTime(ctx, f.GetPath())
+					}
+					f.Size, f.Allocated = size.Apparent, size.Allocated
+				}
+				f.LastUsed = a.ageMode.LastUsed(f.ModTime, accessTime)
+				select {
+				case ch <- f:
+				case <-ctx.Done():
+				}
+			}(file)
+		}
 		wg.Wait()
 		a.sizeCalculator.Close()
 		close(ch)
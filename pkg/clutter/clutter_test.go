@@ -1,10 +1,22 @@
 package clutter
 
 import (
+	"context"
+	"github.com/sebastianappelberg/disk/internal/testutil"
+	"github.com/sebastianappelberg/disk/pkg/config"
+	"github.com/sebastianappelberg/disk/pkg/storage"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
 	"testing"
 	"time"
 )
 
+func TestMain(m *testing.M) {
+	testutil.Main(m, config.SetAppDir)
+}
+
 func BenchmarkAnalyze(b *testing.B) {
 	minAge := time.Now().AddDate(0, 0, -90)
 	clutterAnalyzer := NewAnalyzer(
@@ -13,9 +25,181 @@ func BenchmarkAnalyze(b *testing.B) {
 	)
 	counter := int64(0)
 	for i := 0; i < b.N; i++ {
-		files := clutterAnalyzer.Analyze("C:\\Users\\sebastian\\src")
+		files := clutterAnalyzer.Analyze(context.Background(), "C:\\Users\\sebastian\\src")
 		for _, file := range files {
 			counter += file.Size
 		}
 	}
 }
+
+func TestAnalyzeMarkers(t *testing.T) {
+	root := t.TempDir()
+	for _, path := range []string{
+		"web/package.json", "web/package-lock.json", "web/node_modules/left-pad/index.js",
+		"scratch/package.json", "scratch/node_modules/left-pad/index.js",
+		"rust/Cargo.toml", "rust/target/debug/app",
+		"dotnet/App.csproj", "dotnet/bin/App.dll", "dotnet/obj/App.dll",
+		"photos/build/img.jpg", "photos/target/img.jpg",
+		"usr/local/bin/tool",
+		"go/go.mod", "go/go.sum", "go/vendor/modules.txt",
+		"ruby/Gemfile", "ruby/Gemfile.lock", "ruby/vendor/bundle/rake.rb",
+		"docs/vendor/jquery.js",
+	} {
+		testutil.WriteFile(t, filepath.Join(root, path), "content")
+	}
+
+	clutterAnalyzer := NewAnalyzer(WithSizeFilter(0), WithMinAgeFilter(time.Now().Add(time.Hour)))
+	var got []string
+	restore := make(map[string]string)
+	for _, file := range clutterAnalyzer.Analyze(context.Background(), root) {
+		rel, _ := filepath.Rel(root, file.GetPath())
+		got = append(got, filepath.ToSlash(rel))
+		restore[filepath.ToSlash(rel)] = file.Restore
+	}
+	expected := []string{"dotnet/bin", "dotnet/obj", "go/vendor", "ruby/vendor", "rust/target", "web/node_modules"}
+	if !slices.Equal(got, expected) {
+		t.Errorf("Analyze() = %v; want %v", got, expected)
+	}
+	for path, command := range map[string]string{"go/vendor": "go mod vendor", "ruby/vendor": "bundle install"} {
+		if restore[path] != command {
+			t.Errorf("Restore of %s = %q; want %q", path, restore[path], command)
+		}
+	}
+}
+
+func TestAnalyzeAgeMode(t *testing.T) {
+	root := t.TempDir()
+	old := time.Now().AddDate(0, 0, -100)
+	for _, path := range []string{"web/package.json", "web/package-lock.json", "web/node_modules/left-pad/index.js"} {
+		testutil.WriteFile(t, filepath.Join(root, path), "content")
+	}
+	// The dependencies were installed long ago but were read yesterday.
+	yesterday := time.Now().AddDate(0, 0, -1)
+	if err := os.Chtimes(filepath.Join(root, "web/node_modules/left-pad/index.js"), yesterday, old); err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{"web/node_modules/left-pad", "web/node_modules"} {
+		if err := os.Chtimes(filepath.Join(root, dir), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		mode     storage.AgeMode
+		expected int
+	}{
+		{storage.ModTimeAge, 1},
+		{storage.AccessTimeAge, 0},
+		{storage.NewestAge, 0},
+	}
+	for _, test := range tests {
+		clutterAnalyzer := NewAnalyzer(WithSizeFilter(0), WithAgeMode(test.mode))
+		if got := clutterAnalyzer.Analyze(context.Background(), root); len(got) != test.expected {
+			t.Errorf("Analyze() with age mode %d = %v; want %d folders", test.mode, got, test.expected)
+		}
+	}
+}
+
+func TestRegeneration(t *testing.T) {
+	tests := []struct {
+		name        string
+		siblings    []string
+		regenerable bool
+		restore     string
+	}{
+		{"node_modules", []string{"package.json", "package-lock.json"}, true, "npm ci"},
+		{"node_modules", []string{"package.json", "pnpm-lock.yaml"}, true, "pnpm install --frozen-lockfile"},
+		{"node_modules", []string{"package.json"}, false, ""},
+		{".venv", []string{"pyproject.toml", "poetry.lock"}, true, "poetry install"},
+		{"Pods", []string{"Podfile", "Podfile.lock"}, true, "pod install"},
+		{"target", []string{"Cargo.toml"}, true, "cargo build"},
+		{"bin", []string{"App.csproj"}, true, "dotnet build"},
+		{".cache", nil, true, ""},
+	}
+	for _, test := range tests {
+		var siblings []os.DirEntry
+		for _, name := range test.siblings {
+			siblings = append(siblings, dirEntry(name))
+		}
+		regenerable, restore := regeneration(test.name, siblings)
+		if regenerable != test.regenerable || restore != test.restore {
+			t.Errorf("regeneration(%q, %v) = %v, %q; want %v, %q", test.name, test.siblings, regenerable, restore, test.regenerable, test.restore)
+		}
+	}
+}
+
+type dirEntry string
+
+func (e dirEntry) Name() string               { return string(e) }
+func (e dirEntry) IsDir() bool                { return false }
+func (e dirEntry) Type() fs.FileMode          { return 0 }
+func (e dirEntry) Info() (fs.FileInfo, error) { return nil, fs.ErrNotExist }
+
+func TestAnalyzeGit(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		".gitignore":                  "out/\ngenerated/\n*.tmp\n",
+		"src/main.go":                 "package main",
+		"out/app":                     "binary",
+		"generated/tracked.go":        "package generated",
+		"generated/more/untracked.go": "package more",
+		"web/.gitignore":              ".svelte-kit/\n",
+		"web/package.json":            "{}",
+		"web/package-lock.json":       "{}",
+		"web/.svelte-kit/output.js":   "output",
+		"web/node_modules/a/index.js": "module",
+		"php/composer.json":           "{}",
+		"php/composer.lock":           "{}",
+		"php/vendor/lib.php":          "<?php",
+		"notes/todo.txt":              "untracked but not ignored",
+	}
+	for name, content := range files {
+		testutil.WriteFile(t, filepath.Join(root, name), content)
+	}
+	testutil.Git(t, root, "init", "-q")
+	// The vendor folder is committed, so it isn't clutter even though it usually is.
+	testutil.Git(t, root, "add", ".gitignore", "src", "web/.gitignore", "web/package.json", "php")
+	testutil.Git(t, root, "add", "-f", "generated/tracked.go")
+
+	clutterAnalyzer := NewAnalyzer(WithSizeFilter(0), WithMinAgeFilter(time.Now().Add(time.Hour)), WithGit())
+	var got []string
+	for _, dir := range []string{filepath.Join(root, "web"), root} {
+		for _, file := range clutterAnalyzer.Analyze(context.Background(), dir) {
+			rel, _ := filepath.Rel(root, file.GetPath())
+			got = append(got, filepath.ToSlash(rel)+":"+file.Category)
+			// Nothing tells how to recreate a folder just because it's ignored.
+			if file.Category == GitIgnoredCategory && file.Regenerable {
+				t.Errorf("%s is regenerable; want it not to be since it's only ignored by git", rel)
+			}
+		}
+	}
+	expected := []string{
+		"web/.svelte-kit:gitignored", "web/node_modules:javascript",
+		"generated/more:gitignored", "out:gitignored", "web/.svelte-kit:gitignored", "web/node_modules:javascript",
+	}
+	if !slices.Equal(got, expected) {
+		t.Errorf("Analyze() = %v; want %v", got, expected)
+	}
+}
+
+func TestAnalyzeGitUnreadable(t *testing.T) {
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		"package.json":            "{}",
+		"package-lock.json":       "{}",
+		"node_modules/a/index.js": "module",
+	} {
+		testutil.WriteFile(t, filepath.Join(root, name), content)
+	}
+	testutil.Git(t, root, "init", "-q")
+	testutil.Git(t, root, "add", "-f", ".")
+	testutil.Git(t, root, "update-index", "--split-index")
+
+	// node_modules is committed, which can't be told from the split index, so the repository is left alone.
+	clutterAnalyzer := NewAnalyzer(WithSizeFilter(0), WithMinAgeFilter(time.Now().Add(time.Hour)), WithGit())
+	for _, dir := range []string{root, filepath.Dir(root)} {
+		if files := clutterAnalyzer.Analyze(context.Background(), dir); len(files) > 0 {
+			t.Errorf("Analyze(%q) = %v; want nothing from a repository with a split index", dir, files)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package clutter
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sebastianappelberg/disk/pkg/config"
+	"github.com/sebastianappelberg/disk/pkg/git"
+	"github.com/sebastianappelberg/disk/pkg/storage"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+)
+
+// GitIgnoredCategory is the category of the folders that are only clutter because git ignores them.
+const GitIgnoredCategory = "gitignored"
+
+// errUnreadableRepo is returned for the folders in repositories that can't be read, e.g. because of an index
+// that isn't supported. Nothing in them is suggested since there's no telling what's tracked.
+var errUnreadableRepo = errors.New("unreadable git repository")
+
+// gitRepos keeps track of the repositories that the walker comes across so that the index and the ignore files
+// are only read once.
+type gitRepos struct {
+	// folders maps the roots of repositories and the folders with a .gitignore to their gitFolder. The roots of walks
+	// that aren't in a repository map to nil so that looking up a folder stops there.
+	folders sync.Map
+	// ignoredTracked holds the ignored folders that can't be suggested since there are tracked files in them.
+	// Git ignores everything in them that isn't tracked.
+	ignoredTracked sync.Map
+}
+
+// gitFolder is a folder in a repository along with the ignore patterns that apply to it.
+type gitFolder struct {
+	repo    *git.Repo
+	tracked git.Tracked
+	ignore  *git.Ignore
+	// dir is the folder the way the walker sees it, i.e. relative if the walk is.
+	dir string
+	// rel is the folder relative to the root of the repository and separated by slashes, "" for the root.
+	rel string
+	// err is set when the repository can't be read, none of the other fields are set then.
+	err error
+}
+
+// prepare registers the repository that root is in, if any, since the walker never sees the folders above root.
+func (g *gitRepos) prepare(root string) {
+	root = filepath.Clean(root)
+	if _, ok := g.folders.Load(root); ok {
+		return
+	}
+	var folder *gitFolder
+	if repoRoot, ok := git.FindRoot(root); ok {
+		folder = openGitFolder(repoRoot, root)
+	}
+	g.folders.Store(root, folder)
+}
+
+// openGitFolder reads the repository at repoRoot along with the ignore files down to dir. The folder holds
+// errUnreadableRepo if any of it can't be read.
+func openGitFolder(repoRoot string, dir string) *gitFolder {
+	unreadable := func(err error) *gitFolder {
+		return &gitFolder{dir: dir, err: fmt.Errorf("%w %s: %w", errUnreadableRepo, repoRoot, err)}
+	}
+	repo, err := git.Open(repoRoot)
+	if errors.Is(err, git.ErrNotRepo) {
+		return nil
+	}
+	if err != nil {
+		return unreadable(err)
+	}
+	entries, err := repo.Index()
+	if err != nil {
+		// Without the index there's no telling what's tracked, so nothing in the repository is suggested.
+		return unreadable(err)
+	}
+	ignore, err := repo.RootIgnore()
+	if err != nil {
+		return unreadable(err)
+	}
+	folder := &gitFolder{repo: repo, tracked: git.NewTracked(entries), ignore: ignore, dir: dir}
+	if abs, err := filepath.Abs(dir); err == nil {
+		if rel, err := filepath.Rel(repoRoot, abs); err == nil && rel != "." {
+			folder.rel = filepath.ToSlash(rel)
+		}
+	}
+	var current string
+	for _, part := range splitSlash(folder.rel) {
+		current = path.Join(current, part)
+		if folder.ignore, err = folder.ignore.Nested(repoRoot, current); err != nil {
+			return unreadable(err)
+		}
+	}
+	return folder
+}
+
+func splitSlash(rel string) []string {
+	if rel == "" {
+		return nil
+	}
+	var parts []string
+	for dir := rel; dir != "."; dir = path.Dir(dir) {
+		parts = append([]string{path.Base(dir)}, parts...)
+	}
+	return parts
+}
+
+// lookup returns the repository folder that the files in dir belong to, or nil if dir isn't in a repository.
+// siblings are the entries in dir, a .git or .gitignore among them is read the first time dir is looked up.
+// The error wraps errUnreadableRepo if dir is in a repository that can't be read.
+func (g *gitRepos) lookup(dir string, siblings []os.DirEntry) (*gitFolder, error) {
+	folder := g.lookupFolder(dir, siblings)
+	if folder != nil && folder.err != nil {
+		return nil, folder.err
+	}
+	return folder, nil
+}
+
+func (g *gitRepos) lookupFolder(dir string, siblings []os.DirEntry) *gitFolder {
+	dir = filepath.Clean(dir)
+	if folder, ok := g.folders.Load(dir); ok {
+		return folder.(*gitFolder)
+	}
+	var hasGit, hasIgnore bool
+	for _, sibling := range siblings {
+		switch sibling.Name() {
+		case ".git":
+			hasGit = true
+		case ".gitignore":
+			hasIgnore = true
+		}
+	}
+	if hasGit {
+		folder, _ := g.folders.LoadOrStore(dir, openGitFolder(dir, dir))
+		return folder.(*gitFolder)
+	}
+	parent := g.nearest(filepath.Dir(dir))
+	if parent == nil || parent.err != nil || !hasIgnore {
+		return parent
+	}
+	rel := parent.relOf(dir)
+	ignore, err := parent.ignore.Nested(parent.repo.Root, rel)
+	if err != nil {
+		return parent
+	}
+	folder, _ := g.folders.LoadOrStore(dir, &gitFolder{repo: parent.repo, tracked: parent.tracked, ignore: ignore, dir: dir, rel: rel})
+	return folder.(*gitFolder)
+}
+
+// nearest returns the registered folder that's closest to dir, going up.
+func (g *gitRepos) nearest(dir string) *gitFolder {
+	for {
+		if folder, ok := g.folders.Load(dir); ok {
+			return folder.(*gitFolder)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil
+		}
+		dir = parent
+	}
+}
+
+// relOf returns p relative to the root of the repository, separated by slashes.
+func (f *gitFolder) relOf(p string) string {
+	rel, err := filepath.Rel(f.dir, p)
+	if err != nil {
+		return ""
+	}
+	return path.Join(f.rel, filepath.ToSlash(rel))
+}
+
+// gitDecisionFilter includes the folders that git ignores, as well as the usual clutter, as long as there's nothing
+// tracked in them. Outside of repositories it's the same as decisionFilter, and repositories that can't be read are
+// skipped altogether.
+func (a *Analyzer) gitDecisionFilter(file storage.File, siblings []os.DirEntry) storage.FilterDecision {
+	if _, ok := config.UnsafePatterns.Match(file.Base, file.Name, file.IsDir, siblings); ok {
+		return storage.Skip
+	}
+	folder, err := a.repos.lookup(file.Base, siblings)
+	if err != nil {
+		return storage.Skip
+	}
+	if folder == nil {
+		return decisionFilter(file, siblings)
+	}
+	rel := folder.relOf(file.GetPath())
+	_, ignored := a.repos.ignoredTracked.Load(filepath.Clean(file.Base))
+	ignored = ignored || file.IsDir && folder.ignore.Ignored(rel, true)
+	if folder.tracked.Contains(rel) {
+		if ignored && file.IsDir {
+			a.repos.ignoredTracked.Store(filepath.Clean(file.GetPath()), true)
+		}
+		// The folder itself is never suggested, but there may be ignored folders inside it.
+		return storage.Continue
+	}
+	if ignored && file.IsDir {
+		return storage.Include | storage.Skip
+	}
+	if _, ok := config.ClutterPatterns.Match(file.Base, file.Name, file.IsDir, siblings); ok {
+		return storage.Include | storage.Skip
+	}
+	return storage.Continue
+}
@@ -0,0 +1,104 @@
+package clutter
+
+import (
+	"os"
+	"strings"
+)
+
+// restoreRule is a file that, when it's next to a clutter folder, tells how to restore the folder.
+type restoreRule struct {
+	file    string
+	command string
+}
+
+// dependencyFolders are the folders that hold the dependencies of a project. They can only be restored as they were
+// if the versions are locked, so they're only regenerable when one of the lockfiles is next to them.
+var dependencyFolders = map[string][]restoreRule{
+	"node_modules": {
+		{"package-lock.json", "npm ci"},
+		{"npm-shrinkwrap.json", "npm ci"},
+		{"yarn.lock", "yarn install --frozen-lockfile"},
+		{"pnpm-lock.yaml", "pnpm install --frozen-lockfile"},
+		{"bun.lockb", "bun install --frozen-lockfile"},
+		{"bun.lock", "bun install --frozen-lockfile"},
+	},
+	"vendor": {
+		{"composer.lock", "composer install"},
+		{"go.sum", "go mod vendor"},
+		{"Gemfile.lock", "bundle install"},
+	},
+	".venv": {
+		{"poetry.lock", "poetry install"},
+		{"uv.lock", "uv sync"},
+		{"Pipfile.lock", "pipenv sync"},
+		{"requirements.txt", "pip install -r requirements.txt"},
+	},
+	"deps": {
+		{"mix.lock", "mix deps.get"},
+	},
+	"pods": {
+		{"Podfile.lock", "pod install"},
+	},
+}
+
+// buildFolders are build outputs and the command that builds them, they're always regenerable.
+var buildFolders = map[string][]restoreRule{
+	"target": {
+		{"Cargo.toml", "cargo build"},
+		{"pom.xml", "mvn package"},
+		{"build.sbt", "sbt compile"},
+	},
+	"bin": {
+		{".csproj", "dotnet build"},
+		{".fsproj", "dotnet build"},
+		{".vbproj", "dotnet build"},
+		{".sln", "dotnet build"},
+	},
+	"obj": {
+		{".csproj", "dotnet restore"},
+		{".fsproj", "dotnet restore"},
+		{".vbproj", "dotnet restore"},
+		{".sln", "dotnet restore"},
+	},
+	"_build": {
+		{"mix.exs", "mix compile"},
+	},
+	".stack-work": {
+		{"stack.yaml", "stack build"},
+	},
+	"dist-newstyle": {
+		{"cabal.project", "cabal build"},
+		{".cabal", "cabal build"},
+	},
+	".gradle": {
+		{"build.gradle", "gradle build"},
+		{"build.gradle.kts", "gradle build"},
+	},
+}
+
+// regeneration tells whether the clutter folder called name can be restored after it's removed, and the command
+// that restores it if it's known. siblings are the files next to the folder.
+func regeneration(name string, siblings []os.DirEntry) (bool, string) {
+	name = strings.ToLower(name)
+	if rules, ok := dependencyFolders[name]; ok {
+		command, found := findRestoreCommand(rules, siblings)
+		return found, command
+	}
+	command, _ := findRestoreCommand(buildFolders[name], siblings)
+	// Caches and build outputs are recreated when they're needed again.
+	return true, command
+}
+
+// findRestoreCommand returns the command of the first rule whose file is among siblings. A file that starts
+// with a dot, like ".csproj", matches the extension.
+func findRestoreCommand(rules []restoreRule, siblings []os.DirEntry) (string, bool) {
+	for _, rule := range rules {
+		for _, sibling := range siblings {
+			if strings.HasPrefix(rule.file, ".") && strings.HasSuffix(strings.ToLower(sibling.Name()), rule.file) ||
+				strings.EqualFold(sibling.Name(), rule.file) {
+				return rule.command, true
+			}
+		}
+	}
+	return "", false
+}
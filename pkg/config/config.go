@@ -32,3 +32,9 @@ func setAppDir() {
 func GetAppDir() string {
 	return appDir
 }
+
+// SetAppDir makes dir the app dir in place of the one from DISK_DIR or the home directory. It has to be called
+// before anything is read from the app dir, since the caches and the index are only loaded once.
+func SetAppDir(dir string) {
+	appDir = dir
+}
@@ -1,9 +1,135 @@
 package config
 
-import "testing"
+import (
+	"fmt"
+	"github.com/sebastianappelberg/disk/internal/testutil"
+	"github.com/sebastianappelberg/disk/pkg/cache"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
 
 func BenchmarkGetAppDir(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		_ = GetAppDir()
 	}
 }
+
+func TestClutterCategories(t *testing.T) {
+	tests := map[string]string{
+		"node_modules": "javascript",
+		"mod":          "golang",
+		"obj":          "csharp",
+		"__pycache__":  "python",
+	}
+	for folder, expected := range tests {
+		if got, _ := ClutterPatterns.Match("", folder, true, nil); got != expected {
+			t.Errorf("ClutterPatterns.Match(%q) = %q; want %q", folder, got, expected)
+		}
+	}
+}
+
+func TestApplyFolderChanges(t *testing.T) {
+	config := map[string]configItem{
+		"javascript": {Folders: []string{"node_modules", ".next"}},
+		"python":     {Folders: []string{"__pycache__"}},
+		"golang":     {Folders: []string{"mod"}},
+	}
+	applyFolderChanges(config, FolderChanges{
+		Add:              map[string][]string{"javascript": {".Turbo", "node_modules"}, "zig": {"zig-cache"}},
+		Remove:           []string{".NEXT"},
+		RemoveCategories: []string{"golang"},
+	}, strings.ToLower)
+
+	expected := map[string][]string{
+		"javascript": {"node_modules", ".turbo"},
+		"python":     {"__pycache__"},
+		"zig":        {"zig-cache"},
+	}
+	if len(config) != len(expected) {
+		t.Errorf("applyFolderChanges() left %d categories; want %d", len(config), len(expected))
+	}
+	for category, folders := range expected {
+		if got := config[category].Folders; !slices.Equal(got, folders) {
+			t.Errorf("config[%q].Folders = %v; want %v", category, got, folders)
+		}
+	}
+}
+
+func TestLoadUserConfig(t *testing.T) {
+	previousAppDir, previousClutter, previousUnsafe := appDir, clutterConfig, unsafeConfig
+	t.Cleanup(func() {
+		appDir, clutterConfig, unsafeConfig = previousAppDir, previousClutter, previousUnsafe
+		_ = setFolders()
+	})
+	clutterConfig = mustParseFolderConfig(clutterFoldersJSON)
+	unsafeConfig = mustParseFolderConfig(unsafeFoldersJSON)
+	appDir = t.TempDir()
+	project := t.TempDir()
+	dir := filepath.Join(project, "src", "app")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	testutil.WriteFile(t, filepath.Join(appDir, userConfigName),
+		`{"clutterFolders": {"add": {"elm": ["elm-stuff"]}}, "flags": {"min-size": 100, "min-age": 30}}`)
+	testutil.WriteFile(t, filepath.Join(project, projectConfigName),
+		`{"clutterFolders": {"remove": ["node_modules"]}, "flags": {"min-size": 1000000}}`)
+
+	flags, paths, err := LoadUserConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 2 {
+		t.Errorf("LoadUserConfig(%q) loaded %v; want both configs", dir, paths)
+	}
+	for name, expected := range map[string]string{"min-size": "1000000", "min-age": "30"} {
+		if got := fmt.Sprint(flags[name]); got != expected {
+			t.Errorf("flags[%q] = %s; want %s", name, got, expected)
+		}
+	}
+	if category, _ := ClutterPatterns.Match(dir, "elm-stuff", true, nil); category != "elm" {
+		t.Errorf("ClutterPatterns.Match(\"elm-stuff\") = %q; want \"elm\"", category)
+	}
+	if _, ok := ClutterPatterns.Match(dir, "node_modules", true, nil); ok {
+		t.Error("ClutterPatterns.Match(\"node_modules\") = true; want it removed by the .diskrc")
+	}
+
+	testutil.WriteFile(t, filepath.Join(project, projectConfigName), `{"clutterFolder": {}}`)
+	if _, _, err := LoadUserConfig(dir); err == nil {
+		t.Error("LoadUserConfig() with an unknown field = nil; want an error")
+	}
+}
+
+func TestExcludeFolderConcurrently(t *testing.T) {
+	previousCache, previousFolders := excludedFoldersCache, UserExcludedFolders
+	t.Cleanup(func() {
+		excludedFoldersCache, UserExcludedFolders = previousCache, previousFolders
+	})
+	dir := t.TempDir()
+	legacy := cache.NewCache[FolderSet](dir, legacyConfigName)
+	legacy.Put(legacyExcludedFoldersKey, FolderSet{"/legacy": true})
+	if err := legacy.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	loadExcludedFolders(dir)
+	// Another process that was started at the same time excludes a folder of its own.
+	other := cache.NewCache[bool](dir, excludedFoldersName)
+
+	ExcludeFolder("/first")
+	other.Put("/second", true)
+	if err := other.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	loadExcludedFolders(dir)
+	for _, path := range []string{"/legacy", "/first", "/second"} {
+		if !IsExcluded(path) {
+			t.Errorf("IsExcluded(%q) = false; want true", path)
+		}
+	}
+	if _, ok := cache.NewCache[FolderSet](dir, legacyConfigName).Get(legacyExcludedFoldersKey); ok {
+		t.Error("the excluded folders are still stored the old way after they were moved")
+	}
+}
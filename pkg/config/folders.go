@@ -4,6 +4,8 @@ import (
 	_ "embed"
 	"encoding/json"
 	"github.com/sebastianappelberg/disk/pkg/cache"
+	"log"
+	"sync"
 )
 
 type FolderSet map[string]bool
@@ -11,6 +13,10 @@ type FolderSet map[string]bool
 type configItem struct {
 	Description string   `json:"description"`
 	Folders     []string `json:"folders"`
+	// Markers maps folders to the files that have to be next to them for the folder to match, e.g. a package.json
+	// next to node_modules. One of the markers is enough, they're globs like "*.csproj". Folders that share the same
+	// markers are listed in a single comma-separated key, e.g. "dist,out,build".
+	Markers map[string][]string `json:"markers"`
 }
 
 var (
@@ -20,12 +26,26 @@ var (
 	//go:embed unsafe_folders.json
 	unsafeFoldersJSON []byte
 
-	ClutterFolders      FolderSet
-	UnsafeFolders       FolderSet
+	// ClutterPatterns and UnsafePatterns match the entries of the folder lists, including globs and paths.
+	ClutterPatterns     *Patterns
+	UnsafePatterns      *Patterns
 	UserExcludedFolders FolderSet
-	configCache         *cache.Cache[FolderSet]
+	// clutterConfig and unsafeConfig are the embedded folder lists with the changes from the user config applied.
+	clutterConfig map[string]configItem
+	unsafeConfig  map[string]configItem
+	// userExcludedFoldersMu guards UserExcludedFolders since folders can be excluded while an analysis is running.
+	userExcludedFoldersMu sync.RWMutex
+	// excludedFoldersCache has a key for every excluded folder, so that processes that exclude folders at the same
+	// time don't overwrite each other's exclusions when they're flushed.
+	excludedFoldersCache *cache.Cache[bool]
+)
 
-	userExcludedFoldersKey = "excludedFolders"
+const (
+	excludedFoldersName = "excluded_folders"
+	// legacyConfigName and legacyExcludedFoldersKey are where all the excluded folders used to be stored under a
+	// single key.
+	legacyConfigName         = "user_config"
+	legacyExcludedFoldersKey = "excludedFolders"
 )
 
 func init() {
@@ -33,20 +53,63 @@ func init() {
 }
 
 func setConfig() {
-	ClutterFolders = mustGetFolderConfig(clutterFoldersJSON)
-	UnsafeFolders = mustGetFolderConfig(unsafeFoldersJSON)
-	configCache = cache.NewCache[FolderSet](GetAppDir(), "user_config")
-	if folderSet, ok := configCache.Get(userExcludedFoldersKey); ok {
-		UserExcludedFolders = folderSet
-	} else {
-		UserExcludedFolders = make(map[string]bool)
+	clutterConfig = mustParseFolderConfig(clutterFoldersJSON)
+	unsafeConfig = mustParseFolderConfig(unsafeFoldersJSON)
+	setFolders()
+	loadExcludedFolders(GetAppDir())
+}
+
+// loadExcludedFolders loads the folders that the user has excluded from dir, moving the ones that are still
+// stored the old way over to excludedFoldersCache.
+func loadExcludedFolders(dir string) {
+	excludedFoldersCache = cache.NewCache[bool](dir, excludedFoldersName)
+	legacy := cache.NewCache[FolderSet](dir, legacyConfigName)
+	if folderSet, ok := legacy.Get(legacyExcludedFoldersKey); ok {
+		for path := range folderSet {
+			excludedFoldersCache.Put(path, true)
+		}
+		if excludedFoldersCache.Flush() == nil {
+			legacy.Delete(legacyExcludedFoldersKey)
+			_ = legacy.Flush()
+		}
 	}
+	UserExcludedFolders = make(FolderSet)
+	excludedFoldersCache.Range(func(path string, _ bool) bool {
+		UserExcludedFolders[path] = true
+		return true
+	})
+}
+
+// setFolders builds the patterns from clutterConfig and unsafeConfig.
+func setFolders() error {
+	clutterPatterns, err := compilePatterns(clutterConfig)
+	if err != nil {
+		return err
+	}
+	unsafePatterns, err := compilePatterns(unsafeConfig)
+	if err != nil {
+		return err
+	}
+	ClutterPatterns, UnsafePatterns = clutterPatterns, unsafePatterns
+	return nil
+}
+
+// IsExcluded reports whether the user has excluded the folder.
+func IsExcluded(path string) bool {
+	userExcludedFoldersMu.RLock()
+	defer userExcludedFoldersMu.RUnlock()
+	return UserExcludedFolders[path]
 }
 
 func ExcludeFolder(path string) {
+	userExcludedFoldersMu.Lock()
+	defer userExcludedFoldersMu.Unlock()
 	UserExcludedFolders[path] = true
-	configCache.Put(userExcludedFoldersKey, UserExcludedFolders)
-	configCache.Flush()
+	excludedFoldersCache.Put(path, true)
+	err := excludedFoldersCache.Flush()
+	if err != nil {
+		log.Printf("Could not save the excluded folder %s: %v", path, err)
+	}
 }
 
 // Load JSON configuration
@@ -59,20 +122,10 @@ func parseFolderConfig(data []byte) (map[string]configItem, error) {
 	return config, nil
 }
 
-func getFolderSet(config map[string]configItem) FolderSet {
-	folders := make(FolderSet)
-	for _, category := range config {
-		for _, folder := range category.Folders {
-			folders[folder] = true
-		}
-	}
-	return folders
-}
-
-func mustGetFolderConfig(data []byte) FolderSet {
+func mustParseFolderConfig(data []byte) map[string]configItem {
 	parsed, err := parseFolderConfig(data)
 	if err != nil {
 		panic(err)
 	}
-	return getFolderSet(parsed)
+	return parsed
 }
@@ -0,0 +1,218 @@
+package config
+
+import (
+	"fmt"
+	"github.com/sebastianappelberg/disk/pkg/util"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Patterns matches files against the entries of a folder list. An entry is either the name of a folder, e.g.
+// "node_modules", or a gitignore-style pattern:
+//
+//   - "*.egg-info" matches names with a glob, see path.Match for the syntax.
+//   - "**/.terraform/providers" matches the end of the path, "**" matches any number of folders.
+//   - "/var/cache/*" and "~/.cache/*" are anchored to the root of the file system and the home folder.
+//   - "out/" only matches directories.
+//   - "target if Cargo.toml,pom.xml" only matches when one of the given files is next to it, the markers are globs as well.
+//
+// Patterns are matched case-insensitively.
+type Patterns struct {
+	// byName holds the patterns that end with a literal name, which are most of them, so a lookup is all it takes
+	// to rule them out.
+	byName map[string][]*pattern
+	// globs holds the patterns that end with a glob, they're matched against every file.
+	globs []*pattern
+}
+
+type pattern struct {
+	category string
+	// segments are the parts of the pattern split by "/". Anchored patterns start with an empty segment or a volume name.
+	segments []string
+	anchored bool
+	dirOnly  bool
+	markers  []string
+}
+
+// compilePatterns compiles the entries of config. The categories are sorted so that the same category wins
+// every time when an entry is in more than one of them.
+func compilePatterns(config map[string]configItem) (*Patterns, error) {
+	patterns := &Patterns{byName: make(map[string][]*pattern)}
+	categories := make([]string, 0, len(config))
+	for category := range config {
+		categories = append(categories, category)
+	}
+	slices.Sort(categories)
+	for _, category := range categories {
+		markers := make(map[string][]string)
+		for folders, folderMarkers := range config[category].Markers {
+			for _, folder := range strings.Split(folders, ",") {
+				folder = strings.ToLower(strings.TrimSpace(folder))
+				markers[folder] = append(markers[folder], folderMarkers...)
+			}
+		}
+		for _, entry := range config[category].Folders {
+			if folderMarkers, ok := markers[strings.ToLower(patternName(entry))]; ok {
+				entry = withMarkers(entry, folderMarkers)
+			}
+			p, err := parsePattern(category, entry)
+			if err != nil {
+				return nil, err
+			}
+			if p == nil {
+				continue
+			}
+			last := p.segments[len(p.segments)-1]
+			if isLiteral(last) {
+				patterns.byName[last] = append(patterns.byName[last], p)
+			} else {
+				patterns.globs = append(patterns.globs, p)
+			}
+		}
+	}
+	return patterns, nil
+}
+
+// patternName returns the part of entry before the markers, if any.
+func patternName(entry string) string {
+	name, _, _ := strings.Cut(entry, " if ")
+	return strings.TrimSpace(name)
+}
+
+// withMarkers adds markers to the ones that entry already has.
+func withMarkers(entry string, markers []string) string {
+	if len(markers) == 0 {
+		return entry
+	}
+	if strings.Contains(entry, " if ") {
+		return entry + "," + strings.Join(markers, ",")
+	}
+	return entry + " if " + strings.Join(markers, ",")
+}
+
+func parsePattern(category string, entry string) (*pattern, error) {
+	p := &pattern{category: category}
+	raw := entry
+	entry = strings.ToLower(strings.TrimSpace(entry))
+	if _, markers, ok := strings.Cut(entry, " if "); ok {
+		entry = patternName(entry)
+		for _, marker := range strings.Split(markers, ",") {
+			if marker = strings.TrimSpace(marker); marker != "" {
+				p.markers = append(p.markers, marker)
+			}
+		}
+	}
+	entry = filepath.ToSlash(entry)
+	if strings.HasPrefix(entry, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			// There's nothing for the pattern to match.
+			return nil, nil
+		}
+		entry = strings.ToLower(filepath.ToSlash(home)) + entry[1:]
+	}
+	p.anchored = strings.HasPrefix(entry, "/") || filepath.VolumeName(filepath.FromSlash(entry)) != ""
+	if strings.HasSuffix(entry, "/") {
+		p.dirOnly = true
+		entry = strings.TrimRight(entry, "/")
+	}
+	if entry == "" {
+		return nil, fmt.Errorf("invalid folder pattern %q in %s", raw, category)
+	}
+	p.segments = strings.Split(entry, "/")
+	if !p.anchored && len(p.segments) > 1 && p.segments[0] != "**" {
+		p.segments = append([]string{"**"}, p.segments...)
+	}
+	for _, glob := range append(slices.Clone(p.segments), p.markers...) {
+		if _, err := path.Match(glob, ""); err != nil {
+			return nil, fmt.Errorf("invalid folder pattern %q in %s: %w", raw, category, err)
+		}
+	}
+	return p, nil
+}
+
+func isLiteral(segment string) bool {
+	return !strings.ContainsAny(segment, `*?[\`)
+}
+
+// Match returns the category of the first pattern that matches the file called name in dir.
+// siblings are the entries in dir, they're only looked at by patterns with markers. The markers aren't checked
+// when siblings is nil.
+func (p *Patterns) Match(dir string, name string, isDir bool, siblings []os.DirEntry) (string, bool) {
+	if p == nil {
+		return "", false
+	}
+	m := match{dir: dir, name: strings.ToLower(name), isDir: isDir, siblings: siblings}
+	for _, candidate := range p.byName[m.name] {
+		if m.matches(candidate) {
+			return candidate.category, true
+		}
+	}
+	for _, candidate := range p.globs {
+		if m.matches(candidate) {
+			return candidate.category, true
+		}
+	}
+	return "", false
+}
+
+// match is a single file that's being matched. The path is only split once it's needed.
+type match struct {
+	dir      string
+	name     string
+	isDir    bool
+	siblings []os.DirEntry
+	parts    []string
+	absParts []string
+}
+
+func (m *match) matches(p *pattern) bool {
+	if p.dirOnly && !m.isDir {
+		return false
+	}
+	if len(p.segments) == 1 {
+		if ok, _ := path.Match(p.segments[0], m.name); !ok {
+			return false
+		}
+	} else if !util.MatchSegments(p.segments, m.pathParts(p.anchored)) {
+		return false
+	}
+	return m.siblings == nil || len(p.markers) == 0 || m.hasMarker(p.markers)
+}
+
+func (m *match) pathParts(absolute bool) []string {
+	if absolute {
+		if m.absParts == nil {
+			dir, err := filepath.Abs(m.dir)
+			if err != nil {
+				dir = m.dir
+			}
+			m.absParts = splitPath(dir, m.name)
+		}
+		return m.absParts
+	}
+	if m.parts == nil {
+		m.parts = splitPath(m.dir, m.name)
+	}
+	return m.parts
+}
+
+func splitPath(dir string, name string) []string {
+	dir = strings.TrimSuffix(strings.ToLower(filepath.ToSlash(dir)), "/")
+	return append(strings.Split(dir, "/"), name)
+}
+
+func (m *match) hasMarker(markers []string) bool {
+	for _, sibling := range m.siblings {
+		siblingName := strings.ToLower(sibling.Name())
+		for _, marker := range markers {
+			if ok, _ := path.Match(marker, siblingName); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
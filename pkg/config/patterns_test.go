@@ -0,0 +1,90 @@
+package config
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type dirEntry string
+
+func (e dirEntry) Name() string               { return string(e) }
+func (e dirEntry) IsDir() bool                { return false }
+func (e dirEntry) Type() fs.FileMode          { return 0 }
+func (e dirEntry) Info() (fs.FileInfo, error) { return nil, fs.ErrNotExist }
+
+func TestPatternsMatch(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip(err)
+	}
+	patterns, err := compilePatterns(map[string]configItem{
+		"names":    {Folders: []string{"node_modules", "*.egg-info/"}},
+		"paths":    {Folders: []string{"**/.terraform/providers", "~/.cache/*/", "/var/cache/apt"}},
+		"projects": {Folders: []string{"target if Cargo.toml,pom.xml", "bin if *.csproj"}},
+		"markers": {
+			Folders: []string{"Deps", "vendor if go.mod", "out", "build"},
+			Markers: map[string][]string{"deps": {"mix.exs"}, "vendor": {"composer.json"}, "out, build": {"Makefile"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cargo := []os.DirEntry{dirEntry("Cargo.toml"), dirEntry("src")}
+	dotnet := []os.DirEntry{dirEntry("App.csproj")}
+	none := []os.DirEntry{dirEntry("photo.jpg")}
+
+	tests := []struct {
+		path     string
+		isDir    bool
+		siblings []os.DirEntry
+		expected string
+	}{
+		{"/src/app/node_modules", true, none, "names"},
+		{"/src/app/Node_Modules", true, none, "names"},
+		{"/src/app/node_modules2", true, none, ""},
+		{"/src/lib/foo.egg-info", true, none, "names"},
+		{"/src/lib/foo.egg-info", false, none, ""},
+		{"/infra/.terraform/providers", true, none, "paths"},
+		{"/infra/nested/deep/.terraform/providers", true, none, "paths"},
+		{"/infra/providers", true, none, ""},
+		{filepath.Join(home, ".cache", "go-build"), true, none, "paths"},
+		{filepath.Join(home, ".cache", "go-build", "00"), true, none, ""},
+		{filepath.Join(home, "src", ".cache", "go-build"), true, none, ""},
+		{"/var/cache/apt", true, none, "paths"},
+		{"/backup/var/cache/apt", true, none, ""},
+		{"/src/rust/target", true, cargo, "projects"},
+		{"/src/photos/target", true, none, ""},
+		{"/src/dotnet/bin", true, dotnet, "projects"},
+		{"/usr/local/bin", true, none, ""},
+		{"/src/elixir/deps", true, []os.DirEntry{dirEntry("mix.exs")}, "markers"},
+		{"/src/elixir/deps", true, none, ""},
+		{"/src/php/vendor", true, []os.DirEntry{dirEntry("composer.json")}, "markers"},
+		{"/src/go/vendor", true, []os.DirEntry{dirEntry("go.mod")}, "markers"},
+		{"/src/c/out", true, []os.DirEntry{dirEntry("Makefile")}, "markers"},
+		{"/src/c/build", true, []os.DirEntry{dirEntry("Makefile")}, "markers"},
+		{"/photos/build", true, none, ""},
+	}
+	for _, test := range tests {
+		got, _ := patterns.Match(filepath.Dir(test.path), filepath.Base(test.path), test.isDir, test.siblings)
+		if got != test.expected {
+			t.Errorf("Match(%q) = %q; want %q", test.path, got, test.expected)
+		}
+	}
+}
+
+func TestInvalidPattern(t *testing.T) {
+	for _, entry := range []string{"[", "/", "bin if ["} {
+		if _, err := compilePatterns(map[string]configItem{"test": {Folders: []string{entry}}}); err == nil {
+			t.Errorf("compilePatterns(%q) = nil; want an error", entry)
+		}
+	}
+}
+
+func BenchmarkPatternsMatch(b *testing.B) {
+	siblings := []os.DirEntry{dirEntry("main.go"), dirEntry("go.mod")}
+	for i := 0; i < b.N; i++ {
+		ClutterPatterns.Match("/home/user/src/github.com/project/internal", "handlers", true, siblings)
+	}
+}
@@ -0,0 +1,134 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const (
+	userConfigName    = "config.json"
+	projectConfigName = ".diskrc"
+)
+
+// FolderChanges adds folders to and removes folders from one of the embedded folder lists.
+type FolderChanges struct {
+	// Add maps categories to the folders that are added to them. Categories that don't exist are created.
+	Add map[string][]string `json:"add"`
+	// Remove are folders that are removed, whatever category they're in.
+	Remove []string `json:"remove"`
+	// RemoveCategories are categories that are removed along with all of their folders.
+	RemoveCategories []string `json:"removeCategories"`
+}
+
+// UserConfig is what can be configured in config.json in the app dir and in .diskrc files in projects.
+type UserConfig struct {
+	ClutterFolders FolderChanges `json:"clutterFolders"`
+	UnsafeFolders  FolderChanges `json:"unsafeFolders"`
+	// Flags overrides the default values of flags by their name, e.g. {"min-size": 100}.
+	// Flags that are given on the command line take precedence.
+	Flags map[string]any `json:"flags"`
+}
+
+// LoadUserConfig merges config.json in the app dir and the .diskrc file closest to dir, if there are any,
+// on top of the embedded folder lists. The .diskrc takes precedence. The merged flags are returned along with
+// the paths of the files that were loaded.
+func LoadUserConfig(dir string) (map[string]any, []string, error) {
+	paths := []string{filepath.Join(GetAppDir(), userConfigName)}
+	if projectConfig, ok := findProjectConfig(dir); ok {
+		paths = append(paths, projectConfig)
+	}
+
+	flags := make(map[string]any)
+	var loaded []string
+	for _, path := range paths {
+		userConfig, err := readUserConfig(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, loaded, err
+		}
+		applyFolderChanges(clutterConfig, userConfig.ClutterFolders, strings.ToLower)
+		applyFolderChanges(unsafeConfig, userConfig.UnsafeFolders, func(folder string) string { return folder })
+		for name, value := range userConfig.Flags {
+			flags[name] = value
+		}
+		loaded = append(loaded, path)
+	}
+	err := setFolders()
+	if err != nil {
+		return nil, loaded, fmt.Errorf("invalid config %s: %w", strings.Join(loaded, ", "), err)
+	}
+	return flags, loaded, nil
+}
+
+func readUserConfig(path string) (UserConfig, error) {
+	var userConfig UserConfig
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return userConfig, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	// A typo would otherwise be ignored without a word.
+	decoder.DisallowUnknownFields()
+	// Keeps 1000000 from turning into 1e+06, which an int flag can't parse.
+	decoder.UseNumber()
+	err = decoder.Decode(&userConfig)
+	if err != nil {
+		return userConfig, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return userConfig, nil
+}
+
+// findProjectConfig looks for a .diskrc file in dir and the folders above it.
+func findProjectConfig(dir string) (string, bool) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false
+	}
+	for {
+		path := filepath.Join(dir, projectConfigName)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// applyFolderChanges applies changes to config. The folders are normalized the way the folder list is looked up.
+func applyFolderChanges(config map[string]configItem, changes FolderChanges, normalize func(string) string) {
+	for _, category := range changes.RemoveCategories {
+		delete(config, category)
+	}
+	remove := make(FolderSet)
+	for _, folder := range changes.Remove {
+		remove[normalize(patternName(folder))] = true
+	}
+	for name, category := range config {
+		category.Folders = slices.DeleteFunc(slices.Clone(category.Folders), func(folder string) bool {
+			// The folder is removed whatever markers it has.
+			return remove[normalize(patternName(folder))]
+		})
+		config[name] = category
+	}
+	for name, folders := range changes.Add {
+		category := config[name]
+		for _, folder := range folders {
+			if folder = normalize(folder); !slices.Contains(category.Folders, folder) {
+				category.Folders = append(category.Folders, folder)
+			}
+		}
+		config[name] = category
+	}
+}
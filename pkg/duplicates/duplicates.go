@@ -0,0 +1,321 @@
+// Package duplicates finds files with the exact same content.
+package duplicates
+
+import (
+	"context"
+	"crypto/sha256"
+	"github.com/sebastianappelberg/disk/pkg/config"
+	"github.com/sebastianappelberg/disk/pkg/storage"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMinSize = 50 * storage.MegaByte
+	// partialSize is how much of the start and the end of a file is hashed to rule out most files of the same size
+	// without reading all of them.
+	partialSize = 4 * storage.KiloByte
+)
+
+// Group is a set of identical files. One of them is kept and the rest are copies that can be removed.
+type Group struct {
+	Keep   storage.File
+	Copies []storage.File
+}
+
+// GetPath returns the path of the file that's kept.
+func (g Group) GetPath() string {
+	return g.Keep.GetPath()
+}
+
+// GetPaths returns the paths of the copies, i.e. everything but the file that's kept.
+func (g Group) GetPaths() []string {
+	paths := make([]string, 0, len(g.Copies))
+	for _, file := range g.Copies {
+		paths = append(paths, file.GetPath())
+	}
+	return paths
+}
+
+// Usage returns the space that removing the copies frees up.
+func (g Group) Usage() storage.Usage {
+	var usage storage.Usage
+	for _, file := range g.Copies {
+		usage.Apparent += file.Size
+		usage.Allocated += file.Allocated
+	}
+	return usage
+}
+
+// ModTime returns when the newest of the files was modified, which is usually when the last copy was made.
+func (g Group) ModTime() time.Time {
+	modTime := g.Keep.ModTime
+	for _, file := range g.Copies {
+		if file.ModTime.After(modTime) {
+			modTime = file.ModTime
+		}
+	}
+	return modTime
+}
+
+type AnalyzerOption func(*Analyzer)
+
+// WithSizeFilter makes the analyzer only include groups where removing the copies frees up at least size megabytes.
+func WithSizeFilter(size int) AnalyzerOption {
+	return func(a *Analyzer) {
+		if size >= 0 {
+			a.minSize = int64(size) * storage.MegaByte
+		}
+	}
+}
+
+// WithProgress makes the analyzer count the directories and bytes it scans in progress.
+func WithProgress(progress *storage.Progress) AnalyzerOption {
+	return func(a *Analyzer) {
+		a.progress = progress
+	}
+}
+
+// WithOneFileSystem makes the analyzer stay on the file system that the root is on.
+func WithOneFileSystem() AnalyzerOption {
+	return func(a *Analyzer) {
+		a.oneFileSystem = true
+	}
+}
+
+// WithSizeMode decides whether the size filter applies to the allocated or the apparent size of the copies.
+func WithSizeMode(mode storage.SizeMode) AnalyzerOption {
+	return func(a *Analyzer) {
+		a.sizeMode = mode
+	}
+}
+
+type Analyzer struct {
+	walker        *storage.FileWalker[storage.File]
+	progress      *storage.Progress
+	oneFileSystem bool
+	minSize       int64
+	sizeMode      storage.SizeMode
+}
+
+func NewAnalyzer(options ...AnalyzerOption) *Analyzer {
+	analyzer := &Analyzer{
+		minSize: defaultMinSize,
+	}
+	for _, option := range options {
+		option(analyzer)
+	}
+	walkerOptions := []storage.FileWalkerOption[storage.File]{
+		storage.WithDecisionFilter[storage.File](decisionFilter),
+		storage.WithMapper(storage.IdentityMapper),
+		storage.WithProgress[storage.File](analyzer.progress),
+	}
+	if analyzer.oneFileSystem {
+		walkerOptions = append(walkerOptions, storage.WithOneFileSystem[storage.File]())
+	}
+	analyzer.walker = storage.NewFileWalker[storage.File](walkerOptions...)
+	return analyzer
+}
+
+// decisionFilter includes regular files that aren't empty. Clutter folders are skipped, they're full of
+// identical files but are removed as a whole by the clutter analyzer.
+func decisionFilter(file storage.File, siblings []os.DirEntry) storage.FilterDecision {
+	if _, ok := config.ClutterPatterns.Match(file.Base, file.Name, file.IsDir, siblings); ok {
+		return storage.Skip
+	}
+	if _, ok := config.UnsafePatterns.Match(file.Base, file.Name, file.IsDir, siblings); ok {
+		return storage.Skip
+	}
+	if file.Name == ".git" {
+		// The objects in a repository are managed by git.
+		return storage.Skip
+	}
+	if file.IsRegular() && file.Size > 0 {
+		return storage.Include
+	}
+	return storage.Continue
+}
+
+// Analyze returns the groups of identical files sorted by the path of the file that's kept.
+func (a *Analyzer) Analyze(ctx context.Context, root string) []Group {
+	var groups []Group
+	for group := range a.Stream(ctx, root) {
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].GetPath() < groups[j].GetPath()
+	})
+	return groups
+}
+
+// Stream sends the groups of identical files on the returned channel. Files can only be compared once all
+// files of the same size are known, so nothing is sent until the walk is done. The files of the same size are
+// then hashed in two rounds: first the start and the end of them, then the whole of those that are still alike.
+// The channel is closed when the analysis is done or ctx is cancelled.
+func (a *Analyzer) Stream(ctx context.Context, root string) <-chan Group {
+	ch := make(chan Group)
+	go func() {
+		defer close(ch)
+		bySize := make(map[int64][]storage.File)
+		for file := range a.walker.GetFiles(ctx, root) {
+			bySize[file.Size] = append(bySize[file.Size], file)
+		}
+
+		var wg sync.WaitGroup
+		for size, files := range bySize {
+			if len(files) < 2 || a.reclaimable(files) < a.minSize {
+				continue
+			}
+			wg.Add(1)
+			go func(size int64, files []storage.File) {
+				defer wg.Done()
+				for _, similar := range a.groupByHash(ctx, files, partialHash) {
+					identical := [][]storage.File{similar}
+					if size > 2*partialSize {
+						// Smaller files were hashed in full already.
+						identical = a.groupByHash(ctx, similar, fullHash)
+					}
+					for _, files := range identical {
+						files = withoutHardlinks(files)
+						if len(files) < 2 || a.reclaimable(files) < a.minSize {
+							continue
+						}
+						select {
+						case ch <- newGroup(files):
+						case <-ctx.Done():
+							return
+						}
+					}
+				}
+			}(size, files)
+		}
+		wg.Wait()
+	}()
+	return ch
+}
+
+// reclaimable returns how much space removing all but one of the files frees up.
+func (a *Analyzer) reclaimable(files []storage.File) int64 {
+	return Group{Keep: files[0], Copies: files[1:]}.Usage().Size(a.sizeMode)
+}
+
+// groupByHash hashes the files concurrently, sharing the limit on goroutines with the walker, and returns the groups
+// of files with the same hash, leaving out the files without a match and the ones that couldn't be read.
+func (a *Analyzer) groupByHash(ctx context.Context, files []storage.File, hash func(file storage.File) ([]byte, error)) [][]storage.File {
+	hashes := make([][]byte, len(files))
+	var wg sync.WaitGroup
+	for i, file := range files {
+		if ctx.Err() != nil {
+			wg.Wait()
+			return nil
+		}
+		a.walker.Go(&wg, func() {
+			if sum, err := hash(file); err == nil {
+				hashes[i] = sum
+			}
+		})
+	}
+	wg.Wait()
+
+	byHash := make(map[string][]storage.File)
+	var order []string
+	for i, sum := range hashes {
+		if sum == nil {
+			continue
+		}
+		key := string(sum)
+		if _, ok := byHash[key]; !ok {
+			order = append(order, key)
+		}
+		byHash[key] = append(byHash[key], files[i])
+	}
+	var groups [][]storage.File
+	for _, key := range order {
+		if len(byHash[key]) > 1 {
+			groups = append(groups, byHash[key])
+		}
+	}
+	return groups
+}
+
+// partialHash hashes the start and the end of the file, which is where files of the same size usually differ,
+// e.g. in headers or trailing indexes.
+func partialHash(file storage.File) ([]byte, error) {
+	f, err := openFile(file.GetPath())
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.CopyN(h, f, partialSize); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if file.Size > partialSize {
+		offset := max(partialSize, file.Size-partialSize)
+		if _, err = io.Copy(h, io.NewSectionReader(f, offset, file.Size-offset)); err != nil {
+			return nil, err
+		}
+	}
+	return h.Sum(nil), nil
+}
+
+func fullHash(file storage.File) ([]byte, error) {
+	f, err := openFile(file.GetPath())
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// withoutHardlinks leaves out the files that are hardlinks to a file before them, removing them doesn't free up
+// any space.
+func withoutHardlinks(files []storage.File) []storage.File {
+	var result []storage.File
+	for _, file := range files {
+		if !slices.ContainsFunc(result, file.SameFile) {
+			result = append(result, file)
+		}
+	}
+	return result
+}
+
+// copySuffix matches the suffixes that browsers and file managers add to the names of copies,
+// e.g. "file (1)", "file - Copy", "file copy 2" and "file_copy".
+var copySuffix = regexp.MustCompile(`(?i)(\s\(\d+\)|\s-\scopy(\s\(\d+\))?|\scopy(\s\d+)?|_copy\d*)$`)
+
+// newGroup picks the file to keep among the identical files: the one that doesn't look like a copy by its name,
+// then the oldest one and then the one with the shortest path.
+func newGroup(files []storage.File) Group {
+	files = slices.Clone(files)
+	isCopy := func(file storage.File) bool {
+		return copySuffix.MatchString(strings.TrimSuffix(file.Name, filepath.Ext(file.Name)))
+	}
+	slices.SortFunc(files, func(a, b storage.File) int {
+		if aCopy, bCopy := isCopy(a), isCopy(b); aCopy != bCopy {
+			if aCopy {
+				return 1
+			}
+			return -1
+		}
+		if c := a.ModTime.Compare(b.ModTime); c != 0 {
+			return c
+		}
+		if c := len(a.GetPath()) - len(b.GetPath()); c != 0 {
+			return c
+		}
+		return strings.Compare(a.GetPath(), b.GetPath())
+	})
+	return Group{Keep: files[0], Copies: files[1:]}
+}
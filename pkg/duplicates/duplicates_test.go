@@ -0,0 +1,77 @@
+package duplicates
+
+import (
+	"bytes"
+	"context"
+	"github.com/sebastianappelberg/disk/internal/testutil"
+	"github.com/sebastianappelberg/disk/pkg/config"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	testutil.Main(m, config.SetAppDir)
+}
+
+func TestAnalyze(t *testing.T) {
+	root := t.TempDir()
+	large := bytes.Repeat([]byte("0123456789"), 2000)
+	// The same size, start and end as large, so only the full hash tells them apart.
+	different := slices.Clone(large)
+	different[len(different)/2] = 'x'
+	files := map[string][]byte{
+		"Downloads/file (1).zip":    large,
+		"Downloads/file.zip":        large,
+		"Downloads/backup/file.zip": large,
+		"Downloads/other.zip":       different,
+		"notes/todo.txt":            []byte("todo"),
+		"notes/todo copy.txt":       []byte("todo"),
+		"notes/done.txt":            []byte("done"),
+		"notes/empty.txt":           nil,
+		"notes/empty copy.txt":      nil,
+		"web/package.json":          []byte("{}"),
+		"web/node_modules/a/x.js":   large,
+		"web/node_modules/b/x.js":   large,
+	}
+	for name, content := range files {
+		testutil.WriteFile(t, filepath.Join(root, name), string(content))
+	}
+	// The copy being the oldest doesn't make it the one to keep.
+	for name, age := range map[string]time.Duration{"file (1).zip": time.Hour, "file.zip": time.Minute, "backup/file.zip": 0} {
+		modTime := time.Now().Add(-age)
+		if err := os.Chtimes(filepath.Join(root, "Downloads", name), modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Removing a hardlink doesn't free up any space.
+	if err := os.Link(filepath.Join(root, "notes", "done.txt"), filepath.Join(root, "notes", "done (1).txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	analyzer := NewAnalyzer(WithSizeFilter(0))
+	var got [][]string
+	for _, group := range analyzer.Analyze(context.Background(), root) {
+		paths := []string{group.GetPath()}
+		for _, path := range group.GetPaths() {
+			paths = append(paths, path)
+		}
+		for i, path := range paths {
+			rel, _ := filepath.Rel(root, path)
+			paths[i] = filepath.ToSlash(rel)
+		}
+		got = append(got, paths)
+		if expected := int64(len(group.Copies)) * group.Keep.Size; group.Usage().Apparent != expected {
+			t.Errorf("Usage() = %v; want %d bytes", group.Usage(), expected)
+		}
+	}
+	expected := [][]string{
+		{"Downloads/file.zip", "Downloads/backup/file.zip", "Downloads/file (1).zip"},
+		{"notes/todo.txt", "notes/todo copy.txt"},
+	}
+	if !slices.EqualFunc(got, expected, slices.Equal) {
+		t.Errorf("Analyze() = %v; want %v", got, expected)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package duplicates
+
+import (
+	"os"
+)
+
+func openFile(path string) (*os.File, error) {
+	return os.Open(path)
+}
@@ -3,6 +3,7 @@ package games
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/andygrunwald/vdf"
 	"github.com/sebastianappelberg/disk/pkg/util"
@@ -11,9 +12,23 @@ import (
 	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
+// ErrSteamNotFound is returned when Steam isn't installed.
+var ErrSteamNotFound = errors.New("could not find steam installation path")
+
+// steamPath looks up the Steam installation path once.
+var steamPath = sync.OnceValues(findSteamPath)
+
+// getSteamPath returns the Steam installation path. getSteamGames makes sure that Steam is installed
+// before anything else calls it.
+func getSteamPath() string {
+	path, _ := steamPath()
+	return path
+}
+
 type SteamGame struct {
 	AppId        string        // AppId is the steamID of the game.
 	Name         string        // Name is the name of the game. Needed mainly for display purposes.
@@ -29,6 +44,10 @@ func (s SteamGame) GetPaths() []string {
 }
 
 func getSteamGames() ([]SteamGame, error) {
+	_, err := steamPath()
+	if err != nil {
+		return nil, err
+	}
 	games, err := findGames()
 	if err != nil {
 		return nil, err
@@ -2,6 +2,14 @@
 
 package games
 
-func getSteamPath() string {
-	return "~/Library/Application Support/Steam"
+import (
+	"os"
+)
+
+func findSteamPath() (string, error) {
+	path := os.ExpandEnv("$HOME/Library/Application Support/Steam")
+	if _, err := os.Stat(path); err != nil {
+		return "", ErrSteamNotFound
+	}
+	return path, nil
 }
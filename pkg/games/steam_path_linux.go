@@ -3,19 +3,10 @@
 package games
 
 import (
-	"errors"
 	"os"
 )
 
-func getSteamPath() string {
-	path, err := getLinuxSteamPath()
-	if err != nil {
-		panic(err)
-	}
-	return path
-}
-
-func getLinuxSteamPath() (string, error) {
+func findSteamPath() (string, error) {
 	paths := []string{
 		os.ExpandEnv("$HOME/.steam/steam"),
 		os.ExpandEnv("$HOME/.local/share/Steam"),
@@ -26,5 +17,5 @@ func getLinuxSteamPath() (string, error) {
 			return path, nil
 		}
 	}
-	return "", errors.New("could not find steam installation path")
+	return "", ErrSteamNotFound
 }
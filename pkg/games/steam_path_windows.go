@@ -3,24 +3,17 @@
 package games
 
 import (
+	"fmt"
 	"golang.org/x/sys/windows/registry"
 )
 
-func getSteamPath() string {
-	path, err := getWindowsSteamPath()
-	if err != nil {
-		panic(err)
-	}
-	return path
-}
-
-func getWindowsSteamPath() (string, error) {
+func findSteamPath() (string, error) {
 	key, err := registry.OpenKey(registry.LOCAL_MACHINE, `SOFTWARE\WOW6432Node\Valve\Steam`, registry.QUERY_VALUE)
 	if err != nil {
 		// Try fallback for 32-bit Windows
 		key, err = registry.OpenKey(registry.LOCAL_MACHINE, `SOFTWARE\Valve\Steam`, registry.QUERY_VALUE)
 		if err != nil {
-			return "", err
+			return "", fmt.Errorf("%w: %v", ErrSteamNotFound, err)
 		}
 	}
 	defer key.Close()
@@ -0,0 +1,141 @@
+package git
+
+import (
+	"bufio"
+	"errors"
+	"github.com/sebastianappelberg/disk/pkg/util"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Ignore holds the patterns of an ignore file along with the ones of the folders above it. The patterns in
+// deeper folders take precedence, just like in git.
+type Ignore struct {
+	parent *Ignore
+	// base is the folder of the ignore file relative to the root of the repository, "" for the root.
+	base  string
+	rules []ignoreRule
+}
+
+type ignoreRule struct {
+	segments []string
+	negate   bool
+	dirOnly  bool
+}
+
+// RootIgnore returns the patterns in .git/info/exclude and the .gitignore at the root of the repository.
+func (r *Repo) RootIgnore() (*Ignore, error) {
+	exclude, err := readIgnoreFile(nil, "", filepath.Join(r.CommonDir, "info", "exclude"))
+	if err != nil {
+		return nil, err
+	}
+	return readIgnoreFile(exclude, "", filepath.Join(r.Root, ".gitignore"))
+}
+
+// Nested returns the patterns in the .gitignore in the folder at rel, which is relative to the root of the
+// repository and separated by slashes, on top of the ones in ignore. ignore is returned if there's no .gitignore.
+func (i *Ignore) Nested(root string, rel string) (*Ignore, error) {
+	return readIgnoreFile(i, rel, filepath.Join(root, filepath.FromSlash(rel), ".gitignore"))
+}
+
+func readIgnoreFile(parent *Ignore, base string, name string) (*Ignore, error) {
+	file, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		if parent == nil {
+			return &Ignore{base: base}, nil
+		}
+		return parent, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return NewIgnore(parent, base, lines), nil
+}
+
+// NewIgnore parses the lines of an ignore file in the folder base, see https://git-scm.com/docs/gitignore.
+func NewIgnore(parent *Ignore, base string, lines []string) *Ignore {
+	ignore := &Ignore{parent: parent, base: base}
+	for _, line := range lines {
+		if rule, ok := parseIgnoreRule(line); ok {
+			ignore.rules = append(ignore.rules, rule)
+		}
+	}
+	return ignore
+}
+
+func parseIgnoreRule(line string) (ignoreRule, bool) {
+	var rule ignoreRule
+	line = strings.TrimSuffix(line, "\r")
+	// Trailing spaces are ignored unless they're escaped.
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return rule, false
+	}
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return rule, false
+	}
+	// A pattern with a slash is relative to the folder of the ignore file, others match at any depth.
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	// Git negates character classes with ! as well as ^, path.Match only knows the latter.
+	line = strings.ReplaceAll(line, "[!", "[^")
+	rule.segments = strings.Split(line, "/")
+	if !anchored {
+		rule.segments = append([]string{"**"}, rule.segments...)
+	}
+	for _, segment := range rule.segments {
+		if _, err := path.Match(segment, ""); err != nil {
+			return rule, false
+		}
+	}
+	return rule, true
+}
+
+// Ignored reports whether the file at rel, relative to the root of the repository and separated by slashes,
+// is ignored by a pattern. The folders above rel aren't checked, everything in an ignored folder is ignored as well.
+func (i *Ignore) Ignored(rel string, isDir bool) bool {
+	for level := i; level != nil; level = level.parent {
+		relToLevel := rel
+		if level.base != "" {
+			var ok bool
+			if relToLevel, ok = strings.CutPrefix(rel, level.base+"/"); !ok {
+				continue
+			}
+		}
+		parts := strings.Split(relToLevel, "/")
+		// The last pattern that matches decides.
+		for j := len(level.rules) - 1; j >= 0; j-- {
+			rule := level.rules[j]
+			if rule.dirOnly && !isDir {
+				continue
+			}
+			if util.MatchSegments(rule.segments, parts) {
+				return !rule.negate
+			}
+		}
+	}
+	return false
+}
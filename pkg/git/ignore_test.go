@@ -0,0 +1,77 @@
+package git
+
+import (
+	"github.com/sebastianappelberg/disk/internal/testutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnored(t *testing.T) {
+	root := NewIgnore(nil, "", []string{
+		"# build output",
+		"/dist",
+		"build/",
+		"*.log",
+		"!keep.log",
+		"docs/**/generated",
+		"cache/**",
+		`\#notes`,
+		"[!a]tmp",
+	})
+	nested := NewIgnore(root, "web", []string{"out/", "!build/"})
+
+	tests := []struct {
+		ignore   *Ignore
+		path     string
+		isDir    bool
+		expected bool
+	}{
+		{root, "dist", true, true},
+		{root, "src/dist", true, false},
+		{root, "build", true, true},
+		{root, "src/build", true, true},
+		{root, "build", false, false},
+		{root, "server.log", false, true},
+		{root, "logs/keep.log", false, false},
+		{root, "docs/generated", true, true},
+		{root, "docs/api/v1/generated", true, true},
+		{root, "cache", true, false},
+		{root, "cache/a", true, true},
+		{root, "#notes", false, true},
+		{root, "btmp", true, true},
+		{root, "atmp", true, false},
+		{nested, "web/out", true, true},
+		{nested, "out", true, false},
+		{nested, "web/build", true, false},
+		{nested, "web/debug.log", false, true},
+	}
+	for _, test := range tests {
+		if got := test.ignore.Ignored(test.path, test.isDir); got != test.expected {
+			t.Errorf("Ignored(%q, %v) = %v; want %v", test.path, test.isDir, got, test.expected)
+		}
+	}
+}
+
+func TestRootIgnore(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, ".git", "info"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	testutil.WriteFile(t, filepath.Join(root, ".git", "info", "exclude"), "local/\nnotes.txt\n")
+	testutil.WriteFile(t, filepath.Join(root, ".gitignore"), "!notes.txt\n")
+	repo, err := Open(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ignore, err := repo.RootIgnore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ignore.Ignored("local", true) {
+		t.Error("Ignored(\"local\") = false; want true from .git/info/exclude")
+	}
+	if ignore.Ignored("notes.txt", false) {
+		t.Error("Ignored(\"notes.txt\") = true; want false since .gitignore takes precedence over .git/info/exclude")
+	}
+}
@@ -0,0 +1,191 @@
+package git
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// IndexEntry is a file in the index, i.e. a file that's tracked or staged.
+type IndexEntry struct {
+	// Path is relative to the root of the repository and separated by slashes.
+	Path    string
+	ModTime time.Time
+	// Size is the size of the file truncated to 32 bits, just like git stores it.
+	Size uint32
+	Mode uint32
+	Hash Hash
+}
+
+// modeGitlink is the mode of submodules in the index.
+const modeGitlink = 0160000
+
+// IsSubmodule reports whether the entry is a submodule, in which case Path is a folder.
+func (e IndexEntry) IsSubmodule() bool {
+	return e.Mode&0170000 == modeGitlink
+}
+
+var errInvalidIndex = errors.New("invalid index")
+
+// ErrUnsupportedIndex is returned for indexes with an extension that has to be understood to know what's tracked,
+// such as a split index or a sparse index.
+var ErrUnsupportedIndex = errors.New("unsupported index extension")
+
+// Index reads the entries in the index of the repository. A repository without an index, e.g. one without any
+// commits, has no entries.
+func (r *Repo) Index() ([]IndexEntry, error) {
+	file, err := os.Open(filepath.Join(r.GitDir, "index"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	entries, err := readIndex(bufio.NewReader(file))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file.Name(), err)
+	}
+	return entries, nil
+}
+
+// readIndex reads the entries of an index in version 2, 3 or 4. The optional extensions after the entries are
+// ignored, the ones that change what the entries mean aren't supported. See https://git-scm.com/docs/index-format.
+func readIndex(r *bufio.Reader) ([]IndexEntry, error) {
+	var header struct {
+		Signature [4]byte
+		Version   uint32
+		Entries   uint32
+	}
+	if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+		return nil, err
+	}
+	if string(header.Signature[:]) != "DIRC" || header.Version < 2 || header.Version > 4 {
+		return nil, errInvalidIndex
+	}
+
+	var fixed struct {
+		CtimeSec, CtimeNsec uint32
+		MtimeSec, MtimeNsec uint32
+		Dev, Ino, Mode      uint32
+		UID, GID, Size      uint32
+		Hash                [20]byte
+		Flags               uint16
+	}
+	const fixedSize = 62
+	entries := make([]IndexEntry, 0, header.Entries)
+	previous := ""
+	for range header.Entries {
+		if err := binary.Read(r, binary.BigEndian, &fixed); err != nil {
+			return nil, err
+		}
+		size := fixedSize
+		if header.Version >= 3 && fixed.Flags&0x4000 != 0 {
+			// The extended flags are only used for sparse checkouts and intent-to-add, neither matter here.
+			if _, err := r.Discard(2); err != nil {
+				return nil, err
+			}
+			size += 2
+		}
+
+		var name string
+		if header.Version == 4 {
+			// The path is compressed: the number of bytes to remove from the end of the previous path,
+			// followed by what to add to it.
+			strip, err := binary.ReadUvarint(r)
+			if err != nil {
+				return nil, err
+			}
+			if strip > uint64(len(previous)) {
+				return nil, errInvalidIndex
+			}
+			suffix, err := r.ReadBytes(0)
+			if err != nil {
+				return nil, err
+			}
+			name = previous[:len(previous)-int(strip)] + string(suffix[:len(suffix)-1])
+		} else {
+			raw, err := r.ReadBytes(0)
+			if err != nil {
+				return nil, err
+			}
+			name = string(raw[:len(raw)-1])
+			// Entries are padded with NULs to a multiple of 8 bytes, at least one NUL which has been read.
+			size += len(raw)
+			if padding := (8 - size%8) % 8; padding > 0 {
+				if _, err := r.Discard(padding); err != nil {
+					return nil, err
+				}
+			}
+		}
+		previous = name
+
+		entries = append(entries, IndexEntry{
+			Path:    name,
+			ModTime: time.Unix(int64(fixed.MtimeSec), int64(fixed.MtimeNsec)),
+			Size:    fixed.Size,
+			Mode:    fixed.Mode,
+			Hash:    fixed.Hash,
+		})
+	}
+	if err := checkExtensions(r); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// checkExtensions reads the extensions after the entries, up to the checksum at the end of the index. Extensions
+// whose signature doesn't start with an uppercase letter are required, e.g. "link" for a split index where most
+// entries are in another file, and "sdir" for a sparse index where entries can be folders.
+func checkExtensions(r *bufio.Reader) error {
+	rest, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	// The index ends with a checksum of everything before it.
+	if len(rest) < len(Hash{}) {
+		return errInvalidIndex
+	}
+	extensions := rest[:len(rest)-len(Hash{})]
+	for len(extensions) > 0 {
+		if len(extensions) < 8 {
+			return errInvalidIndex
+		}
+		signature := extensions[:4]
+		size := binary.BigEndian.Uint32(extensions[4:8])
+		if uint64(size) > uint64(len(extensions)-8) {
+			return errInvalidIndex
+		}
+		if signature[0] < 'A' || signature[0] > 'Z' {
+			return fmt.Errorf("%w %q", ErrUnsupportedIndex, signature)
+		}
+		extensions = extensions[8+size:]
+	}
+	return nil
+}
+
+// Tracked holds the paths of the tracked files and the folders that contain them.
+type Tracked map[string]bool
+
+// NewTracked returns the tracked files and folders in entries.
+func NewTracked(entries []IndexEntry) Tracked {
+	tracked := make(Tracked, len(entries))
+	for _, entry := range entries {
+		for p := entry.Path; p != "." && !tracked[p]; p = path.Dir(p) {
+			tracked[p] = true
+		}
+	}
+	return tracked
+}
+
+// Contains reports whether the file at rel, relative to the root of the repository and separated by slashes,
+// is tracked or is a folder with tracked files in it.
+func (t Tracked) Contains(rel string) bool {
+	return t[rel]
+}
@@ -0,0 +1,81 @@
+package git
+
+import (
+	"errors"
+	"github.com/sebastianappelberg/disk/internal/testutil"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestIndex(t *testing.T) {
+	for _, version := range []string{"2", "3", "4"} {
+		root := t.TempDir()
+		testutil.Git(t, root, "init", "-q")
+		testutil.WriteFile(t, filepath.Join(root, "README.md"), "readme")
+		testutil.WriteFile(t, filepath.Join(root, "src", "main.go"), "package main")
+		testutil.WriteFile(t, filepath.Join(root, "src", "internal", "a-very-long-name-that-is-compressed.go"), "package internal")
+		testutil.Git(t, root, "add", ".")
+		testutil.Git(t, root, "update-index", "--index-version", version)
+
+		repo, err := Open(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries, err := repo.Index()
+		if err != nil {
+			t.Fatalf("Index() with version %s: %v", version, err)
+		}
+		var paths []string
+		for _, entry := range entries {
+			paths = append(paths, entry.Path)
+		}
+		expected := []string{"README.md", "src/internal/a-very-long-name-that-is-compressed.go", "src/main.go"}
+		if !slices.Equal(paths, expected) {
+			t.Errorf("Index() with version %s = %v; want %v", version, paths, expected)
+		}
+		if len(entries) > 0 && entries[0].Size != uint32(len("readme")) {
+			t.Errorf("Index()[0].Size = %d; want %d", entries[0].Size, len("readme"))
+		}
+
+		tracked := NewTracked(entries)
+		for p, expected := range map[string]bool{"src": true, "src/internal": true, "src/main.go": true, "docs": false, "README": false} {
+			if got := tracked.Contains(p); got != expected {
+				t.Errorf("Contains(%q) = %v; want %v", p, got, expected)
+			}
+		}
+	}
+}
+
+func TestIndexSplit(t *testing.T) {
+	root := t.TempDir()
+	testutil.Git(t, root, "init", "-q")
+	testutil.WriteFile(t, filepath.Join(root, "README.md"), "readme")
+	testutil.Git(t, root, "add", ".")
+	// Most of the entries of a split index are in a shared index that the link extension points to.
+	testutil.Git(t, root, "update-index", "--split-index")
+
+	repo, err := Open(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Index(); !errors.Is(err, ErrUnsupportedIndex) {
+		t.Errorf("Index() of a split index = %v; want ErrUnsupportedIndex", err)
+	}
+}
+
+func TestOpenWorktree(t *testing.T) {
+	root := t.TempDir()
+	gitDir := filepath.Join(t.TempDir(), "repo.git")
+	testutil.WriteFile(t, filepath.Join(root, ".git"), "gitdir: "+gitDir+"\n")
+	repo, err := Open(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repo.GitDir != gitDir {
+		t.Errorf("Open(%q).GitDir = %q; want %q", root, repo.GitDir, gitDir)
+	}
+	if _, err := Open(t.TempDir()); !errors.Is(err, ErrNotRepo) {
+		t.Errorf("Open() of a folder without .git = %v; want ErrNotRepo", err)
+	}
+}
@@ -0,0 +1,347 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ObjectType is the type of an object, only commits are parsed.
+type ObjectType int
+
+const (
+	ObjectCommit ObjectType = 1
+	ObjectTree   ObjectType = 2
+	ObjectBlob   ObjectType = 3
+	ObjectTag    ObjectType = 4
+
+	objectOfsDelta = 6
+	objectRefDelta = 7
+)
+
+var objectTypes = map[string]ObjectType{"commit": ObjectCommit, "tree": ObjectTree, "blob": ObjectBlob, "tag": ObjectTag}
+
+// ErrObjectNotFound is returned when an object is neither loose nor in a pack, e.g. in a shallow clone.
+var ErrObjectNotFound = errors.New("object not found")
+
+// maxObjectSize is the largest object that's read, the size in the header of a corrupt pack could be anything.
+// Only commits and tags are parsed, they're nowhere near as big.
+const maxObjectSize = 64 * 1024 * 1024
+
+var errObjectTooLarge = errors.New("object too large")
+
+// maxDeltaDepth stops a corrupt pack from sending ReadObject in circles. Git itself defaults to 50.
+const maxDeltaDepth = 1000
+
+// pack is a packfile along with its index, see https://git-scm.com/docs/gitformat-pack.
+type pack struct {
+	path    string
+	hashes  []Hash
+	offsets []int64
+}
+
+// packs reads the indexes of the packs the first time it's called.
+func (r *Repo) packs() ([]*pack, error) {
+	r.packsOnce.Do(func() {
+		var paths []string
+		paths, r.packsErr = filepath.Glob(filepath.Join(r.CommonDir, "objects", "pack", "*.idx"))
+		for _, path := range paths {
+			p, err := readPackIndex(path)
+			if err != nil {
+				r.packsErr = err
+				return
+			}
+			r.packList = append(r.packList, p)
+		}
+	})
+	return r.packList, r.packsErr
+}
+
+// readPackIndex reads an index in version 2.
+func readPackIndex(path string) (*pack, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	const headerSize = 8 + 256*4
+	if len(data) < headerSize || !bytes.Equal(data[:8], []byte{0xff, 't', 'O', 'c', 0, 0, 0, 2}) {
+		return nil, fmt.Errorf("%s: unsupported pack index", path)
+	}
+	count := int(binary.BigEndian.Uint32(data[headerSize-4 : headerSize]))
+	hashesStart := headerSize
+	offsetsStart := hashesStart + count*20 + count*4
+	largeOffsetsStart := offsetsStart + count*4
+	if len(data) < largeOffsetsStart {
+		return nil, fmt.Errorf("%s: truncated pack index", path)
+	}
+	p := &pack{
+		path:    strings.TrimSuffix(path, ".idx") + ".pack",
+		hashes:  make([]Hash, count),
+		offsets: make([]int64, count),
+	}
+	for i := range count {
+		copy(p.hashes[i][:], data[hashesStart+i*20:])
+		offset := binary.BigEndian.Uint32(data[offsetsStart+i*4:])
+		if offset&0x80000000 == 0 {
+			p.offsets[i] = int64(offset)
+			continue
+		}
+		// Offsets that don't fit in 31 bits are in a table of 64-bit offsets.
+		large := largeOffsetsStart + int(offset&0x7fffffff)*8
+		if len(data) < large+8 {
+			return nil, fmt.Errorf("%s: truncated pack index", path)
+		}
+		p.offsets[i] = int64(binary.BigEndian.Uint64(data[large:]))
+	}
+	return p, nil
+}
+
+func (p *pack) find(hash Hash) (int64, bool) {
+	i := sort.Search(len(p.hashes), func(i int) bool {
+		return bytes.Compare(p.hashes[i][:], hash[:]) >= 0
+	})
+	if i < len(p.hashes) && p.hashes[i] == hash {
+		return p.offsets[i], true
+	}
+	return 0, false
+}
+
+// ReadObject returns the type and the content of the object with the hash, whether it's loose or in a pack.
+func (r *Repo) ReadObject(hash Hash) (ObjectType, []byte, error) {
+	return r.readObject(hash, 0)
+}
+
+func (r *Repo) readObject(hash Hash, depth int) (ObjectType, []byte, error) {
+	if depth > maxDeltaDepth {
+		return 0, nil, fmt.Errorf("object %s: delta chain too long", hash)
+	}
+	objectType, data, err := r.readLooseObject(hash)
+	if !errors.Is(err, os.ErrNotExist) {
+		return objectType, data, err
+	}
+	packs, err := r.packs()
+	if err != nil {
+		return 0, nil, err
+	}
+	for _, p := range packs {
+		if offset, ok := p.find(hash); ok {
+			return r.readPackedObject(p, offset, depth)
+		}
+	}
+	return 0, nil, fmt.Errorf("object %s: %w", hash, ErrObjectNotFound)
+}
+
+func (r *Repo) readLooseObject(hash Hash) (ObjectType, []byte, error) {
+	name := hash.String()
+	file, err := os.Open(filepath.Join(r.CommonDir, "objects", name[:2], name[2:]))
+	if err != nil {
+		return 0, nil, err
+	}
+	defer file.Close()
+	z, err := zlib.NewReader(file)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer z.Close()
+	// The header is at most a type, a size and a NUL.
+	data, err := io.ReadAll(io.LimitReader(z, maxObjectSize+32))
+	if err != nil {
+		return 0, nil, err
+	}
+	// The content is preceded by a header like "commit 123\x00".
+	header, content, ok := bytes.Cut(data, []byte{0})
+	typeName, size, _ := strings.Cut(string(header), " ")
+	objectType, known := objectTypes[typeName]
+	if !ok || !known || size != strconv.Itoa(len(content)) {
+		return 0, nil, fmt.Errorf("object %s: invalid loose object", hash)
+	}
+	return objectType, content, nil
+}
+
+func (r *Repo) readPackedObject(p *pack, offset int64, depth int) (ObjectType, []byte, error) {
+	file, err := os.Open(p.path)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer file.Close()
+	return r.readPackedObjectAt(file, p, offset, depth)
+}
+
+func (r *Repo) readPackedObjectAt(file *os.File, p *pack, offset int64, depth int) (ObjectType, []byte, error) {
+	reader := bufio.NewReader(io.NewSectionReader(file, offset, 1<<62))
+	// The header holds the type in bits 4-6 of the first byte and the size in the rest, 7 bits per byte.
+	b, err := reader.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	objectType := ObjectType(b >> 4 & 7)
+	size := uint64(b & 15)
+	for shift := 4; b&0x80 != 0; shift += 7 {
+		if b, err = reader.ReadByte(); err != nil {
+			return 0, nil, err
+		}
+		size |= uint64(b&0x7f) << shift
+	}
+
+	var baseType ObjectType
+	var base []byte
+	switch objectType {
+	case objectOfsDelta:
+		// The base is the given number of bytes before this object, encoded in a variant of a varint.
+		b, err = reader.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		distance := int64(b & 0x7f)
+		for b&0x80 != 0 {
+			if b, err = reader.ReadByte(); err != nil {
+				return 0, nil, err
+			}
+			distance = (distance+1)<<7 | int64(b&0x7f)
+		}
+		baseType, base, err = r.readPackedObjectAt(file, p, offset-distance, depth+1)
+	case objectRefDelta:
+		var baseHash Hash
+		if _, err = io.ReadFull(reader, baseHash[:]); err != nil {
+			return 0, nil, err
+		}
+		baseType, base, err = r.readObject(baseHash, depth+1)
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if size > maxObjectSize {
+		return 0, nil, fmt.Errorf("object at %d in %s: %w", offset, p.path, errObjectTooLarge)
+	}
+	z, err := zlib.NewReader(reader)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer z.Close()
+	// The data is read as it comes instead of trusting the size for the allocation.
+	data, err := io.ReadAll(io.LimitReader(z, int64(size)))
+	if err != nil {
+		return 0, nil, err
+	}
+	if uint64(len(data)) != size {
+		return 0, nil, io.ErrUnexpectedEOF
+	}
+	if base == nil {
+		return objectType, data, nil
+	}
+	data, err = applyDelta(base, data)
+	return baseType, data, err
+}
+
+var errInvalidDelta = errors.New("invalid delta")
+
+// applyDelta applies a delta to base. A delta is the size of the base and the result, followed by instructions
+// that either copy a part of the base or insert new data.
+func applyDelta(base []byte, delta []byte) ([]byte, error) {
+	r := bytes.NewReader(delta)
+	baseSize, err := binary.ReadUvarint(r)
+	if err != nil || baseSize != uint64(len(base)) {
+		return nil, errInvalidDelta
+	}
+	resultSize, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, errInvalidDelta
+	}
+	if resultSize > maxObjectSize {
+		return nil, errObjectTooLarge
+	}
+	result := make([]byte, 0, resultSize)
+	for {
+		cmd, err := r.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if cmd&0x80 == 0 {
+			// Insert the next cmd bytes, 0 is reserved.
+			if cmd == 0 {
+				return nil, errInvalidDelta
+			}
+			insert := make([]byte, cmd)
+			if _, err := io.ReadFull(r, insert); err != nil {
+				return nil, errInvalidDelta
+			}
+			result = append(result, insert...)
+			continue
+		}
+		// The bits of cmd tell which bytes of the offset and the size follow.
+		var offset, size uint32
+		for i := range 7 {
+			if cmd&(1<<i) == 0 {
+				continue
+			}
+			b, err := r.ReadByte()
+			if err != nil {
+				return nil, errInvalidDelta
+			}
+			if i < 4 {
+				offset |= uint32(b) << (8 * i)
+			} else {
+				size |= uint32(b) << (8 * (i - 4))
+			}
+		}
+		if size == 0 {
+			size = 0x10000
+		}
+		if uint64(offset)+uint64(size) > uint64(len(base)) {
+			return nil, errInvalidDelta
+		}
+		result = append(result, base[offset:offset+size]...)
+	}
+	if uint64(len(result)) != resultSize {
+		return nil, errInvalidDelta
+	}
+	return result, nil
+}
+
+// Commit holds the parts of a commit that are needed to tell how old it is and what came before it.
+type Commit struct {
+	Hash      Hash
+	Parents   []Hash
+	Committed time.Time
+}
+
+// ReadCommit reads and parses the commit with the hash.
+func (r *Repo) ReadCommit(hash Hash) (Commit, error) {
+	commit := Commit{Hash: hash}
+	objectType, data, err := r.ReadObject(hash)
+	if err != nil {
+		return commit, err
+	}
+	if objectType != ObjectCommit {
+		return commit, fmt.Errorf("object %s isn't a commit", hash)
+	}
+	// The headers end at the first empty line, the message follows.
+	headers, _, _ := bytes.Cut(data, []byte("\n\n"))
+	for _, line := range strings.Split(string(headers), "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "parent":
+			parent, err := ParseHash(value)
+			if err != nil {
+				return commit, err
+			}
+			commit.Parents = append(commit.Parents, parent)
+		case "committer":
+			if commit.Committed, err = parseSignatureTime(value); err != nil {
+				return commit, err
+			}
+		}
+	}
+	return commit, nil
+}
@@ -0,0 +1,173 @@
+package git
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Hash is the SHA-1 of an object.
+type Hash [20]byte
+
+func (h Hash) String() string {
+	return hex.EncodeToString(h[:])
+}
+
+// ParseHash parses a hash in hex.
+func ParseHash(s string) (Hash, error) {
+	var h Hash
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != len(h) {
+		return h, fmt.Errorf("invalid hash %q", s)
+	}
+	copy(h[:], b)
+	return h, nil
+}
+
+// Head returns the ref that HEAD points to, e.g. "refs/heads/main", or "" if HEAD is detached, along with the
+// commit it points to. The hash is zero in a repository without commits.
+func (r *Repo) Head() (string, Hash, error) {
+	data, err := os.ReadFile(filepath.Join(r.GitDir, "HEAD"))
+	if err != nil {
+		return "", Hash{}, err
+	}
+	head := strings.TrimSpace(string(data))
+	if ref, ok := strings.CutPrefix(head, "ref: "); ok {
+		refs, err := r.Refs()
+		if err != nil {
+			return "", Hash{}, err
+		}
+		return ref, refs[ref], nil
+	}
+	hash, err := ParseHash(head)
+	return "", hash, err
+}
+
+// Refs returns all refs in the repository, both the loose ones and the ones in packed-refs, by their full name.
+func (r *Repo) Refs() (map[string]Hash, error) {
+	refs, err := r.packedRefs()
+	if err != nil {
+		return nil, err
+	}
+	refsDir := filepath.Join(r.CommonDir, "refs")
+	err = filepath.WalkDir(refsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		hash, err := ParseHash(strings.TrimSpace(string(data)))
+		if err != nil {
+			// Symbolic refs such as refs/remotes/origin/HEAD point to another ref, which is listed on its own.
+			return nil
+		}
+		rel, err := filepath.Rel(r.CommonDir, path)
+		if err != nil {
+			return err
+		}
+		// Loose refs take precedence over packed ones.
+		refs[filepath.ToSlash(rel)] = hash
+		return nil
+	})
+	return refs, err
+}
+
+func (r *Repo) packedRefs() (map[string]Hash, error) {
+	refs := make(map[string]Hash)
+	file, err := os.Open(filepath.Join(r.CommonDir, "packed-refs"))
+	if errors.Is(err, os.ErrNotExist) {
+		return refs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		// Comments hold the traits of the file and lines starting with ^ hold the commit that the tag above points to.
+		if strings.HasPrefix(line, "#") || strings.HasPrefix(line, "^") {
+			continue
+		}
+		hex, name, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		if hash, err := ParseHash(hex); err == nil {
+			refs[name] = hash
+		}
+	}
+	return refs, scanner.Err()
+}
+
+// LastReflogTime returns the time of the newest entry in the reflog of HEAD, i.e. the last commit, checkout,
+// pull, etc. It's zero if there's no reflog.
+func (r *Repo) LastReflogTime() (time.Time, error) {
+	data, err := os.ReadFile(filepath.Join(r.GitDir, "logs", "HEAD"))
+	if errors.Is(err, os.ErrNotExist) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	// An entry looks like "<old> <new> Name <email> 1700000000 +0100\tcommit: message".
+	line, _, _ := strings.Cut(lines[len(lines)-1], "\t")
+	return parseSignatureTime(line)
+}
+
+// parseSignatureTime parses the time at the end of a signature, i.e. "Name <email> 1700000000 +0100".
+func parseSignatureTime(signature string) (time.Time, error) {
+	fields := strings.Fields(signature)
+	if len(fields) < 2 {
+		return time.Time{}, fmt.Errorf("invalid signature %q", signature)
+	}
+	seconds, err := strconv.ParseInt(fields[len(fields)-2], 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid signature %q", signature)
+	}
+	return time.Unix(seconds, 0), nil
+}
+
+// RemoteURLs returns the URLs of the remotes in .git/config by the name of the remote.
+func (r *Repo) RemoteURLs() (map[string]string, error) {
+	file, err := os.Open(filepath.Join(r.CommonDir, "config"))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	urls := make(map[string]string)
+	remote := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			// A section looks like [remote "origin"].
+			remote = ""
+			if name, ok := strings.CutPrefix(strings.Trim(line, "[]"), "remote "); ok {
+				remote = strings.Trim(strings.TrimSpace(name), `"`)
+			}
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if remote != "" && ok && strings.EqualFold(strings.TrimSpace(key), "url") {
+			urls[remote] = strings.TrimSpace(value)
+		}
+	}
+	return urls, scanner.Err()
+}
@@ -0,0 +1,96 @@
+// Package git reads git repositories straight from the files in .git, without shelling out to git.
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Repo is a repository with a working tree.
+type Repo struct {
+	// Root is the folder that holds the working tree.
+	Root string
+	// GitDir is the .git folder, which is somewhere else for worktrees and submodules.
+	GitDir string
+	// CommonDir holds the objects, refs and config, it's the same as GitDir except for worktrees.
+	CommonDir string
+
+	packsOnce sync.Once
+	packList  []*pack
+	packsErr  error
+}
+
+// ErrNotRepo is returned by Open when a folder doesn't contain a .git folder.
+var ErrNotRepo = errors.New("not a git repository")
+
+// Open opens the repository whose working tree is root.
+func Open(root string) (*Repo, error) {
+	gitDir, err := findGitDir(root)
+	if err != nil {
+		return nil, err
+	}
+	return &Repo{Root: root, GitDir: gitDir, CommonDir: commonDir(gitDir)}, nil
+}
+
+// commonDir returns the folder that a worktree shares with the main repository, which gitDir points to in commondir.
+func commonDir(gitDir string) string {
+	data, err := os.ReadFile(filepath.Join(gitDir, "commondir"))
+	if err != nil {
+		return gitDir
+	}
+	dir := filepath.FromSlash(strings.TrimSpace(string(data)))
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(gitDir, dir)
+	}
+	return filepath.Clean(dir)
+}
+
+// findGitDir returns the .git folder of root. .git is a file that points to it in worktrees and submodules.
+func findGitDir(root string) (string, error) {
+	dotGit := filepath.Join(root, ".git")
+	info, err := os.Stat(dotGit)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", ErrNotRepo
+	}
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return dotGit, nil
+	}
+	data, err := os.ReadFile(dotGit)
+	if err != nil {
+		return "", err
+	}
+	gitDir, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir:")
+	if !ok {
+		return "", fmt.Errorf("%s: %w", dotGit, ErrNotRepo)
+	}
+	gitDir = filepath.FromSlash(strings.TrimSpace(gitDir))
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(root, gitDir)
+	}
+	return gitDir, nil
+}
+
+// FindRoot returns the root of the repository that dir is in by looking for .git in dir and the folders above it.
+func FindRoot(dir string) (string, bool) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false
+	}
+	for {
+		if _, err := os.Lstat(filepath.Join(dir, ".git")); err == nil {
+			return dir, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
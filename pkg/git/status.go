@@ -0,0 +1,309 @@
+package git
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrNoRemote is returned by Unpushed for repositories without remote-tracking refs.
+var ErrNoRemote = errors.New("no remote-tracking refs")
+
+const modeSymlink = 0120000
+
+// Regenerable tells whether an ignored file or folder can be regenerated, e.g. because it's build output or
+// dependencies. dir is the folder that it's in.
+type Regenerable func(dir string, entry fs.DirEntry) bool
+
+// LocalChange returns the path of a file that has been changed, removed or added without being committed, or ""
+// if the working tree is clean. Ignored files only count if regenerable doesn't accept them, none of them count
+// if it's nil. Submodules are checked as well.
+func (r *Repo) LocalChange(regenerable Regenerable) (string, error) {
+	entries, err := r.Index()
+	if err != nil {
+		return "", err
+	}
+	for _, entry := range entries {
+		changed, err := r.changed(entry, regenerable)
+		if err != nil {
+			return "", err
+		}
+		if changed != "" {
+			return changed, nil
+		}
+	}
+	return r.untracked(NewTracked(entries), regenerable)
+}
+
+// changed returns entry.Path if the file doesn't match the index anymore.
+func (r *Repo) changed(entry IndexEntry, regenerable Regenerable) (string, error) {
+	name := filepath.Join(r.Root, filepath.FromSlash(entry.Path))
+	if entry.IsSubmodule() {
+		submodule, err := Open(name)
+		if errors.Is(err, ErrNotRepo) {
+			// The submodule isn't checked out.
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		changed, err := submodule.LocalChange(regenerable)
+		if changed != "" {
+			changed = path.Join(entry.Path, changed)
+		}
+		return changed, err
+	}
+	info, err := os.Lstat(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return entry.Path, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if uint32(info.Size()) != entry.Size {
+		return entry.Path, nil
+	}
+	if info.ModTime().Equal(entry.ModTime) || info.ModTime().Truncate(time.Second).Equal(entry.ModTime) {
+		return "", nil
+	}
+	// The file has been touched, it's only changed if the content is.
+	hash, err := hashFile(name, entry.Mode&0170000 == modeSymlink, info.Size())
+	if err != nil {
+		return "", err
+	}
+	if hash != entry.Hash {
+		return entry.Path, nil
+	}
+	return "", nil
+}
+
+// hashFile returns the hash that the file would get as a blob. The content of a symlink is its target.
+func hashFile(name string, symlink bool, size int64) (Hash, error) {
+	h := sha1.New()
+	if symlink {
+		target, err := os.Readlink(name)
+		if err != nil {
+			return Hash{}, err
+		}
+		fmt.Fprintf(h, "blob %d\x00%s", len(target), filepath.ToSlash(target))
+		return Hash(h.Sum(nil)), nil
+	}
+	file, err := os.Open(name)
+	if err != nil {
+		return Hash{}, err
+	}
+	defer file.Close()
+	fmt.Fprintf(h, "blob %d\x00", size)
+	if _, err := io.Copy(h, file); err != nil {
+		return Hash{}, err
+	}
+	return Hash(h.Sum(nil)), nil
+}
+
+// untracked returns the path of a file that's neither tracked nor ignored, or ignored but not regenerable, or ""
+// if there is none.
+func (r *Repo) untracked(tracked Tracked, regenerable Regenerable) (string, error) {
+	rootIgnore, err := r.RootIgnore()
+	if err != nil {
+		return "", err
+	}
+	// ignores holds the patterns that apply to the files in each folder, by the path of the folder relative to the root.
+	ignores := map[string]*Ignore{".": rootIgnore}
+	// ignoredTracked holds the ignored folders that are walked since there are tracked files in them.
+	ignoredTracked := make(map[string]bool)
+	found := ""
+	err = filepath.WalkDir(r.Root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(r.Root, name)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		parent := path.Dir(rel)
+		ignored := ignoredTracked[parent] || ignores[parent].Ignored(rel, d.IsDir())
+		if tracked.Contains(rel) {
+			if d.IsDir() {
+				if ignored {
+					ignoredTracked[rel] = true
+				}
+				ignores[rel], err = ignores[parent].Nested(r.Root, rel)
+				if err != nil {
+					return err
+				}
+			}
+			if d.IsDir() && isSubmodule(name) {
+				// Submodules are checked on their own.
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if ignored && (regenerable == nil || regenerable(filepath.Dir(name), d)) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() && !ignored {
+			ignores[rel], err = ignores[parent].Nested(r.Root, rel)
+			return err
+		}
+		found = rel
+		return filepath.SkipAll
+	})
+	return found, err
+}
+
+func isSubmodule(dir string) bool {
+	_, err := os.Lstat(filepath.Join(dir, ".git"))
+	return err == nil
+}
+
+// Unpushed returns the name of a branch with commits that aren't on any of the remote-tracking refs, or "" if
+// everything has been pushed. A detached HEAD counts as a branch called HEAD, a stash counts as unpushed too and
+// so does a tag, by its full name, that points to a commit that isn't on any of the remote-tracking refs.
+// ErrNoRemote is returned if there are no remote-tracking refs to compare with.
+func (r *Repo) Unpushed() (string, error) {
+	refs, err := r.Refs()
+	if err != nil {
+		return "", err
+	}
+	if _, ok := refs["refs/stash"]; ok {
+		return "refs/stash", nil
+	}
+	local := make(map[string]Hash)
+	var remotes []Hash
+	for name, hash := range refs {
+		if strings.HasPrefix(name, "refs/heads/") {
+			local[name] = hash
+		} else if strings.HasPrefix(name, "refs/tags/") {
+			// There's no telling which tags the remote has, but a tag is as good as pushed if what it points to is.
+			commit, ok, err := r.peel(hash)
+			if err != nil {
+				return "", err
+			}
+			if ok {
+				local[name] = commit
+			}
+		} else if strings.HasPrefix(name, "refs/remotes/") {
+			remotes = append(remotes, hash)
+		}
+	}
+	if len(remotes) == 0 {
+		return "", ErrNoRemote
+	}
+	if head, hash, err := r.Head(); err == nil && head == "" {
+		local["HEAD"] = hash
+	}
+
+	targets := make(map[Hash]string)
+	for name, hash := range local {
+		targets[hash] = name
+	}
+	for _, hash := range remotes {
+		delete(targets, hash)
+	}
+	if len(targets) == 0 {
+		return "", nil
+	}
+	reached, err := r.reachable(remotes, targets)
+	if err != nil {
+		return "", err
+	}
+	for hash, name := range targets {
+		if !reached[hash] {
+			return strings.TrimPrefix(name, "refs/heads/"), nil
+		}
+	}
+	return "", nil
+}
+
+// peel returns the commit that hash points to, following annotated tags. It's false for tags of other objects.
+func (r *Repo) peel(hash Hash) (Hash, bool, error) {
+	for range maxDeltaDepth {
+		objectType, data, err := r.ReadObject(hash)
+		if err != nil {
+			return hash, false, err
+		}
+		switch objectType {
+		case ObjectCommit:
+			return hash, true, nil
+		case ObjectTag:
+			// An annotated tag starts with "object <hash>", the object it tags.
+			line, _, _ := bytes.Cut(data, []byte("\n"))
+			target, ok := bytes.CutPrefix(line, []byte("object "))
+			if !ok {
+				return hash, false, fmt.Errorf("object %s: invalid tag", hash)
+			}
+			if hash, err = ParseHash(string(target)); err != nil {
+				return hash, false, err
+			}
+		default:
+			return hash, false, nil
+		}
+	}
+	return hash, false, fmt.Errorf("object %s: too many nested tags", hash)
+}
+
+// clockSkew is how much older than its parent a commit is allowed to be, commits are timestamped by the
+// clock of whoever made them.
+const clockSkew = 24 * time.Hour
+
+// reachable walks the history from the commits in from and returns which of the targets it reaches. The walk
+// doesn't go further back than the oldest target, since the history of the targets is older than they are.
+func (r *Repo) reachable(from []Hash, targets map[Hash]string) (map[Hash]bool, error) {
+	oldest := time.Now()
+	for hash := range targets {
+		commit, err := r.ReadCommit(hash)
+		if err != nil {
+			return nil, err
+		}
+		if commit.Committed.Before(oldest) {
+			oldest = commit.Committed
+		}
+	}
+	cutoff := oldest.Add(-clockSkew)
+
+	reached := make(map[Hash]bool)
+	seen := make(map[Hash]bool)
+	queue := append([]Hash(nil), from...)
+	for len(queue) > 0 && len(reached) < len(targets) {
+		hash := queue[0]
+		queue = queue[1:]
+		if seen[hash] {
+			continue
+		}
+		seen[hash] = true
+		if _, ok := targets[hash]; ok {
+			reached[hash] = true
+		}
+		commit, err := r.ReadCommit(hash)
+		if errors.Is(err, ErrObjectNotFound) {
+			// The history of shallow clones ends abruptly.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if commit.Committed.Before(cutoff) {
+			continue
+		}
+		queue = append(queue, commit.Parents...)
+	}
+	return reached, nil
+}
@@ -0,0 +1,174 @@
+package git
+
+import (
+	"errors"
+	"github.com/sebastianappelberg/disk/internal/testutil"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newRepo creates a repository with a commit, its remote-tracking refs are those of the repository it's cloned from.
+func newRepo(t *testing.T) (string, *Repo) {
+	t.Helper()
+	origin := t.TempDir()
+	testutil.Git(t, origin, "init", "-q")
+	testutil.WriteFile(t, filepath.Join(origin, ".gitignore"), "build/\n")
+	testutil.WriteFile(t, filepath.Join(origin, "main.go"), "package main")
+	testutil.Git(t, origin, "add", ".")
+	testutil.Git(t, origin, "commit", "-q", "-m", "first")
+
+	root := filepath.Join(t.TempDir(), "clone")
+	testutil.Git(t, filepath.Dir(root), "clone", "-q", origin, root)
+	repo, err := Open(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return root, repo
+}
+
+func TestLocalChange(t *testing.T) {
+	root, repo := newRepo(t)
+	assertLocalChange := func(expected string) {
+		t.Helper()
+		got, err := repo.LocalChange(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != expected {
+			t.Errorf("LocalChange() = %q; want %q", got, expected)
+		}
+	}
+	assertLocalChange("")
+
+	// Ignored files and files that are only touched aren't changes.
+	testutil.WriteFile(t, filepath.Join(root, "build", "app"), "binary")
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(root, "main.go"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	assertLocalChange("")
+
+	testutil.WriteFile(t, filepath.Join(root, "main.go"), "package app")
+	assertLocalChange("main.go")
+	testutil.Git(t, root, "checkout", "main.go")
+	assertLocalChange("")
+
+	testutil.WriteFile(t, filepath.Join(root, "docs", "notes.md"), "notes")
+	assertLocalChange("docs/notes.md")
+}
+
+func TestLocalChangeIgnored(t *testing.T) {
+	root, repo := newRepo(t)
+	testutil.WriteFile(t, filepath.Join(root, ".git", "info", "exclude"), ".env\n")
+	regenerable := func(dir string, entry fs.DirEntry) bool {
+		return entry.Name() == "build"
+	}
+	testutil.WriteFile(t, filepath.Join(root, "build", "app"), "binary")
+	if got, err := repo.LocalChange(regenerable); err != nil || got != "" {
+		t.Errorf("LocalChange() = %q, %v; want the build output to be regenerable", got, err)
+	}
+	testutil.WriteFile(t, filepath.Join(root, ".env"), "SECRET=1")
+	if got, err := repo.LocalChange(regenerable); err != nil || got != ".env" {
+		t.Errorf("LocalChange() = %q, %v; want .env", got, err)
+	}
+}
+
+func TestUnpushed(t *testing.T) {
+	root, repo := newRepo(t)
+	assertUnpushed := func(expected string) {
+		t.Helper()
+		got, err := repo.Unpushed()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != expected {
+			t.Errorf("Unpushed() = %q; want %q", got, expected)
+		}
+	}
+	assertUnpushed("")
+
+	// A branch that's behind its remote has nothing unpushed.
+	testutil.Git(t, root, "commit", "-q", "--allow-empty", "-m", "second")
+	testutil.Git(t, root, "branch", "old", "HEAD~1")
+	testutil.Git(t, root, "push", "-q", "origin", "HEAD:refs/heads/pushed")
+	testutil.Git(t, root, "fetch", "-q")
+	assertUnpushed("")
+
+	testutil.Git(t, root, "commit", "-q", "--allow-empty", "-m", "third")
+	assertUnpushed("main")
+	testutil.Git(t, root, "push", "-q", "origin", "HEAD:refs/heads/pushed")
+	testutil.Git(t, root, "fetch", "-q")
+	// The packed history has to be read as well.
+	testutil.Git(t, root, "gc", "-q")
+	assertUnpushed("")
+
+	testutil.Git(t, root, "stash", "-q", "--include-untracked", "-m", "wip", "--", ".")
+	testutil.WriteFile(t, filepath.Join(root, "wip.go"), "package main")
+	testutil.Git(t, root, "stash", "-q", "--include-untracked")
+	assertUnpushed("refs/stash")
+}
+
+func TestUnpushedTags(t *testing.T) {
+	root, repo := newRepo(t)
+	testutil.Git(t, root, "tag", "pushed")
+	testutil.Git(t, root, "tag", "-a", "-m", "pushed", "annotated")
+	if got, err := repo.Unpushed(); err != nil || got != "" {
+		t.Errorf("Unpushed() = %q, %v; want the tags of pushed commits to be pushed", got, err)
+	}
+
+	// The commit of the tag is only on the tag once the branch is reset.
+	testutil.Git(t, root, "commit", "-q", "--allow-empty", "-m", "release")
+	testutil.Git(t, root, "tag", "-a", "-m", "release", "v1")
+	testutil.Git(t, root, "reset", "-q", "--hard", "HEAD~1")
+	testutil.Git(t, root, "gc", "-q")
+	if got, err := repo.Unpushed(); err != nil || got != "refs/tags/v1" {
+		t.Errorf("Unpushed() = %q, %v; want refs/tags/v1", got, err)
+	}
+}
+
+func TestUnpushedWithoutRemote(t *testing.T) {
+	root := t.TempDir()
+	testutil.Git(t, root, "init", "-q")
+	testutil.Git(t, root, "commit", "-q", "--allow-empty", "-m", "first")
+	repo, err := Open(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Unpushed(); !errors.Is(err, ErrNoRemote) {
+		t.Errorf("Unpushed() = %v; want ErrNoRemote", err)
+	}
+}
+
+func TestReadCommit(t *testing.T) {
+	root, repo := newRepo(t)
+	for _, packed := range []bool{false, true} {
+		if packed {
+			testutil.Git(t, root, "gc", "-q", "--aggressive")
+		}
+		ref, hash, err := repo.Head()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ref != "refs/heads/main" {
+			t.Errorf("Head() = %q; want refs/heads/main", ref)
+		}
+		commit, err := repo.ReadCommit(hash)
+		if err != nil {
+			t.Fatalf("ReadCommit(%s) with packed=%v: %v", hash, packed, err)
+		}
+		if time.Since(commit.Committed) > time.Hour || len(commit.Parents) != 0 {
+			t.Errorf("ReadCommit(%s) = %+v; want a recent commit without parents", hash, commit)
+		}
+	}
+	reflog, err := repo.LastReflogTime()
+	if err != nil || time.Since(reflog) > time.Hour {
+		t.Errorf("LastReflogTime() = %v, %v; want a recent time", reflog, err)
+	}
+	urls, err := repo.RemoteURLs()
+	if err != nil || urls["origin"] == "" {
+		t.Errorf("RemoteURLs() = %v, %v; want the URL of origin", urls, err)
+	}
+}
@@ -0,0 +1,244 @@
+// Package history keeps a journal of everything that disk has removed, so that it can be browsed and undone.
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sebastianappelberg/disk/pkg/trash"
+)
+
+const journalName = "history.jsonl"
+
+type Action string
+
+const (
+	// ActionRemove is an entry for a file that was put in the trash.
+	ActionRemove Action = "remove"
+	// ActionRestore is an entry for a file that was restored from the trash by undoing a session.
+	ActionRestore Action = "restore"
+)
+
+// Entry is a single line in the journal.
+type Entry struct {
+	Action    Action       `json:"action"`
+	Session   string       `json:"session"` // Session identifies the run of disk clean, or disk tree -i, that the file was removed in.
+	Timestamp time.Time    `json:"timestamp"`
+	Analyzer  string       `json:"analyzer,omitempty"`
+	Path      string       `json:"path"`  // Path is the path that was shown to the user.
+	Paths     []string     `json:"paths"` // Paths are the original paths of everything that was removed, or restored, for Path.
+	Trashed   []trash.Item `json:"trashed,omitempty"`
+	Size      int64        `json:"size"`
+	Error     string       `json:"error,omitempty"`
+}
+
+// Failed checks if the action failed.
+func (e Entry) Failed() bool {
+	return e.Error != ""
+}
+
+// Session is a group of entries that were removed during the same run of disk clean or disk tree -i.
+type Session struct {
+	ID      string
+	Start   time.Time
+	Entries []Entry // Entries holds the remove entries of the session in the order they were made.
+}
+
+// Size returns the number of bytes that were successfully removed in the session.
+func (s Session) Size() int64 {
+	total := int64(0)
+	for _, entry := range s.Entries {
+		if !entry.Failed() {
+			total += entry.Size
+		}
+	}
+	return total
+}
+
+// Journal is an append-only log of removals stored as JSON lines in the app directory.
+type Journal struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewJournal(dir string) *Journal {
+	return &Journal{path: filepath.Join(dir, journalName)}
+}
+
+// NewSessionID returns an ID for a new session. It's based on the current time, which makes it
+// readable and keeps the sessions ordered, and the process ID to make it unique between concurrent runs.
+func NewSessionID() string {
+	return time.Now().Format("20060102T150405") + "-" + strconv.Itoa(os.Getpid())
+}
+
+// Append writes the entry to the end of the journal.
+func (j *Journal) Append(entry Entry) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(j.path), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(j.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	// The entry is written with a single call to keep concurrent writers from interleaving lines.
+	_, err = file.Write(append(data, '\n'))
+	closeErr := file.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// Entries returns all entries in the journal, oldest first. Lines that can't be parsed are skipped,
+// since a crash while writing shouldn't make the rest of the history unreadable.
+func (j *Journal) Entries() ([]Entry, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	file, err := os.Open(j.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	// Entries for folders with a lot of paths can be long.
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry Entry
+		if json.Unmarshal(scanner.Bytes(), &entry) == nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// Sessions groups the remove entries of the journal by session, oldest first.
+func (j *Journal) Sessions() ([]Session, error) {
+	entries, err := j.Entries()
+	if err != nil {
+		return nil, err
+	}
+	return groupSessions(entries), nil
+}
+
+func groupSessions(entries []Entry) []Session {
+	var sessions []Session
+	index := make(map[string]int)
+	for _, entry := range entries {
+		if entry.Action != ActionRemove {
+			continue
+		}
+		i, ok := index[entry.Session]
+		if !ok {
+			i = len(sessions)
+			index[entry.Session] = i
+			sessions = append(sessions, Session{ID: entry.Session, Start: entry.Timestamp})
+		}
+		sessions[i].Entries = append(sessions[i].Entries, entry)
+	}
+	return sessions
+}
+
+// restoreItem is used to restore trashed items. It's a variable so that it can be replaced in tests.
+var restoreItem = trash.Restore
+
+// Undo restores the items of the n most recent sessions that still have items in the trash.
+// Every restore is written to the journal, which also makes sure that a session isn't undone twice.
+// The restore entries are returned, including the ones that failed.
+func (j *Journal) Undo(n int) ([]Entry, error) {
+	entries, err := j.Entries()
+	if err != nil {
+		return nil, err
+	}
+	restored := restoredItems(entries)
+	sessions := groupSessions(entries)
+
+	var result []Entry
+	for i := len(sessions) - 1; i >= 0 && n > 0; i-- {
+		sessionResult := j.undoSession(sessions[i], restored)
+		if len(sessionResult) > 0 {
+			result = append(result, sessionResult...)
+			n--
+		}
+	}
+	return result, nil
+}
+
+// undoSession restores the items of the session that haven't been restored yet, most recently removed first.
+func (j *Journal) undoSession(session Session, restored map[string]bool) []Entry {
+	var result []Entry
+	for i := len(session.Entries) - 1; i >= 0; i-- {
+		removal := session.Entries[i]
+		restore := Entry{
+			Action:   ActionRestore,
+			Session:  session.ID,
+			Analyzer: removal.Analyzer,
+			Path:     removal.Path,
+		}
+		for _, item := range removal.Trashed {
+			if restored[itemKey(item)] {
+				continue
+			}
+			err := restoreItem(item)
+			if err != nil {
+				restore.Error = fmt.Sprintf("error restoring %q: %v", item.OriginalPath, err)
+				break
+			}
+			restore.Paths = append(restore.Paths, item.OriginalPath)
+			restore.Trashed = append(restore.Trashed, item)
+			restore.Size += item.Size
+		}
+		if len(restore.Trashed) == 0 && !restore.Failed() {
+			// Everything has already been restored.
+			continue
+		}
+		// A failure to write the journal shouldn't stop the rest of the undo,
+		// at worst the next undo will try to restore the item again and fail.
+		_ = j.Append(restore)
+		result = append(result, restore)
+	}
+	return result
+}
+
+// restoredItems returns the items that have been restored by previous undos.
+func restoredItems(entries []Entry) map[string]bool {
+	restored := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.Action == ActionRestore {
+			for _, item := range entry.Trashed {
+				restored[itemKey(item)] = true
+			}
+		}
+	}
+	return restored
+}
+
+// itemKey identifies an item across the journal. The name alone isn't enough since names are
+// reused once an item has left the trash.
+func itemKey(item trash.Item) string {
+	return item.Name + "\x00" + item.OriginalPath + "\x00" + strconv.FormatInt(item.DeletedAt.UnixNano(), 10)
+}
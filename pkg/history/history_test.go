@@ -0,0 +1,177 @@
+package history
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sebastianappelberg/disk/pkg/trash"
+)
+
+func removal(session, name string, size int64) Entry {
+	path := "/home/user/src/" + name
+	return Entry{
+		Action:   ActionRemove,
+		Session:  session,
+		Analyzer: "clutter",
+		Path:     path,
+		Paths:    []string{path},
+		Trashed: []trash.Item{{
+			Name:         name,
+			OriginalPath: path,
+			DeletedAt:    time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			Size:         size,
+		}},
+		Size: size,
+	}
+}
+
+func stubRestore(t *testing.T, failing map[string]bool) *[]string {
+	t.Helper()
+	var restored []string
+	original := restoreItem
+	restoreItem = func(item trash.Item) error {
+		if failing[item.Name] {
+			return errors.New("restore failed")
+		}
+		restored = append(restored, item.Name)
+		return nil
+	}
+	t.Cleanup(func() { restoreItem = original })
+	return &restored
+}
+
+func TestJournal_AppendAndSessions(t *testing.T) {
+	journal := NewJournal(t.TempDir())
+	entries := []Entry{removal("a", "one", 1), removal("b", "two", 2), removal("a", "three", 3)}
+	failed := removal("b", "four", 4)
+	failed.Error = "permission denied"
+	entries = append(entries, failed)
+	for _, entry := range entries {
+		err := journal.Append(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sessions, err := journal.Sessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("got %d sessions, want 2", len(sessions))
+	}
+	if sessions[0].ID != "a" || len(sessions[0].Entries) != 2 || sessions[0].Size() != 4 {
+		t.Errorf("unexpected session: %+v", sessions[0])
+	}
+	// Failed removals don't count towards the size of the session.
+	if sessions[1].ID != "b" || sessions[1].Size() != 2 {
+		t.Errorf("unexpected session: %+v", sessions[1])
+	}
+	if sessions[0].Entries[0].Timestamp.IsZero() {
+		t.Error("expected Append to set the timestamp")
+	}
+}
+
+func TestJournal_SkipsCorruptLines(t *testing.T) {
+	dir := t.TempDir()
+	journal := NewJournal(dir)
+	err := journal.Append(removal("a", "one", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.OpenFile(filepath.Join(dir, journalName), os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString("{\"action\": \"rem\n")
+	file.Close()
+	err = journal.Append(removal("a", "two", 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := journal.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("got %d entries, want 2", len(entries))
+	}
+}
+
+func TestJournal_EntriesWithoutFile(t *testing.T) {
+	entries, err := NewJournal(t.TempDir()).Entries()
+	if err != nil || entries != nil {
+		t.Errorf("expected no entries and no error, got %v, %v", entries, err)
+	}
+}
+
+func TestJournal_Undo(t *testing.T) {
+	journal := NewJournal(t.TempDir())
+	for _, entry := range []Entry{removal("a", "one", 1), removal("b", "two", 2), removal("b", "three", 3)} {
+		err := journal.Append(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	restored := stubRestore(t, nil)
+
+	result, err := journal.Undo(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The most recent session is undone, most recent removal first.
+	if len(*restored) != 2 || (*restored)[0] != "three" || (*restored)[1] != "two" {
+		t.Errorf("unexpected restores: %v", *restored)
+	}
+	if len(result) != 2 || result[0].Action != ActionRestore || result[0].Session != "b" {
+		t.Errorf("unexpected result: %+v", result)
+	}
+
+	// Undoing again moves on to the previous session.
+	result, err = journal.Undo(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 1 || result[0].Session != "a" || len(*restored) != 3 {
+		t.Errorf("unexpected result: %+v, restored: %v", result, *restored)
+	}
+
+	// Nothing is left to undo.
+	result, err = journal.Undo(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 0 {
+		t.Errorf("expected nothing to undo, got %+v", result)
+	}
+}
+
+func TestJournal_UndoRetriesFailedRestores(t *testing.T) {
+	journal := NewJournal(t.TempDir())
+	err := journal.Append(removal("a", "one", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stubRestore(t, map[string]bool{"one": true})
+	result, err := journal.Undo(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 1 || !result[0].Failed() {
+		t.Fatalf("expected a failed restore, got %+v", result)
+	}
+
+	restored := stubRestore(t, nil)
+	result, err = journal.Undo(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 1 || result[0].Failed() || len(*restored) != 1 {
+		t.Errorf("expected the restore to be retried, got %+v", result)
+	}
+}
@@ -0,0 +1,196 @@
+// Package largefiles finds single files that are large and haven't been used in a while, such as a forgotten
+// disk image in Downloads.
+package largefiles
+
+import (
+	"context"
+	"github.com/sebastianappelberg/disk/pkg/config"
+	"github.com/sebastianappelberg/disk/pkg/storage"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	defaultMinSize = 500 * storage.MegaByte
+)
+
+const (
+	CategoryArchives   = "archives"
+	CategoryDiskImages = "disk-images"
+	CategoryInstallers = "installers"
+)
+
+// extensions maps the categories of files to their extensions.
+var extensions = map[string][]string{
+	CategoryArchives:   {".tar.gz", ".tar.bz2", ".tar.xz", ".tar.zst", ".tar", ".tgz", ".zip", ".gz", ".bz2", ".xz", ".zst", ".7z", ".rar"},
+	CategoryDiskImages: {".iso", ".img", ".vmdk", ".vdi", ".vhd", ".vhdx", ".qcow2", ".wim"},
+	CategoryInstallers: {".dmg", ".pkg", ".msi", ".msix", ".deb", ".rpm", ".appimage", ".apk"},
+}
+
+// Categories returns the names of the categories of files that the analyzer can be limited to.
+func Categories() []string {
+	categories := make([]string, 0, len(extensions))
+	for category := range extensions {
+		categories = append(categories, category)
+	}
+	slices.Sort(categories)
+	return categories
+}
+
+// Category returns the category of the file called name, or "" if it isn't in any of them.
+func Category(name string) string {
+	name = strings.ToLower(name)
+	for _, category := range Categories() {
+		for _, extension := range extensions[category] {
+			if strings.HasSuffix(name, extension) {
+				return category
+			}
+		}
+	}
+	return ""
+}
+
+// LargeFile is a file that's large and hasn't been used in a while.
+type LargeFile struct {
+	storage.File
+	// Category is one of the categories of files, or "" if it isn't in any of them.
+	Category string
+	// LastUsed is when the file was last modified or accessed, see WithAgeMode.
+	LastUsed time.Time
+}
+
+type AnalyzerOption func(*Analyzer)
+
+func WithMinAgeFilter(minAge time.Time) AnalyzerOption {
+	return func(a *Analyzer) {
+		a.minAge = minAge
+	}
+}
+
+// WithSizeFilter makes the analyzer only include files of at least size megabytes.
+func WithSizeFilter(size int) AnalyzerOption {
+	return func(a *Analyzer) {
+		if size >= 0 {
+			a.minSize = int64(size) * storage.MegaByte
+		}
+	}
+}
+
+// WithCategories limits the analyzer to files in the given categories, see Categories. All large files are
+// included if no categories are given.
+func WithCategories(categories ...string) AnalyzerOption {
+	return func(a *Analyzer) {
+		a.categories = categories
+	}
+}
+
+// WithProgress makes the analyzer count the directories and bytes it scans in progress.
+func WithProgress(progress *storage.Progress) AnalyzerOption {
+	return func(a *Analyzer) {
+		a.progress = progress
+	}
+}
+
+// WithOneFileSystem makes the analyzer stay on the file system that the root is on.
+func WithOneFileSystem() AnalyzerOption {
+	return func(a *Analyzer) {
+		a.oneFileSystem = true
+	}
+}
+
+// WithAgeMode decides whether the age filter applies to when the files were last modified, accessed or whichever
+// is the most recent.
+func WithAgeMode(mode storage.AgeMode) AnalyzerOption {
+	return func(a *Analyzer) {
+		a.ageMode = mode
+	}
+}
+
+// WithSizeMode decides whether the size filter applies to the allocated or the apparent size of the files.
+func WithSizeMode(mode storage.SizeMode) AnalyzerOption {
+	return func(a *Analyzer) {
+		a.sizeMode = mode
+	}
+}
+
+type Analyzer struct {
+	walker        *storage.FileWalker[LargeFile]
+	progress      *storage.Progress
+	oneFileSystem bool
+	categories    []string
+	minSize       int64
+	sizeMode      storage.SizeMode
+	minAge        time.Time
+	ageMode       storage.AgeMode
+}
+
+func NewAnalyzer(options ...AnalyzerOption) *Analyzer {
+	analyzer := &Analyzer{
+		minSize: defaultMinSize,
+		minAge:  time.Now().AddDate(0, 0, -90),
+	}
+	for _, option := range options {
+		option(analyzer)
+	}
+	walkerOptions := []storage.FileWalkerOption[LargeFile]{
+		storage.WithDecisionFilter[LargeFile](analyzer.decisionFilter),
+		storage.WithMapper(analyzer.largeFileMapper),
+		storage.WithProgress[LargeFile](analyzer.progress),
+	}
+	if analyzer.oneFileSystem {
+		walkerOptions = append(walkerOptions, storage.WithOneFileSystem[LargeFile]())
+	}
+	analyzer.walker = storage.NewFileWalker[LargeFile](walkerOptions...)
+	return analyzer
+}
+
+// decisionFilter includes the regular files that are above the size and age thresholds. Clutter folders are
+// skipped since the clutter analyzer suggests them as a whole.
+func (a *Analyzer) decisionFilter(file storage.File, siblings []os.DirEntry) storage.FilterDecision {
+	if _, ok := config.ClutterPatterns.Match(file.Base, file.Name, file.IsDir, siblings); ok {
+		return storage.Skip
+	}
+	if _, ok := config.UnsafePatterns.Match(file.Base, file.Name, file.IsDir, siblings); ok {
+		return storage.Skip
+	}
+	if file.Name == ".git" {
+		// A pack file is large but it's no good on its own, the repos analyzer suggests whole repositories.
+		return storage.Skip
+	}
+	if !file.IsRegular() || file.Usage().Size(a.sizeMode) < a.minSize || !a.lastUsed(file).Before(a.minAge) {
+		return storage.Continue
+	}
+	if len(a.categories) > 0 && !slices.Contains(a.categories, Category(file.Name)) {
+		return storage.Continue
+	}
+	return storage.Include
+}
+
+func (a *Analyzer) largeFileMapper(file storage.File, _ []os.DirEntry) LargeFile {
+	return LargeFile{File: file, Category: Category(file.Name), LastUsed: a.lastUsed(file)}
+}
+
+func (a *Analyzer) lastUsed(file storage.File) time.Time {
+	return a.ageMode.LastUsed(file.ModTime, file.AccessTime)
+}
+
+// Analyze returns the large files sorted by path.
+func (a *Analyzer) Analyze(ctx context.Context, root string) []LargeFile {
+	var files []LargeFile
+	for file := range a.Stream(ctx, root) {
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].GetPath() < files[j].GetPath()
+	})
+	return files
+}
+
+// Stream sends the large files on the returned channel as soon as they're found.
+// The channel is closed when the analysis is done or ctx is cancelled.
+func (a *Analyzer) Stream(ctx context.Context, root string) <-chan LargeFile {
+	return a.walker.GetFiles(ctx, root)
+}
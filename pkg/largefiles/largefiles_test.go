@@ -0,0 +1,89 @@
+package largefiles
+
+import (
+	"context"
+	"github.com/sebastianappelberg/disk/internal/testutil"
+	"github.com/sebastianappelberg/disk/pkg/config"
+	"github.com/sebastianappelberg/disk/pkg/storage"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	testutil.Main(m, config.SetAppDir)
+}
+
+func TestCategory(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"ubuntu-24.04-desktop-amd64.iso", CategoryDiskImages},
+		{"backup.tar.gz", CategoryArchives},
+		{"Photos.ZIP", CategoryArchives},
+		{"Docker.dmg", CategoryInstallers},
+		{"setup.msi", CategoryInstallers},
+		{"movie.mkv", ""},
+	}
+	for _, test := range tests {
+		if got := Category(test.name); got != test.expected {
+			t.Errorf("Category(%q) = %q; want %q", test.name, got, test.expected)
+		}
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	root := t.TempDir()
+	old := time.Now().AddDate(0, 0, -100)
+	files := []struct {
+		name    string
+		size    int64
+		modTime time.Time
+	}{
+		{"Downloads/ubuntu.iso", 2 * storage.MegaByte, old},
+		{"Downloads/backup.tar.gz", 2 * storage.MegaByte, old},
+		{"Downloads/recording.raw", 2 * storage.MegaByte, old},
+		{"Downloads/new.iso", 2 * storage.MegaByte, time.Now()},
+		{"Downloads/small.iso", storage.KiloByte, old},
+		{"web/package.json", 2, old},
+		{"web/node_modules/big.zip", 2 * storage.MegaByte, old},
+	}
+	for _, file := range files {
+		path := filepath.Join(root, file.name)
+		testutil.WriteFile(t, path, "")
+		// Sparse files are large enough for the apparent size.
+		if err := os.Truncate(path, file.size); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, file.modTime, file.modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		categories []string
+		expected   []string
+	}{
+		{nil, []string{"Downloads/backup.tar.gz:archives", "Downloads/recording.raw:", "Downloads/ubuntu.iso:disk-images"}},
+		{[]string{CategoryDiskImages, CategoryInstallers}, []string{"Downloads/ubuntu.iso:disk-images"}},
+	}
+	for _, test := range tests {
+		analyzer := NewAnalyzer(
+			WithSizeFilter(1),
+			WithSizeMode(storage.ApparentSize),
+			WithMinAgeFilter(time.Now().AddDate(0, 0, -90)),
+			WithCategories(test.categories...),
+		)
+		var got []string
+		for _, file := range analyzer.Analyze(context.Background(), root) {
+			rel, _ := filepath.Rel(root, file.GetPath())
+			got = append(got, filepath.ToSlash(rel)+":"+file.Category)
+		}
+		if !slices.Equal(got, test.expected) {
+			t.Errorf("Analyze() with categories %v = %v; want %v", test.categories, got, test.expected)
+		}
+	}
+}
@@ -1,9 +1,10 @@
 package media
 
 import (
-	"fmt"
+	"context"
 	"github.com/sebastianappelberg/disk/pkg/torrents"
 	"github.com/sebastianappelberg/mathx"
+	"log"
 	"sort"
 	"strconv"
 	"sync"
@@ -12,47 +13,16 @@ import (
 // CheckAvailability analyzes the availability of a given list of content.
 // Availability as defined by how easy it'd be to get a hold of the content.
 func CheckAvailability(content []Media) []Media {
-	var wg sync.WaitGroup
-	wg.Add(len(content))
-	sem := make(chan struct{}, 20)
-	result := make(chan Media)
-
-	for _, c := range content {
-		go func(ct Media) {
-			sem <- struct{}{}
-			defer func() { <-sem }()
-			defer wg.Done()
-			defer func() { result <- ct }()
-			query := ct.String()
-			torrentsResult, err := torrents.Search(query)
-			if err != nil {
-				fmt.Printf("Error searching torrents: %v\n", err)
-				return
-			}
-			total := 0
-			maxTorrentsLength := 3
-			if ct.Type == Series {
-				maxTorrentsLength = 10
-			}
-			torrentsLength := mathx.Min(maxTorrentsLength, len(torrentsResult))
-			for _, torrent := range torrentsResult[:torrentsLength] {
-				seeders, err := strconv.Atoi(torrent.Seeders)
-				if err == nil {
-					total += seeders
-				}
-			}
-			average := float64(total) / float64(torrentsLength)
-			ct.AvailabilityScore = average
-		}(c)
-	}
-
+	contentCh := make(chan Media)
 	go func() {
-		wg.Wait()
-		close(result)
+		defer close(contentCh)
+		for _, c := range content {
+			contentCh <- c
+		}
 	}()
 
 	i := 0
-	for res := range result {
+	for res := range streamAvailability(context.Background(), contentCh) {
 		// Re-use the input slice instead of allocating a new one.
 		content[i] = res
 		i++
@@ -62,3 +32,57 @@ func CheckAvailability(content []Media) []Media {
 	})
 	return content
 }
+
+// streamAvailability checks the availability of the content as it's received and sends it on the
+// returned channel as soon as it's been checked. The channel is closed once contentCh is closed and
+// all content has been checked. Content that's checked after ctx is cancelled is dropped.
+func streamAvailability(ctx context.Context, contentCh <-chan Media) <-chan Media {
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, 20)
+	result := make(chan Media)
+
+	go func() {
+		for c := range contentCh {
+			wg.Add(1)
+			go func(ct Media) {
+				sem <- struct{}{}
+				defer func() { <-sem }()
+				defer wg.Done()
+				if ctx.Err() != nil {
+					return
+				}
+				ct.AvailabilityScore = availabilityScore(ct)
+				select {
+				case result <- ct:
+				case <-ctx.Done():
+				}
+			}(c)
+		}
+		wg.Wait()
+		close(result)
+	}()
+	return result
+}
+
+// availabilityScore returns the average number of seeders of the top search results for the content.
+func availabilityScore(ct Media) float64 {
+	query := ct.String()
+	torrentsResult, err := torrents.Search(query)
+	if err != nil {
+		log.Printf("Error searching torrents: %v", err)
+		return 0
+	}
+	total := 0
+	maxTorrentsLength := 3
+	if ct.Type == Series {
+		maxTorrentsLength = 10
+	}
+	torrentsLength := mathx.Min(maxTorrentsLength, len(torrentsResult))
+	for _, torrent := range torrentsResult[:torrentsLength] {
+		seeders, err := strconv.Atoi(torrent.Seeders)
+		if err == nil {
+			total += seeders
+		}
+	}
+	return float64(total) / float64(torrentsLength)
+}
@@ -1,6 +1,7 @@
 package media
 
 import (
+	"context"
 	"fmt"
 	"github.com/sebastianappelberg/disk/pkg/config"
 	"github.com/sebastianappelberg/disk/pkg/storage"
@@ -26,7 +27,8 @@ type Media struct {
 	Path              string
 	Season            int
 	Year              int
-	Size              int64
+	Size              int64 // Size is the apparent size of the media.
+	Allocated         int64 // Allocated is the disk space that the media uses.
 	ModTime           time.Time
 	Type              Type
 	AvailabilityScore float64
@@ -41,6 +43,11 @@ func (m Media) GetPaths() []string {
 	return []string{m.GetPath()}
 }
 
+// Usage returns both the allocated and the apparent size of the media.
+func (m Media) Usage() storage.Usage {
+	return storage.Usage{Allocated: m.Allocated, Apparent: m.Size}
+}
+
 func (m Media) String() string {
 	if m.Type == Movie {
 		return fmt.Sprintf("%s %d", m.Title, m.Year)
@@ -51,25 +58,58 @@ func (m Media) String() string {
 	return fmt.Sprintf("%s", m.Title)
 }
 
+type AnalyzerOption func(*Analyzer)
+
+// WithProgress makes the analyzer count the directories and bytes it scans in progress.
+func WithProgress(progress *storage.Progress) AnalyzerOption {
+	return func(a *Analyzer) {
+		a.progress = progress
+	}
+}
+
+// WithOneFileSystem makes the analyzer stay on the file system that the root is on.
+func WithOneFileSystem() AnalyzerOption {
+	return func(a *Analyzer) {
+		a.oneFileSystem = true
+	}
+}
+
 type Analyzer struct {
 	walker                     *storage.FileWalker[Media]
 	sizeCalculator             *storage.SizeCalculator
+	progress                   *storage.Progress
+	oneFileSystem              bool
 	availabilityScoreThreshold float64
 }
 
-func NewAnalyzer() *Analyzer {
-	return &Analyzer{
-		walker: storage.NewFileWalker[Media](
-			storage.WithDecisionFilter[Media](decisionFilter),
-			storage.WithMapper(contentMapper),
-		),
-		sizeCalculator:             storage.NewSizeCalculator(),
+func NewAnalyzer(options ...AnalyzerOption) *Analyzer {
+	analyzer := &Analyzer{
 		availabilityScoreThreshold: 15,
 	}
+	for _, option := range options {
+		option(analyzer)
+	}
+	walkerOptions := []storage.FileWalkerOption[Media]{
+		storage.WithDecisionFilter[Media](decisionFilter),
+		storage.WithMapper(contentMapper),
+		storage.WithProgress[Media](analyzer.progress),
+	}
+	var sizeWalkerOptions []storage.FileWalkerOption[storage.File]
+	if analyzer.oneFileSystem {
+		walkerOptions = append(walkerOptions, storage.WithOneFileSystem[Media]())
+		sizeWalkerOptions = append(sizeWalkerOptions, storage.WithOneFileSystem[storage.File]())
+	}
+	analyzer.walker = storage.NewFileWalker[Media](walkerOptions...)
+	// Series are already counted by the walker so the size calculator doesn't report any progress.
+	analyzer.sizeCalculator = storage.NewSizeCalculator(storage.WithWalkerOptions(sizeWalkerOptions...))
+	return analyzer
 }
 
-func decisionFilter(file storage.File) storage.FilterDecision {
-	if config.ClutterFolders[file.Name] || config.UnsafeFolders[file.Name] {
+func decisionFilter(file storage.File, siblings []os.DirEntry) storage.FilterDecision {
+	if _, ok := config.ClutterPatterns.Match(file.Base, file.Name, file.IsDir, siblings); ok {
+		return storage.Skip
+	}
+	if _, ok := config.UnsafePatterns.Match(file.Base, file.Name, file.IsDir, siblings); ok {
 		return storage.Skip
 	}
 	if isMediaFile(file.Name) {
@@ -80,10 +120,11 @@ func decisionFilter(file storage.File) storage.FilterDecision {
 
 func contentMapper(file storage.File, siblings []os.DirEntry) Media {
 	content := Media{
-		Size:    file.Size,
-		ModTime: file.ModTime,
-		Base:    file.Base,
-		Path:    file.GetPath(),
+		Size:      file.Size,
+		Allocated: file.Allocated,
+		ModTime:   file.ModTime,
+		Base:      file.Base,
+		Path:      file.GetPath(),
 	}
 	inSeasonFolder := hasMultipleMediaFiles(siblings)
 
@@ -139,28 +180,10 @@ func hasMultipleMediaFiles(entries []os.DirEntry) bool {
 }
 
 // Analyze returns a sorted list of candidates to delete.
-func (a *Analyzer) Analyze(root string) []Media {
-	contentCh := a.walker.GetFiles(root)
-
-	seen := make(map[string]bool)
-	var contents []Media
-	for content := range contentCh {
-		key := content.Title + strconv.Itoa(content.Season) + strconv.Itoa(content.Year)
-		if !seen[key] {
-			contents = append(contents, content)
-			seen[key] = true
-		}
-	}
-
-	contentWithAvailability := CheckAvailability(contents)
+func (a *Analyzer) Analyze(ctx context.Context, root string) []Media {
 	var result []Media
-	for _, content := range contentWithAvailability {
-		if content.AvailabilityScore > a.availabilityScoreThreshold {
-			if content.Type == Series {
-				content.Size = a.sizeCalculator.GetSize(content.GetPath())
-			}
-			result = append(result, content)
-		}
+	for content := range a.Stream(ctx, root) {
+		result = append(result, content)
 	}
 
 	sort.Slice(result, func(i, j int) bool {
@@ -169,6 +192,47 @@ func (a *Analyzer) Analyze(root string) []Media {
 	return result
 }
 
+// Stream sends the candidates to delete on the returned channel as soon as their availability has been checked.
+// The channel is closed when the analysis is done or ctx is cancelled.
+func (a *Analyzer) Stream(ctx context.Context, root string) <-chan Media {
+	contentCh := a.walker.GetFiles(ctx, root)
+
+	// Every episode of a season is found separately so only the first one is checked.
+	uniqueCh := make(chan Media)
+	go func() {
+		defer close(uniqueCh)
+		seen := make(map[string]bool)
+		for content := range contentCh {
+			key := content.Title + strconv.Itoa(content.Season) + strconv.Itoa(content.Year)
+			if !seen[key] {
+				select {
+				case uniqueCh <- content:
+				case <-ctx.Done():
+				}
+				seen[key] = true
+			}
+		}
+	}()
+
+	ch := make(chan Media)
+	go func() {
+		defer close(ch)
+		for content := range streamAvailability(ctx, uniqueCh) {
+			if content.AvailabilityScore > a.availabilityScoreThreshold {
+				if content.Type == Series {
+					size := a.sizeCalculator.GetSize(ctx, content.GetPath())
+					content.Size, content.Allocated = size.Apparent, size.Allocated
+				}
+				select {
+				case ch <- content:
+				case <-ctx.Done():
+				}
+			}
+		}
+	}()
+	return ch
+}
+
 // isMediaFile checks if the file is one of mp4, mkv, avi, mov, flv, wmv, webm, mp3, wav or flac.
 // It doesn't deal with mixed-case filepath extensions for example: wAv. The reason being that
 // this function is called a lot of times in a performance sensitive section and lower-casing
@@ -0,0 +1,284 @@
+// Package repos finds git repositories that haven't been touched in a while and that can be cloned again
+// without losing anything, since everything in them has been pushed and everything else is clutter.
+package repos
+
+import (
+	"context"
+	"github.com/sebastianappelberg/disk/pkg/config"
+	"github.com/sebastianappelberg/disk/pkg/git"
+	"github.com/sebastianappelberg/disk/pkg/storage"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMinSize = 50 * storage.MegaByte
+)
+
+// Repo is a repository that's safe to remove and clone again.
+type Repo struct {
+	Path      string
+	Size      int64 // Size is the apparent size of the repository, working tree included.
+	Allocated int64 // Allocated is the disk space that the repository uses.
+	// LastActivity is the time of the last commit, checkout or change to the index, whichever came last.
+	LastActivity time.Time
+	// URL is the URL of the remote the repository can be cloned from, origin if there is one.
+	URL string
+}
+
+func (r Repo) GetPath() string {
+	return r.Path
+}
+
+func (r Repo) GetPaths() []string {
+	return []string{r.Path}
+}
+
+// Usage returns both the allocated and the apparent size of the repository.
+func (r Repo) Usage() storage.Usage {
+	return storage.Usage{Allocated: r.Allocated, Apparent: r.Size}
+}
+
+type AnalyzerOption func(*Analyzer)
+
+// WithMinAgeFilter makes the analyzer only include repositories without any activity after minAge.
+func WithMinAgeFilter(minAge time.Time) AnalyzerOption {
+	return func(a *Analyzer) {
+		a.minAge = minAge
+	}
+}
+
+func WithSizeFilter(size int) AnalyzerOption {
+	return func(a *Analyzer) {
+		if size >= 0 {
+			a.minSize = int64(size) * storage.MegaByte
+		}
+	}
+}
+
+// WithProgress makes the analyzer count the directories and bytes it scans in progress.
+func WithProgress(progress *storage.Progress) AnalyzerOption {
+	return func(a *Analyzer) {
+		a.progress = progress
+	}
+}
+
+// WithOneFileSystem makes the analyzer stay on the file system that the root is on.
+func WithOneFileSystem() AnalyzerOption {
+	return func(a *Analyzer) {
+		a.oneFileSystem = true
+	}
+}
+
+// WithSizeMode decides whether the size filter applies to the allocated or the apparent size of the repositories.
+func WithSizeMode(mode storage.SizeMode) AnalyzerOption {
+	return func(a *Analyzer) {
+		a.sizeMode = mode
+	}
+}
+
+type Analyzer struct {
+	walker         *storage.FileWalker[storage.File]
+	sizeCalculator *storage.SizeCalculator
+	progress       *storage.Progress
+	oneFileSystem  bool
+	minSize        int64
+	sizeMode       storage.SizeMode
+	minAge         time.Time
+}
+
+func NewAnalyzer(options ...AnalyzerOption) *Analyzer {
+	analyzer := &Analyzer{
+		minSize: defaultMinSize,
+		minAge:  time.Now().AddDate(0, 0, -90),
+	}
+	for _, option := range options {
+		option(analyzer)
+	}
+	walkerOptions := []storage.FileWalkerOption[storage.File]{
+		storage.WithDecisionFilter[storage.File](decisionFilter),
+		storage.WithMapper(storage.IdentityMapper),
+		storage.WithProgress[storage.File](analyzer.progress),
+	}
+	var sizeWalkerOptions []storage.FileWalkerOption[storage.File]
+	if analyzer.oneFileSystem {
+		walkerOptions = append(walkerOptions, storage.WithOneFileSystem[storage.File]())
+		sizeWalkerOptions = append(sizeWalkerOptions, storage.WithOneFileSystem[storage.File]())
+	}
+	analyzer.walker = storage.NewFileWalker[storage.File](walkerOptions...)
+	analyzer.sizeCalculator = storage.NewSizeCalculator(
+		storage.WithSizeProgress(analyzer.progress),
+		storage.WithWalkerOptions(sizeWalkerOptions...),
+	)
+	return analyzer
+}
+
+// decisionFilter includes .git folders and skips the rest of the repository they're in, since a repository
+// inside another one goes along with it.
+func decisionFilter(file storage.File, siblings []os.DirEntry) storage.FilterDecision {
+	if hasGitDir(siblings) {
+		if file.Name == ".git" && file.IsDir {
+			return storage.Include | storage.Skip
+		}
+		return storage.Skip
+	}
+	if _, ok := config.ClutterPatterns.Match(file.Base, file.Name, file.IsDir, siblings); ok {
+		return storage.Skip
+	}
+	if _, ok := config.UnsafePatterns.Match(file.Base, file.Name, file.IsDir, siblings); ok {
+		return storage.Skip
+	}
+	return storage.Continue
+}
+
+// hasGitDir reports whether there's a .git folder among siblings. Worktrees and submodules have a .git file
+// instead, they can't be cloned on their own.
+func hasGitDir(siblings []os.DirEntry) bool {
+	for _, sibling := range siblings {
+		if sibling.Name() == ".git" && sibling.IsDir() {
+			return true
+		}
+	}
+	return false
+}
+
+// Analyze returns the repositories that are safe to clone again, sorted by path.
+func (a *Analyzer) Analyze(ctx context.Context, root string) []Repo {
+	var repos []Repo
+	for repo := range a.Stream(ctx, root) {
+		repos = append(repos, repo)
+	}
+	sort.Slice(repos, func(i, j int) bool {
+		return repos[i].Path < repos[j].Path
+	})
+	return repos
+}
+
+// Stream sends the repositories that are safe to clone again on the returned channel as soon as they're found.
+// The channel is closed when the analysis is done or ctx is cancelled.
+func (a *Analyzer) Stream(ctx context.Context, root string) <-chan Repo {
+	gitDirs := a.walker.GetFiles(ctx, root)
+	ch := make(chan Repo)
+	go func() {
+		var wg sync.WaitGroup
+		for gitDir := range gitDirs {
+			wg.Add(1)
+			go func(path string) {
+				defer wg.Done()
+				repo, ok := a.inspect(ctx, path)
+				if !ok {
+					return
+				}
+				select {
+				case ch <- repo:
+				case <-ctx.Done():
+				}
+			}(gitDir.Base)
+		}
+		wg.Wait()
+		a.sizeCalculator.Close()
+		close(ch)
+	}()
+	return ch
+}
+
+// inspect returns the repository with the working tree in path if it's safe to clone again. The cheap checks
+// come first, comparing the working tree to the index can mean hashing files.
+func (a *Analyzer) inspect(ctx context.Context, path string) (Repo, bool) {
+	repo, err := git.Open(path)
+	if err != nil {
+		return Repo{}, false
+	}
+	lastActivity, err := lastActivity(repo)
+	if err != nil || !lastActivity.Before(a.minAge) {
+		return Repo{}, false
+	}
+	if hasWorktrees(repo) {
+		// The worktrees elsewhere would lose their repository.
+		return Repo{}, false
+	}
+	// Repositories without a remote have nowhere to be cloned from.
+	if unpushed, err := repo.Unpushed(); err != nil || unpushed != "" {
+		return Repo{}, false
+	}
+	// Ignored files such as .env files and local databases would be lost, unlike build output and dependencies.
+	if changed, err := repo.LocalChange(isClutter); err != nil || changed != "" {
+		return Repo{}, false
+	}
+	size := a.sizeCalculator.GetSize(ctx, path)
+	if size.Size(a.sizeMode) < a.minSize {
+		return Repo{}, false
+	}
+	return Repo{
+		Path:         path,
+		Size:         size.Apparent,
+		Allocated:    size.Allocated,
+		LastActivity: lastActivity,
+		URL:          remoteURL(repo),
+	}, true
+}
+
+// lastActivity returns the time of the last commit, the last entry in the reflog or the last change to the index,
+// whichever is newest. Empty repositories don't have a commit and are left alone.
+func lastActivity(repo *git.Repo) (time.Time, error) {
+	_, head, err := repo.Head()
+	if err != nil {
+		return time.Time{}, err
+	}
+	commit, err := repo.ReadCommit(head)
+	if err != nil {
+		return time.Time{}, err
+	}
+	last := commit.Committed
+	reflog, err := repo.LastReflogTime()
+	if err != nil {
+		return time.Time{}, err
+	}
+	if reflog.After(last) {
+		last = reflog
+	}
+	if info, err := os.Stat(filepath.Join(repo.GitDir, "index")); err == nil && info.ModTime().After(last) {
+		last = info.ModTime()
+	}
+	return last, nil
+}
+
+// isClutter reports whether an ignored file in dir is clutter, which can be regenerated after the repository is cloned
+// again.
+func isClutter(dir string, entry fs.DirEntry) bool {
+	siblings, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	_, ok := config.ClutterPatterns.Match(dir, entry.Name(), entry.IsDir(), siblings)
+	return ok
+}
+
+func hasWorktrees(repo *git.Repo) bool {
+	entries, err := os.ReadDir(filepath.Join(repo.CommonDir, "worktrees"))
+	return err == nil && len(entries) > 0
+}
+
+// remoteURL returns the URL of origin, or of the first remote by name if there's no origin.
+func remoteURL(repo *git.Repo) string {
+	urls, err := repo.RemoteURLs()
+	if err != nil {
+		return ""
+	}
+	if url, ok := urls["origin"]; ok {
+		return url
+	}
+	names := make([]string, 0, len(urls))
+	for name := range urls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		return ""
+	}
+	return urls[names[0]]
+}
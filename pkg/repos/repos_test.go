@@ -0,0 +1,57 @@
+package repos
+
+import (
+	"context"
+	"github.com/sebastianappelberg/disk/internal/testutil"
+	"github.com/sebastianappelberg/disk/pkg/config"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	testutil.Main(m, config.SetAppDir)
+}
+
+func TestAnalyze(t *testing.T) {
+	root := t.TempDir()
+	origin := filepath.Join(root, "origin")
+
+	testutil.WriteFile(t, filepath.Join(origin, "main.go"), "package main")
+	testutil.Git(t, origin, "init", "-q")
+	testutil.Git(t, origin, "add", ".")
+	testutil.Git(t, origin, "commit", "-q", "-m", "first")
+	for _, clone := range []string{"src/clean", "src/built", "src/changed", "src/secrets", "src/unpushed", "web/node_modules/dep"} {
+		testutil.Git(t, root, "clone", "-q", origin, filepath.Join(root, clone))
+	}
+	testutil.WriteFile(t, filepath.Join(root, "src/changed/main.go"), "package changed")
+	// Repositories in clutter folders are left to the clutter analyzer.
+	testutil.WriteFile(t, filepath.Join(root, "web/package.json"), "{}")
+	testutil.Git(t, filepath.Join(root, "src/unpushed"), "commit", "-q", "--allow-empty", "-m", "second")
+	// Ignored clutter can be regenerated, other ignored files would be lost.
+	testutil.WriteFile(t, filepath.Join(root, "src/built/.git/info/exclude"), "__pycache__/\n")
+	testutil.WriteFile(t, filepath.Join(root, "src/built/__pycache__/main.pyc"), "bytecode")
+	testutil.WriteFile(t, filepath.Join(root, "src/secrets/.git/info/exclude"), ".env\n")
+	testutil.WriteFile(t, filepath.Join(root, "src/secrets/.env"), "SECRET=1")
+
+	analyzer := NewAnalyzer(WithSizeFilter(0), WithMinAgeFilter(time.Now().Add(time.Hour)))
+	var got []string
+	for _, repo := range analyzer.Analyze(context.Background(), root) {
+		rel, _ := filepath.Rel(root, repo.Path)
+		got = append(got, filepath.ToSlash(rel))
+		if repo.URL != origin || repo.Size == 0 {
+			t.Errorf("Analyze() = %+v; want the URL of origin and a size", repo)
+		}
+	}
+	// origin doesn't have a remote to be cloned from.
+	expected := []string{"src/built", "src/clean"}
+	if !slices.Equal(got, expected) {
+		t.Errorf("Analyze() = %v; want %v", got, expected)
+	}
+
+	analyzer = NewAnalyzer(WithSizeFilter(0))
+	if repos := analyzer.Analyze(context.Background(), root); len(repos) != 0 {
+		t.Errorf("Analyze() = %v; want no repositories that were just used", repos)
+	}
+}
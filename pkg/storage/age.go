@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AgeMode decides which time tells when a file was last used.
+type AgeMode int
+
+const (
+	// ModTimeAge is the time the file was last modified, i.e. written, which isn't when it was last read.
+	ModTimeAge AgeMode = iota
+	// AccessTimeAge is the time the file was last accessed, or modified where the access time isn't known.
+	AccessTimeAge
+	// NewestAge is whichever of the two is the most recent.
+	NewestAge
+)
+
+const (
+	AgeModeModTime    = "mtime"
+	AgeModeAccessTime = "atime"
+	AgeModeNewest     = "newest"
+)
+
+var AgeModes = []string{AgeModeModTime, AgeModeAccessTime, AgeModeNewest}
+
+func ParseAgeMode(mode string) (AgeMode, error) {
+	switch mode {
+	case AgeModeModTime:
+		return ModTimeAge, nil
+	case AgeModeAccessTime:
+		return AccessTimeAge, nil
+	case AgeModeNewest:
+		return NewestAge, nil
+	}
+	return 0, fmt.Errorf("unsupported age mode %q, expected one of %s", mode, strings.Join(AgeModes, ", "))
+}
+
+// LastUsed returns when a file was last used given when it was modified and accessed. The access time is zero
+// when it isn't known, in which case the modification time is used.
+func (m AgeMode) LastUsed(modTime time.Time, accessTime time.Time) time.Time {
+	switch {
+	case m == ModTimeAge || accessTime.IsZero():
+		return modTime
+	case m == AccessTimeAge || accessTime.After(modTime):
+		return accessTime
+	}
+	return modTime
+}
@@ -0,0 +1,12 @@
+//go:build darwin
+
+package storage
+
+import (
+	"syscall"
+	"time"
+)
+
+func accessTime(stat *syscall.Stat_t) time.Time {
+	return time.Unix(stat.Atimespec.Unix())
+}
@@ -0,0 +1,13 @@
+//go:build !windows && !linux && !darwin
+
+package storage
+
+import (
+	"syscall"
+	"time"
+)
+
+// accessTime returns the zero time since the access time isn't read on other platforms.
+func accessTime(_ *syscall.Stat_t) time.Time {
+	return time.Time{}
+}
@@ -33,3 +33,17 @@ func GetAvailableDisks() ([]string, error) {
 
 	return mounts, nil
 }
+
+// AccessTimeOption returns "noatime" if the file system that path is on doesn't update access times,
+// and "" otherwise since how often they're updated isn't known.
+func AccessTimeOption(path string) (string, error) {
+	var stat unix.Statfs_t
+	err := unix.Statfs(path, &stat)
+	if err != nil {
+		return "", err
+	}
+	if stat.Flags&unix.MNT_NOATIME != 0 {
+		return "noatime", nil
+	}
+	return "", nil
+}
@@ -4,7 +4,9 @@ package storage
 
 import (
 	"bufio"
+	"io"
 	"os"
+	"path/filepath"
 	"strings"
 )
 
@@ -31,3 +33,51 @@ func GetAvailableDisks() ([]string, error) {
 	}
 	return disks, nil
 }
+
+// AccessTimeOption returns how the file system that path is on updates access times: "noatime" if it doesn't,
+// "relatime" if it only does so once a day, which is good enough to tell how long ago something was used,
+// or "strictatime" if it does so on every read.
+func AccessTimeOption(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	file, err := os.Open("/proc/mounts")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	return parseAccessTimeOption(file, path)
+}
+
+// parseAccessTimeOption finds the options of the mount point closest to path in mounts, which is in the format
+// of /proc/mounts.
+func parseAccessTimeOption(mounts io.Reader, path string) (string, error) {
+	mountPoint := ""
+	option := ""
+	scanner := bufio.NewScanner(mounts)
+	for scanner.Scan() {
+		// A line looks like "/dev/sda1 / ext4 rw,relatime 0 0". Spaces in the mount point are escaped as \040.
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+		dir := strings.ReplaceAll(fields[1], `\040`, " ")
+		if !isUnder(path, dir) || len(dir) < len(mountPoint) {
+			continue
+		}
+		// Later mounts on the same mount point hide the earlier ones.
+		mountPoint = dir
+		option = "strictatime"
+		for _, flag := range strings.Split(fields[3], ",") {
+			if flag == "noatime" || flag == "relatime" {
+				option = flag
+			}
+		}
+	}
+	return option, scanner.Err()
+}
+
+func isUnder(path string, dir string) bool {
+	return dir == "/" || path == dir || strings.HasPrefix(path, dir+"/")
+}
@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseAccessTimeOption(t *testing.T) {
+	mounts := `/dev/sda1 / ext4 rw,relatime 0 0
+/dev/sda2 /home ext4 rw,noatime 0 0
+/dev/sda3 /home/user/my\040disk ext4 rw 0 0
+/dev/sda4 /home/user/data xfs rw,relatime 0 0
+/dev/sda5 /home/user/data xfs rw,strictatime 0 0
+`
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"/var/cache", "relatime"},
+		{"/home/user/src", "noatime"},
+		{"/homework", "relatime"},
+		{"/home/user/my disk/src", "strictatime"},
+		{"/home/user/data", "strictatime"},
+	}
+	for _, test := range tests {
+		got, err := parseAccessTimeOption(strings.NewReader(mounts), test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.expected {
+			t.Errorf("parseAccessTimeOption(%q) = %q; want %q", test.path, got, test.expected)
+		}
+	}
+}
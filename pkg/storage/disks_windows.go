@@ -23,3 +23,8 @@ func GetAvailableDisks() ([]string, error) {
 	}
 	return disks, nil
 }
+
+// AccessTimeOption returns "" since whether NTFS updates access times is a system-wide setting that isn't read.
+func AccessTimeOption(_ string) (string, error) {
+	return "", nil
+}
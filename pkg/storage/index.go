@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"context"
+	"github.com/sebastianappelberg/disk/pkg/cache"
+	"github.com/sebastianappelberg/disk/pkg/config"
+	"github.com/sebastianappelberg/disk/pkg/util"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	indexName = "index"
+	// indexTTL is how long directories that aren't scanned stay in the index.
+	indexTTL = 90 * 24 * time.Hour
+	// indexEntryVersion is bumped when indexEntry changes in a way that makes the entries already in the index stale.
+	indexEntryVersion = 2
+)
+
+// indexEntry is what the index knows about a directory. It changes when the mtime of the directory changes, i.e.
+// when something in it is added, removed or renamed. Writing to a file that's already there doesn't change the
+// mtime of the directory, so a file that grows in place is only picked up once something else in it changes.
+type indexEntry struct {
+	Version int
+	ModTime time.Time
+	// Files is the size of the files in the directory that only have one link.
+	Files Usage
+	// Hardlinks are the files in the directory with more than one link, which are only counted once per tree.
+	Hardlinks []hardlink
+	// Dirs are the names of the subdirectories.
+	Dirs []string
+}
+
+type hardlink struct {
+	Dev  uint64
+	Ino  uint64
+	Size Usage
+}
+
+// Index is a persistent index of every directory that has been scanned. It's what makes repeated scans fast,
+// since only the directories that have changed since the last scan have to be read again.
+type Index struct {
+	cache *cache.Cache[indexEntry]
+}
+
+// NewIndex loads the index that's stored in dir.
+func NewIndex(dir string) *Index {
+	// The index replaces the sizes cache, which only knew the size of whole trees and went stale.
+	_ = os.Remove(filepath.Join(dir, "sizes_cache"))
+	return &Index{cache: cache.NewCache(dir, indexName, cache.WithTTL[indexEntry](indexTTL))}
+}
+
+// sharedIndex is the index in the app dir. It's shared by all size calculators so that they don't overwrite
+// each other's changes when they're flushed.
+var sharedIndex = sync.OnceValue(func() *Index {
+	return NewIndex(config.GetAppDir())
+})
+
+// Flush writes the index to disk.
+func (i *Index) Flush() error {
+	return i.cache.Flush()
+}
+
+// forget removes dir and everything below it from the index.
+func (i *Index) forget(dir string) {
+	entry, ok := i.cache.Get(dir)
+	if !ok {
+		return
+	}
+	i.cache.Delete(dir)
+	for _, name := range entry.Dirs {
+		i.forget(util.SimpleJoin(dir, name))
+	}
+}
+
+// indexScan is the state of a single call to GetSize.
+type indexScan struct {
+	*SizeCalculator
+	ctx     context.Context
+	rootDev uint64
+	mu      sync.Mutex
+	// hardlinks holds the files with more than one link in the tree, since they're only counted once.
+	hardlinks map[inode]Usage
+	// accessTimes makes the scan read every directory to find lastAccess, the newest access time of the files.
+	// The access times of the directories themselves are left out since reading them updates them.
+	accessTimes bool
+	lastAccess  time.Time
+}
+
+// scan returns the size of dir, which info describes. Directories are only read if they have changed since they
+// were put in the index, but all of them have to be visited since a change deep down in a tree doesn't change the
+// mtime of the directories above it. That's still a lot cheaper than reading them.
+func (s *indexScan) scan(dir string, info fs.FileInfo) Usage {
+	// The disk space used by the directory itself is included, just like du does.
+	total := Usage{Allocated: getFileStat(info).allocated}
+	if s.ctx.Err() != nil {
+		return total
+	}
+	entry, ok := s.index.cache.Get(dir)
+	if !ok || entry.Version != indexEntryVersion || !entry.ModTime.Equal(info.ModTime()) || s.accessTimes {
+		entry, ok = s.readDir(dir, info, entry)
+		if !ok {
+			return total
+		}
+	}
+	total = total.Add(entry.Files)
+	s.progress.add(1, entry.Files.Apparent)
+	s.mu.Lock()
+	for _, link := range entry.Hardlinks {
+		s.hardlinks[inode{dev: link.Dev, ino: link.Ino}] = link.Size
+	}
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for _, name := range entry.Dirs {
+		path := util.SimpleJoin(dir, name)
+		childInfo, err := os.Lstat(path)
+		if err != nil || !childInfo.IsDir() {
+			// It's been removed or replaced since the directory was read, and if it was replaced by a
+			// directory that isn't in the index yet it's picked up the next time the parent changes.
+			continue
+		}
+		if s.walker.oneFileSystem && getFileStat(childInfo).dev != s.rootDev {
+			continue
+		}
+		s.walker.Go(&wg, func() {
+			size := s.scan(path, childInfo)
+			mu.Lock()
+			total = total.Add(size)
+			mu.Unlock()
+		})
+	}
+	wg.Wait()
+	return total
+}
+
+// readDir reads dir and puts it in the index in place of old, which is the entry that's there already, if any.
+func (s *indexScan) readDir(dir string, info fs.FileInfo, old indexEntry) (indexEntry, bool) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		s.progress.fail(dir)
+		s.walker.handleError(err)
+		return indexEntry{}, false
+	}
+	entry := indexEntry{Version: indexEntryVersion, ModTime: info.ModTime()}
+	var lastAccess time.Time
+	for _, e := range entries {
+		if e.IsDir() {
+			entry.Dirs = append(entry.Dirs, e.Name())
+			continue
+		}
+		fileInfo, err := e.Info()
+		if err != nil {
+			s.walker.handleError(err)
+			continue
+		}
+		stat := getFileStat(fileInfo)
+		if stat.atime.After(lastAccess) {
+			lastAccess = stat.atime
+		}
+		size := Usage{Allocated: stat.allocated, Apparent: fileInfo.Size()}
+		if stat.links > 1 {
+			entry.Hardlinks = append(entry.Hardlinks, hardlink{Dev: stat.dev, Ino: stat.ino, Size: size})
+			continue
+		}
+		entry.Files = entry.Files.Add(size)
+	}
+
+	// Directories that are gone would otherwise stay in the index forever.
+	current := make(map[string]bool, len(entry.Dirs))
+	for _, name := range entry.Dirs {
+		current[name] = true
+	}
+	for _, name := range old.Dirs {
+		if !current[name] {
+			s.index.forget(util.SimpleJoin(dir, name))
+		}
+	}
+	s.index.cache.Put(dir, entry)
+	s.mu.Lock()
+	if lastAccess.After(s.lastAccess) {
+		s.lastAccess = lastAccess
+	}
+	s.mu.Unlock()
+	return entry, true
+}
@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGetSizeIncremental(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "a", "b")
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "file"), make([]byte, 1000), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := NewIndex(t.TempDir())
+
+	size := NewSizeCalculator(WithIndex(index)).GetSize(context.Background(), root)
+	if size.Apparent != 1000 {
+		t.Fatalf("GetSize().Apparent = %d; want 1000", size.Apparent)
+	}
+
+	// A change deep down in the tree doesn't change the mtime of root.
+	err = os.WriteFile(filepath.Join(dir, "new"), make([]byte, 500), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size = NewSizeCalculator(WithIndex(index)).GetSize(context.Background(), root)
+	if size.Apparent != 1500 {
+		t.Errorf("GetSize().Apparent = %d; want 1500 after adding a file", size.Apparent)
+	}
+
+	err = os.RemoveAll(filepath.Join(root, "a", "b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	size = NewSizeCalculator(WithIndex(index)).GetSize(context.Background(), root)
+	if size.Apparent != 0 {
+		t.Errorf("GetSize().Apparent = %d; want 0 after removing the folder", size.Apparent)
+	}
+	if _, ok := index.cache.Get(dir); ok {
+		t.Errorf("%s is still in the index after it was removed", dir)
+	}
+}
+
+func TestIndexPersists(t *testing.T) {
+	root := t.TempDir()
+	err := os.WriteFile(filepath.Join(root, "file"), make([]byte, 1000), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexDir := t.TempDir()
+	calculator := NewSizeCalculator(WithIndex(NewIndex(indexDir)))
+	calculator.GetSize(context.Background(), root)
+	calculator.Close()
+
+	entry, ok := NewIndex(indexDir).cache.Get(root)
+	if !ok {
+		t.Fatalf("%s isn't in the index after it was flushed", root)
+	}
+	if entry.Files.Apparent != 1000 {
+		t.Errorf("entry.Files.Apparent = %d; want 1000", entry.Files.Apparent)
+	}
+}
+
+func TestIndexKeysAreClean(t *testing.T) {
+	root := t.TempDir()
+	err := os.Mkdir(filepath.Join(root, "a"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := NewIndex(t.TempDir())
+	NewSizeCalculator(WithIndex(index)).GetSize(context.Background(), filepath.Join(root, "a")+"/../")
+
+	if _, ok := index.cache.Get(root); !ok {
+		t.Errorf("%s isn't in the index after its size was calculated through a path that isn't clean", root)
+	}
+}
@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Progress counts the directories and bytes that have been scanned by the walkers and size calculators
+// it's passed to. It's safe for concurrent use and a nil *Progress simply doesn't count anything.
+type Progress struct {
+	dirs  atomic.Int64
+	bytes atomic.Int64
+	// failed holds the directories that couldn't be read. It's a set since several walkers may fail on the same one.
+	failed sync.Map
+}
+
+// Dirs returns the number of directories that have been scanned.
+func (p *Progress) Dirs() int64 {
+	if p == nil {
+		return 0
+	}
+	return p.dirs.Load()
+}
+
+// Bytes returns the total size of the files that have been scanned.
+func (p *Progress) Bytes() int64 {
+	if p == nil {
+		return 0
+	}
+	return p.bytes.Load()
+}
+
+// FailedDirs returns the number of directories that couldn't be read.
+func (p *Progress) FailedDirs() int {
+	if p == nil {
+		return 0
+	}
+	count := 0
+	p.failed.Range(func(_, _ any) bool {
+		count++
+		return true
+	})
+	return count
+}
+
+func (p *Progress) fail(dir string) {
+	if p == nil {
+		return
+	}
+	p.failed.Store(dir, true)
+}
+
+func (p *Progress) add(dirs, bytes int64) {
+	if p == nil {
+		return
+	}
+	p.dirs.Add(dirs)
+	p.bytes.Add(bytes)
+}
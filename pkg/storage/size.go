@@ -1,53 +1,139 @@
 package storage
 
 import (
-	"github.com/sebastianappelberg/disk/pkg/cache"
-	"github.com/sebastianappelberg/disk/pkg/config"
+	"context"
+	"io/fs"
 	"os"
+	"path/filepath"
 	"time"
 )
 
-type sizeCacheEntry struct {
-	ModTime time.Time
-	Size    int64
+type SizeCalculator struct {
+	walker        *FileWalker[File]
+	walkerOptions []FileWalkerOption[File]
+	index         *Index
+	progress      *Progress
 }
 
-type SizeCalculator struct {
-	walker *FileWalker[File]
-	cache  *cache.Cache[sizeCacheEntry]
+type SizeCalculatorOption func(*SizeCalculator)
+
+// WithSizeProgress makes the calculator count the directories and bytes it scans in progress.
+// Directories that are read from the index are counted as scanned as well.
+func WithSizeProgress(progress *Progress) SizeCalculatorOption {
+	return func(s *SizeCalculator) {
+		s.progress = progress
+	}
+}
+
+// WithWalkerOptions passes options such as WithOneFileSystem on to the walker that calculates the sizes.
+func WithWalkerOptions(options ...FileWalkerOption[File]) SizeCalculatorOption {
+	return func(s *SizeCalculator) {
+		s.walkerOptions = append(s.walkerOptions, options...)
+	}
 }
 
-func NewSizeCalculator() *SizeCalculator {
-	return &SizeCalculator{
-		walker: NewFileWalker[File](
-			WithDecisionFilter[File](IdentityFilter),
-			WithMapper(IdentityMapper),
-		),
-		cache: cache.NewCache[sizeCacheEntry](config.GetAppDir(), "sizes"),
+// WithIndex makes the calculator use index instead of the one in the app dir.
+func WithIndex(index *Index) SizeCalculatorOption {
+	return func(s *SizeCalculator) {
+		s.index = index
 	}
 }
 
-func (s *SizeCalculator) GetSize(root string) int64 {
+func NewSizeCalculator(options ...SizeCalculatorOption) *SizeCalculator {
+	s := &SizeCalculator{}
+	for _, option := range options {
+		option(s)
+	}
+	if s.index == nil {
+		s.index = sharedIndex()
+	}
+	s.walker = NewFileWalker[File](append([]FileWalkerOption[File]{
+		WithDecisionFilter[File](IdentityFilter),
+		WithMapper(IdentityMapper),
+		WithProgress[File](s.progress),
+	}, s.walkerOptions...)...)
+	return s
+}
+
+// GetSize returns the total size of the files under root. The allocated size includes the disk space used by the
+// folders themselves, just like du. If ctx is cancelled the size is incomplete.
+func (s *SizeCalculator) GetSize(ctx context.Context, root string) Usage {
+	size, _ := s.getSize(ctx, root, false, make(map[inode]bool))
+	return size
+}
+
+// GetSizeAndAccessTime returns the size of root like GetSize along with the most recent access time of the files
+// under it, which is zero if none of them are known. Reading a file doesn't change the folder it's in, so every
+// folder is read instead of being looked up in the index.
+func (s *SizeCalculator) GetSizeAndAccessTime(ctx context.Context, root string) (Usage, time.Time) {
+	return s.getSize(ctx, root, true, make(map[inode]bool))
+}
+
+// getSize returns the size of root. Files with more than one link are only counted if they aren't in seen already,
+// which lets the sizes of several trees be added up without counting the same data twice.
+func (s *SizeCalculator) getSize(ctx context.Context, root string, accessTimes bool, seen map[inode]bool) (Usage, time.Time) {
+	// The index is keyed by path, so the same folder has to be spelled the same way every time.
+	if abs, err := filepath.Abs(root); err == nil {
+		root = abs
+	}
 	fileInfo, err := os.Stat(root)
 	if err != nil {
-		return 0
+		return Usage{}, time.Time{}
+	}
+	if !fileInfo.IsDir() {
+		stat := getFileStat(fileInfo)
+		return Usage{Allocated: stat.allocated, Apparent: fileInfo.Size()}, stat.atime
+	}
+	if s.walker.followSymlinks {
+		return s.walkSize(ctx, root, fileInfo, seen)
+	}
+
+	scan := &indexScan{
+		SizeCalculator: s,
+		ctx:            ctx,
+		rootDev:        getFileStat(fileInfo).dev,
+		hardlinks:      make(map[inode]Usage),
+		accessTimes:    accessTimes,
 	}
-	size, ok := s.cache.Get(root)
-	if ok && fileInfo.ModTime().Equal(size.ModTime) {
-		return size.Size
+	total := scan.scan(root, fileInfo)
+	// Hardlinks point to the same data so it's only counted once, e.g. in pnpm stores and the Go module cache.
+	for ino, size := range scan.hardlinks {
+		if !seen[ino] {
+			seen[ino] = true
+			total = total.Add(size)
+		}
 	}
-	fileCh := s.walker.GetFiles(root)
+	return total, scan.lastAccess
+}
 
-	var total int64
+// walkSize walks all of root to get its size. It's used when symlinks are followed since the content of a
+// directory then depends on other parts of the disk, so the index can't tell when it has changed.
+func (s *SizeCalculator) walkSize(ctx context.Context, root string, rootInfo fs.FileInfo, seen map[inode]bool) (Usage, time.Time) {
+	fileCh := s.walker.GetFiles(ctx, root)
+
+	total := Usage{Allocated: getFileStat(rootInfo).allocated}
+	var lastAccess time.Time
 	for file := range fileCh {
-		if !file.IsDir {
-			total += file.Size
+		if file.IsDir {
+			total.Allocated += file.Allocated
+			continue
+		}
+		if file.AccessTime.After(lastAccess) {
+			lastAccess = file.AccessTime
+		}
+		if file.stat.links > 1 {
+			if seen[file.stat.inode()] {
+				continue
+			}
+			seen[file.stat.inode()] = true
 		}
+		total = total.Add(file.Usage())
 	}
-	s.cache.Put(root, sizeCacheEntry{ModTime: fileInfo.ModTime(), Size: total})
-	return total
+	return total, lastAccess
 }
 
+// Close writes the index to disk. The index is only there to make the next scan faster,
+// so it's not a problem if it can't be written.
 func (s *SizeCalculator) Close() {
-	s.cache.Flush()
+	_ = s.index.Flush()
 }
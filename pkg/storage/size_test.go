@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"context"
+	"github.com/sebastianappelberg/disk/internal/testutil"
+	"github.com/sebastianappelberg/disk/pkg/config"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	testutil.Main(m, config.SetAppDir)
+}
+
+func TestGetSizeHardlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hardlinks aren't detected on Windows")
+	}
+	root := t.TempDir()
+	file := filepath.Join(root, "file")
+	err := os.WriteFile(file, make([]byte, 1000), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Link(file, filepath.Join(root, "link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	size := NewSizeCalculator().GetSize(context.Background(), root)
+
+	if size.Apparent != 1000 {
+		t.Errorf("GetSize().Apparent = %d; want 1000 since the hardlink shouldn't be counted twice", size.Apparent)
+	}
+}
+
+func TestGetSizeSparse(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the allocated size isn't known on Windows")
+	}
+	root := t.TempDir()
+	f, err := os.Create(filepath.Join(root, "sparse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Truncating a file to a larger size leaves a hole that doesn't use any disk space.
+	err = f.Truncate(100 * MegaByte)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	size := NewSizeCalculator().GetSize(context.Background(), root)
+
+	if size.Apparent != 100*MegaByte {
+		t.Errorf("GetSize().Apparent = %d; want %d", size.Apparent, 100*MegaByte)
+	}
+	if size.Allocated >= MegaByte {
+		t.Errorf("GetSize().Allocated = %d; want less than %d since the file is sparse", size.Allocated, MegaByte)
+	}
+}
+
+func TestUsageFormat(t *testing.T) {
+	usage := Usage{Allocated: 4 * MegaByte, Apparent: 10 * MegaByte}
+	tests := []struct {
+		mode     SizeMode
+		expected string
+	}{
+		{AllocatedSize, "4MB"},
+		{ApparentSize, "10MB"},
+		{BothSizes, "4MB (10MB apparent)"},
+	}
+	for _, test := range tests {
+		if got := usage.Format(test.mode); got != test.expected {
+			t.Errorf("Format(%d) = %q; want %q", test.mode, got, test.expected)
+		}
+	}
+}
+
+func TestGetSizeAndAccessTime(t *testing.T) {
+	root := t.TempDir()
+	old := time.Now().AddDate(0, 0, -100).Truncate(time.Second)
+	recent := time.Now().AddDate(0, 0, -1).Truncate(time.Second)
+	for path, accessTime := range map[string]time.Time{"a": old, "dir/b": recent, "dir/c": old} {
+		path = filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, make([]byte, 10), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, accessTime, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	calculator := NewSizeCalculator(WithIndex(NewIndex(t.TempDir())))
+	// The index knows the folders after the first scan, the access times still have to be read.
+	calculator.GetSize(context.Background(), root)
+
+	size, accessTime := calculator.GetSizeAndAccessTime(context.Background(), root)
+	if size.Apparent != 30 {
+		t.Errorf("GetSizeAndAccessTime().Apparent = %d; want 30", size.Apparent)
+	}
+	if !accessTime.Equal(recent) {
+		t.Errorf("GetSizeAndAccessTime() = %v; want the access time of dir/b, %v", accessTime, recent)
+	}
+}
+
+func TestAgeModeLastUsed(t *testing.T) {
+	modTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	earlier := modTime.AddDate(0, -1, 0)
+	later := modTime.AddDate(0, 1, 0)
+	tests := []struct {
+		mode       AgeMode
+		accessTime time.Time
+		expected   time.Time
+	}{
+		{ModTimeAge, later, modTime},
+		{AccessTimeAge, later, later},
+		{AccessTimeAge, earlier, earlier},
+		{AccessTimeAge, time.Time{}, modTime},
+		{NewestAge, later, later},
+		{NewestAge, earlier, modTime},
+	}
+	for _, test := range tests {
+		if got := test.mode.LastUsed(modTime, test.accessTime); !got.Equal(test.expected) {
+			t.Errorf("AgeMode(%d).LastUsed(%v, %v) = %v; want %v", test.mode, modTime, test.accessTime, got, test.expected)
+		}
+	}
+}
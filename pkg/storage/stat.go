@@ -0,0 +1,26 @@
+package storage
+
+import (
+	"time"
+)
+
+// fileStat holds the platform specific information that's needed to tell hardlinks and mount points apart
+// and to tell how much disk space a file uses. Only allocated is set on platforms where the rest isn't available.
+type fileStat struct {
+	dev       uint64 // dev is the ID of the device that the file is on.
+	ino       uint64 // ino is the inode number of the file.
+	links     uint64 // links is the number of hardlinks to the file.
+	allocated int64  // allocated is the disk space that the file uses, or its apparent size if that isn't known.
+	// atime is when the file was last accessed. It's zero where it isn't known.
+	atime time.Time
+}
+
+// inode identifies a file across all of its hardlinks.
+type inode struct {
+	dev uint64
+	ino uint64
+}
+
+func (s fileStat) inode() inode {
+	return inode{dev: s.dev, ino: s.ino}
+}
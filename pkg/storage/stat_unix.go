@@ -0,0 +1,23 @@
+//go:build !windows
+
+package storage
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+func getFileStat(info fs.FileInfo) fileStat {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileStat{allocated: info.Size()}
+	}
+	return fileStat{
+		dev:   uint64(stat.Dev),
+		ino:   uint64(stat.Ino),
+		links: uint64(stat.Nlink),
+		// Blocks is always counted in 512-byte units, regardless of the block size of the file system.
+		allocated: int64(stat.Blocks) * 512,
+		atime:     accessTime(stat),
+	}
+}
@@ -1,39 +1,64 @@
 package storage
 
 import (
+	"context"
 	"github.com/sebastianappelberg/disk/pkg/util"
+	"io/fs"
 	"os"
+	"path/filepath"
 )
 
 // Tree represents a folder and its subfolders.
 type Tree struct {
 	Name     string
 	Children []Tree
-	Size     int64
+	Size     Usage
+	IsDir    bool
 }
 
 type TreeWalker struct {
+	// walker holds the options, e.g. WithOneFileSystem, that apply to the tree as well as to the sizes in it.
+	walker         *FileWalker[File]
 	sizeCalculator *SizeCalculator
+	rootDev        uint64
+	// seen holds the files with more than one link that have been counted in the tree, so that hardlinks are only
+	// counted once like they are by GetSize.
+	seen map[inode]bool
 }
 
-func NewTreeWalker() *TreeWalker {
+// NewTreeWalker creates a TreeWalker. It takes the same options as a FileWalker, but only the ones
+// that change which files are walked, such as WithOneFileSystem and WithFollowSymlinks, make sense.
+func NewTreeWalker(options ...FileWalkerOption[File]) *TreeWalker {
 	return &TreeWalker{
-		sizeCalculator: NewSizeCalculator(),
+		walker:         NewFileWalker[File](options...),
+		sizeCalculator: NewSizeCalculator(WithWalkerOptions(options...)),
 	}
 }
 
+// GetTree returns root with its folders and files down to maxDepth. The sizes of the folders at maxDepth are
+// calculated in full. A maxDepth of 1 lists the content of root, which is how subtrees are loaded one at a time.
 func (t *TreeWalker) GetTree(root string, maxDepth int) Tree {
 	defer t.sizeCalculator.Close()
 	rootNode := Tree{
-		Name: root,
+		Name:  root,
+		IsDir: true,
 	}
-	children, err := t.getChildren(root, maxDepth, 0)
+	if info, err := os.Stat(root); err == nil {
+		t.rootDev = getFileStat(info).dev
+	}
+	t.seen = make(map[inode]bool)
+	// The folders below root are looked up in the index by path, which has to be spelled the same way every time.
+	dir := root
+	if abs, err := filepath.Abs(root); err == nil {
+		dir = abs
+	}
+	children, err := t.getChildren(dir, maxDepth, 0)
 	if err != nil {
 		return rootNode
 	}
 	rootNode.Children = children
 	for _, child := range rootNode.Children {
-		rootNode.Size += child.Size
+		rootNode.Size = rootNode.Size.Add(child.Size)
 	}
 	return rootNode
 }
@@ -52,7 +77,20 @@ func (t *TreeWalker) getChildren(currentDir string, maxDepth, currentDepth int)
 	var children []Tree
 
 	for _, entry := range entries {
-		if entry.IsDir() {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if t.walker.followSymlinks && info.Mode()&fs.ModeSymlink != 0 {
+			if target, err := os.Stat(util.SimpleJoin(currentDir, entry.Name())); err == nil {
+				info = target
+			}
+		}
+		if info.IsDir() {
+			if t.walker.oneFileSystem && getFileStat(info).dev != t.rootDev {
+				// Mount points are left out entirely, just like their content.
+				continue
+			}
 			subDir := util.SimpleJoin(currentDir, entry.Name())
 			// Recursively get nestedChildren
 			nestedChildren, err := t.getChildren(subDir, maxDepth, currentDepth+1)
@@ -60,28 +98,36 @@ func (t *TreeWalker) getChildren(currentDir string, maxDepth, currentDepth int)
 				return nil, err
 			}
 			// Append the tree with its nestedChildren
-			size := int64(0)
+			var size Usage
 			if nestedChildren == nil {
 				// If it's a leaf node then explicitly get the full child size.
-				size = t.sizeCalculator.GetSize(subDir)
+				size, _ = t.sizeCalculator.getSize(context.Background(), subDir, false, t.seen)
+			} else {
+				// The disk space used by the folder itself is included in the size of leaf nodes, so it is here too.
+				size.Allocated = getFileStat(info).allocated
 			}
 			for _, child := range nestedChildren {
-				size += child.Size
+				size = size.Add(child.Size)
 			}
 			child := Tree{
 				Name:     entry.Name(),
 				Children: nestedChildren,
 				Size:     size,
+				IsDir:    true,
 			}
 			children = append(children, child)
 		} else {
-			info, err := entry.Info()
-			if err != nil {
-				continue
+			stat := getFileStat(info)
+			var size Usage
+			if stat.links <= 1 || !t.seen[stat.inode()] {
+				size = Usage{Allocated: stat.allocated, Apparent: info.Size()}
+			}
+			if stat.links > 1 {
+				t.seen[stat.inode()] = true
 			}
 			children = append(children, Tree{
 				Name: entry.Name(),
-				Size: info.Size(),
+				Size: size,
 			})
 		}
 	}
@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestGetTreeHardlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hardlinks aren't detected on Windows")
+	}
+	root := t.TempDir()
+	for _, dir := range []string{"a", "b"} {
+		err := os.Mkdir(filepath.Join(root, dir), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	file := filepath.Join(root, "a", "file")
+	err := os.WriteFile(file, make([]byte, 1000), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, link := range []string{filepath.Join(root, "b", "link"), filepath.Join(root, "link")} {
+		err = os.Link(file, link)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tree := NewTreeWalker().GetTree(root, 1)
+
+	if tree.Size.Apparent != 1000 {
+		t.Errorf("GetTree().Size.Apparent = %d; want 1000 since the hardlinks shouldn't be counted more than once", tree.Size.Apparent)
+	}
+}
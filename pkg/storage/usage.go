@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SizeMode decides which of the sizes in a Usage is reported.
+type SizeMode int
+
+const (
+	// AllocatedSize is the disk space that files use, like du reports it. It's what removing them frees.
+	AllocatedSize SizeMode = iota
+	// ApparentSize is the number of bytes in files, like ls reports it. Sparse and compressed files use less disk
+	// space than that, while small files use more since they take up a whole block.
+	ApparentSize
+	// BothSizes reports the allocated size followed by the apparent size.
+	BothSizes
+)
+
+const (
+	SizeModeAllocated = "allocated"
+	SizeModeApparent  = "apparent"
+	SizeModeBoth      = "both"
+)
+
+var SizeModes = []string{SizeModeAllocated, SizeModeApparent, SizeModeBoth}
+
+func ParseSizeMode(mode string) (SizeMode, error) {
+	switch mode {
+	case SizeModeAllocated:
+		return AllocatedSize, nil
+	case SizeModeApparent:
+		return ApparentSize, nil
+	case SizeModeBoth:
+		return BothSizes, nil
+	}
+	return 0, fmt.Errorf("unsupported size mode %q, expected one of %s", mode, strings.Join(SizeModes, ", "))
+}
+
+// Usage is the size of a file or folder, both as the disk space it uses and as the number of bytes in it.
+type Usage struct {
+	Allocated int64
+	Apparent  int64
+}
+
+func (u Usage) Add(other Usage) Usage {
+	return Usage{Allocated: u.Allocated + other.Allocated, Apparent: u.Apparent + other.Apparent}
+}
+
+func (u Usage) Sub(other Usage) Usage {
+	return Usage{Allocated: u.Allocated - other.Allocated, Apparent: u.Apparent - other.Apparent}
+}
+
+// Size returns the size that mode reports. The allocated size is used when both are reported, e.g. for sorting.
+func (u Usage) Size(mode SizeMode) int64 {
+	if mode == ApparentSize {
+		return u.Apparent
+	}
+	return u.Allocated
+}
+
+// Format formats the size that mode reports, e.g. "4MB" or "4MB (10MB apparent)" when both are reported.
+func (u Usage) Format(mode SizeMode) string {
+	switch mode {
+	case ApparentSize:
+		return FormatSize(u.Apparent)
+	case BothSizes:
+		return fmt.Sprintf("%s (%s apparent)", FormatSize(u.Allocated), FormatSize(u.Apparent))
+	}
+	return FormatSize(u.Allocated)
+}
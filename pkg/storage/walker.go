@@ -1,7 +1,9 @@
 package storage
 
 import (
+	"context"
 	"github.com/sebastianappelberg/disk/pkg/util"
+	"io/fs"
 	"os"
 	"sync"
 	"time"
@@ -13,11 +15,36 @@ const (
 )
 
 type File struct {
-	Base    string
-	Name    string
-	Size    int64
-	IsDir   bool
-	ModTime time.Time
+	Base string
+	Name string
+	// Size is the apparent size of the file, i.e. the number of bytes in it.
+	Size int64
+	// Allocated is the disk space that the file uses. It's the same as Size on platforms where it isn't known.
+	Allocated int64
+	IsDir     bool
+	ModTime   time.Time
+	// AccessTime is when the file was last read. It's zero on platforms where it isn't known, and it's only updated
+	// once a day or not at all on file systems mounted with relatime or noatime, see AccessTimeOption.
+	AccessTime time.Time
+	mode       fs.FileMode
+	stat       fileStat
+}
+
+// Usage returns both the allocated and the apparent size of the file.
+func (f File) Usage() Usage {
+	return Usage{Allocated: f.Allocated, Apparent: f.Size}
+}
+
+// IsRegular reports whether the file is a regular file, i.e. not a folder, symlink, device, etc.
+// Symlinks are only regular files if the walker follows them and they point to one.
+func (f File) IsRegular() bool {
+	return f.mode.IsRegular()
+}
+
+// SameFile reports whether f and other are hardlinks to the same file. It's always false on platforms
+// where the inode of a file isn't known.
+func (f File) SameFile(other File) bool {
+	return f.stat.ino != 0 && f.stat.inode() == other.stat.inode()
 }
 
 func (f File) GetPaths() []string {
@@ -45,9 +72,10 @@ func (d FilterDecision) Includes(flag FilterDecision) bool {
 	return d&flag != 0
 }
 
-type Filter func(file File) FilterDecision
+// Filter decides what the walker does with a file. siblings are the entries in the same directory as the file.
+type Filter func(file File, siblings []os.DirEntry) FilterDecision
 
-func IdentityFilter(_ File) FilterDecision {
+func IdentityFilter(_ File, _ []os.DirEntry) FilterDecision {
 	return Include
 }
 
@@ -57,10 +85,18 @@ func IdentityMapper(file File, _ []os.DirEntry) File {
 	return file
 }
 
+// ErrorHandler is called with the errors that the walker encounters, e.g. when a directory can't be read
+// because of missing permissions. The walker skips what it couldn't read and carries on.
+type ErrorHandler func(err error)
+
 type FileWalker[T any] struct {
-	filter    Filter
-	mapper    Mapper[T]
-	wg        sync.WaitGroup
+	filter         Filter
+	mapper         Mapper[T]
+	progress       *Progress
+	errorHandler   ErrorHandler
+	oneFileSystem  bool
+	followSymlinks bool
+	// semaphore limits the number of goroutines walking directories, across all walks of the walker.
 	semaphore chan struct{}
 }
 
@@ -78,10 +114,40 @@ func WithDecisionFilter[T any](filter Filter) FileWalkerOption[T] {
 	}
 }
 
+// WithProgress makes the walker count the directories and bytes it scans in progress.
+func WithProgress[T any](progress *Progress) FileWalkerOption[T] {
+	return func(a *FileWalker[T]) {
+		a.progress = progress
+	}
+}
+
+// WithErrorHandler makes the walker report the directories and files it can't read to handler.
+// The handler may be called from multiple goroutines at the same time.
+func WithErrorHandler[T any](handler ErrorHandler) FileWalkerOption[T] {
+	return func(a *FileWalker[T]) {
+		a.errorHandler = handler
+	}
+}
+
+// WithOneFileSystem makes the walker stay on the file system that the root is on, i.e. it doesn't descend
+// into mount points such as /proc or bind mounts.
+func WithOneFileSystem[T any]() FileWalkerOption[T] {
+	return func(a *FileWalker[T]) {
+		a.oneFileSystem = true
+	}
+}
+
+// WithFollowSymlinks makes the walker treat symlinks as the files and directories they point to.
+// Symlinks are never followed by default, they're treated as small files of their own.
+func WithFollowSymlinks[T any]() FileWalkerOption[T] {
+	return func(a *FileWalker[T]) {
+		a.followSymlinks = true
+	}
+}
+
 func NewFileWalker[T any](options ...FileWalkerOption[T]) *FileWalker[T] {
 	a := &FileWalker[T]{
 		filter:    IdentityFilter,
-		wg:        sync.WaitGroup{},
 		semaphore: make(chan struct{}, semaphoreLimit),
 	}
 	for _, option := range options {
@@ -90,47 +156,119 @@ func NewFileWalker[T any](options ...FileWalkerOption[T]) *FileWalker[T] {
 	return a
 }
 
-func (w *FileWalker[T]) GetFiles(root string) <-chan T {
+// walk is the state of a single call to GetFiles.
+type walk[T any] struct {
+	*FileWalker[T]
+	ctx     context.Context
+	wg      sync.WaitGroup
+	entryCh chan<- T
+	rootDev uint64
+	// visited holds the inodes of the directories that have been walked when following symlinks
+	// since symlinks can form cycles.
+	visited sync.Map
+}
+
+// GetFiles walks root and sends the files that the filter includes on the returned channel.
+// The walk stops when ctx is cancelled and the channel is closed once the walk is done.
+func (w *FileWalker[T]) GetFiles(ctx context.Context, root string) <-chan T {
 	ch := make(chan T, fileChLimit)
+	wk := &walk[T]{FileWalker: w, ctx: ctx, entryCh: ch}
+	if info, err := os.Stat(root); err == nil {
+		stat := getFileStat(info)
+		wk.rootDev = stat.dev
+		if stat.ino != 0 {
+			wk.visited.Store(stat.inode(), true)
+		}
+	}
 
-	w.wg.Add(1)
-	go w.getFiles(root, ch)
+	wk.wg.Add(1)
+	go func() {
+		defer wk.wg.Done()
+		wk.getFiles(root)
+	}()
 
 	go func() {
-		w.wg.Wait()
+		wk.wg.Wait()
 		close(ch)
 	}()
 
 	return ch
 }
 
-// getFiles scans the directory specified by dir. Subdirectories are walked recursively in separate goroutines.
-func (w *FileWalker[T]) getFiles(dir string, entryCh chan<- T) {
-	defer w.wg.Done()
-	w.semaphore <- struct{}{}
-	defer func() { <-w.semaphore }()
+// Go runs fn in a new goroutine that wg waits for as long as there are fewer than semaphoreLimit of them, across
+// all walks of the walker, otherwise fn is run by the current goroutine. Work that follows a walk, such as reading
+// the files that were found, can use it to share the limit with the walker.
+func (w *FileWalker[T]) Go(wg *sync.WaitGroup, fn func()) {
+	select {
+	case w.semaphore <- struct{}{}:
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-w.semaphore }()
+			fn()
+		}()
+	default:
+		fn()
+	}
+}
+
+func (w *FileWalker[T]) handleError(err error) {
+	if w.errorHandler != nil {
+		w.errorHandler(err)
+	}
+}
+
+// getFiles scans the directory specified by dir. Subdirectories are walked recursively in separate goroutines
+// as long as there are fewer than semaphoreLimit of them, otherwise they're walked by the current goroutine.
+func (w *walk[T]) getFiles(dir string) {
+	if w.ctx.Err() != nil {
+		return
+	}
 
 	entries, err := os.ReadDir(dir)
 	if err != nil {
+		w.progress.fail(dir)
+		w.handleError(err)
 		return
 	}
+	var scannedBytes int64
+	defer func() { w.progress.add(1, scannedBytes) }()
 
 	for _, e := range entries {
 		info, err := e.Info()
 		if err != nil {
+			w.handleError(err)
 			continue
 		}
+		if w.followSymlinks && info.Mode()&fs.ModeSymlink != 0 {
+			// Broken symlinks are treated as files of their own.
+			if target, err := os.Stat(util.SimpleJoin(dir, e.Name())); err == nil {
+				info = target
+			}
+		}
+		stat := getFileStat(info)
 		file := File{
-			Base:    dir,
-			Name:    e.Name(),
-			IsDir:   e.IsDir(),
-			Size:    info.Size(),
-			ModTime: info.ModTime(),
+			Base:       dir,
+			Name:       e.Name(),
+			IsDir:      info.IsDir(),
+			Size:       info.Size(),
+			Allocated:  stat.allocated,
+			ModTime:    info.ModTime(),
+			AccessTime: stat.atime,
+			mode:       info.Mode(),
+			stat:       stat,
+		}
+		if !file.IsDir {
+			scannedBytes += file.Size
 		}
 
-		decision := w.filter(file)
+		decision := w.filter(file, entries)
 		if decision.Includes(Include) {
-			entryCh <- w.mapper(file, entries)
+			select {
+			case w.entryCh <- w.mapper(file, entries):
+			case <-w.ctx.Done():
+				return
+			}
 		}
 
 		if decision.Includes(ShortCircuit) {
@@ -141,8 +279,16 @@ func (w *FileWalker[T]) getFiles(dir string, entryCh chan<- T) {
 			// We don't need to dig deeper once we've gotten the skip decision or the entry isn't a folder.
 			continue
 		}
+		if w.oneFileSystem && file.stat.dev != w.rootDev {
+			continue
+		}
+		if w.followSymlinks && file.stat.ino != 0 {
+			if _, seen := w.visited.LoadOrStore(file.stat.inode(), true); seen {
+				continue
+			}
+		}
 
-		w.wg.Add(1)
-		go w.getFiles(file.GetPath(), entryCh)
+		path := file.GetPath()
+		w.Go(&w.wg, func() { w.getFiles(path) })
 	}
 }
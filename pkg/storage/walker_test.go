@@ -1,14 +1,22 @@
 package storage
 
 import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
 )
 
 func BenchmarkAnalyze(b *testing.B) {
 	analyzer := NewFileWalker[File](WithDecisionFilter[File](IdentityFilter), WithMapper(IdentityMapper))
 	counter := int64(0)
 	for i := 0; i < b.N; i++ {
-		files := analyzer.GetFiles("C:\\Users\\sebastian\\src")
+		files := analyzer.GetFiles(context.Background(), "C:\\Users\\sebastian\\src")
 		for file := range files {
 			counter += file.Size
 		}
@@ -31,3 +39,141 @@ func TestFilterDecision_Includes(t *testing.T) {
 		t.Error("Includes fail")
 	}
 }
+
+func TestGetFiles(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"a/b/c", "d", "e/f"} {
+		err := os.MkdirAll(filepath.Join(root, dir), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(filepath.Join(root, dir, "file"), []byte("12345"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	progress := &Progress{}
+	walker := NewFileWalker[File](WithMapper(IdentityMapper), WithProgress[File](progress))
+
+	var files int
+	for file := range walker.GetFiles(context.Background(), root) {
+		if !file.IsDir {
+			files++
+		}
+	}
+
+	if files != 3 {
+		t.Errorf("GetFiles() found %d files; want 3", files)
+	}
+	if progress.Dirs() != 7 {
+		t.Errorf("Dirs() = %d; want 7", progress.Dirs())
+	}
+	if progress.Bytes() != 15 {
+		t.Errorf("Bytes() = %d; want 15", progress.Bytes())
+	}
+}
+
+func TestGetFilesErrors(t *testing.T) {
+	var mu sync.Mutex
+	var errs []error
+	progress := &Progress{}
+	walker := NewFileWalker[File](
+		WithMapper(IdentityMapper),
+		WithProgress[File](progress),
+		WithErrorHandler[File](func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			errs = append(errs, err)
+		}),
+	)
+
+	missing := filepath.Join(t.TempDir(), "missing")
+	for range walker.GetFiles(context.Background(), missing) {
+	}
+
+	if len(errs) != 1 || !errors.Is(errs[0], fs.ErrNotExist) {
+		t.Errorf("GetFiles() reported %v; want a single not exist error", errs)
+	}
+	if progress.FailedDirs() != 1 {
+		t.Errorf("FailedDirs() = %d; want 1", progress.FailedDirs())
+	}
+}
+
+func TestGetFilesCancel(t *testing.T) {
+	root := t.TempDir()
+	for i := range 100 {
+		err := os.MkdirAll(filepath.Join(root, strconv.Itoa(i), "sub"), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	walker := NewFileWalker[File](WithMapper(IdentityMapper))
+
+	ch := walker.GetFiles(ctx, root)
+	<-ch
+	cancel()
+	// The channel has to be closed without reading the rest of the files.
+	done := make(chan struct{})
+	go func() {
+		for range ch {
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("GetFiles() didn't stop after ctx was cancelled")
+	}
+}
+
+func TestGetFilesSymlinks(t *testing.T) {
+	root := t.TempDir()
+	err := os.MkdirAll(filepath.Join(root, "dir"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(root, "dir", "file"), []byte("12345"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Symlink(filepath.Join(root, "dir"), filepath.Join(root, "link"))
+	if err != nil {
+		t.Skipf("symlinks aren't supported: %v", err)
+	}
+	// A symlink back to the root would make the walk go on forever if cycles weren't detected.
+	err = os.Symlink(root, filepath.Join(root, "dir", "cycle"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		options  []FileWalkerOption[File]
+		expected map[string]bool // expected maps the files that are found to whether they're directories.
+	}{
+		{"default", nil, map[string]bool{"dir": true, "file": false, "link": false, "cycle": false}},
+		// The directory is only walked once, either through the link or directly.
+		{"follow", []FileWalkerOption[File]{WithFollowSymlinks[File]()}, map[string]bool{"dir": true, "file": false, "link": true, "cycle": true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			walker := NewFileWalker[File](append(tt.options, WithMapper(IdentityMapper))...)
+			found := make(map[string]bool)
+			for file := range walker.GetFiles(context.Background(), root) {
+				if _, ok := found[file.Name]; ok {
+					t.Errorf("GetFiles() found %s twice", file.Name)
+				}
+				found[file.Name] = file.IsDir
+			}
+			if len(found) != len(tt.expected) {
+				t.Fatalf("GetFiles() = %v; want %v", found, tt.expected)
+			}
+			for name, isDir := range tt.expected {
+				if found[name] != isDir {
+					t.Errorf("GetFiles() found %s with IsDir = %v; want %v", name, found[name], isDir)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package trash
+
+import (
+	"io/fs"
+	"log"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sebastianappelberg/disk/pkg/cache"
+	"github.com/sebastianappelberg/disk/pkg/config"
+)
+
+// Item is a file or folder that disk has put in the trash.
+type Item struct {
+	Name         string    `json:"name"`         // Name is the name of the item in the trash.
+	OriginalPath string    `json:"originalPath"` // OriginalPath is the absolute path the item had before it was put in the trash.
+	DeletedAt    time.Time `json:"deletedAt"`    // DeletedAt is when the item was put in the trash.
+	Size         int64     `json:"size"`         // Size in bytes.
+}
+
+// key identifies the item in the registry. The name isn't unique since items with the same name
+// can be in the trash at the same time, e.g. on Windows where items keep the name they had.
+func (i Item) key() string {
+	return i.OriginalPath + "\x00" + strconv.FormatInt(i.DeletedAt.UnixNano(), 10)
+}
+
+var (
+	// registry keeps track of the items that disk has put in the trash, so that disk only lists and
+	// empties its own items and leaves the rest of the trash alone.
+	registry = sync.OnceValue(func() *cache.Cache[Item] {
+		return cache.NewCache[Item](config.GetAppDir(), "trash")
+	})
+	// registryMu serializes writes to the registry since items are put in the trash concurrently.
+	registryMu sync.Mutex
+)
+
+// Put moves the specified files or directories to the trash of the operating system
+// and remembers them so that they can be listed, restored and emptied with disk.
+func Put(filePaths ...string) error {
+	_, err := PutItems(filePaths...)
+	return err
+}
+
+// PutItems is like Put but also returns the items that were put in the trash, which is what's needed to restore them.
+// If an error occurs, the items that were put in the trash before the error are returned along with it.
+func PutItems(filePaths ...string) ([]Item, error) {
+	var items []Item
+	// The registry is flushed once for all the items since every flush locks, merges and syncs all of it.
+	defer func() { remember(items...) }()
+	for _, filePath := range filePaths {
+		item, err := put(filePath)
+		if err != nil {
+			return items, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// Restore restores an item that was put in the trash to its original location.
+func Restore(item Item) error {
+	err := restore(item)
+	if err != nil {
+		return err
+	}
+	forget(item.key())
+	return nil
+}
+
+// Delete permanently deletes an item that disk has put in the trash.
+func Delete(item Item) error {
+	err := remove(item)
+	if err != nil {
+		return err
+	}
+	forget(item.key())
+	return nil
+}
+
+// List returns the items that disk has put in the trash and that are still there, most recently deleted first.
+// Items that have been restored or removed from the trash by other means are forgotten.
+func List() []Item {
+	var items []Item
+	var gone []string
+	registry().Range(func(key string, item Item) bool {
+		if contains(item) {
+			items = append(items, item)
+		} else {
+			gone = append(gone, key)
+		}
+		return true
+	})
+	for _, key := range gone {
+		forget(key)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].DeletedAt.After(items[j].DeletedAt)
+	})
+	return items
+}
+
+func remember(items ...Item) {
+	if len(items) == 0 {
+		return
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	for _, item := range items {
+		registry().Put(item.key(), item)
+	}
+	flushRegistry()
+}
+
+func forget(key string) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry().Delete(key)
+	flushRegistry()
+}
+
+func flushRegistry() {
+	err := registry().Flush()
+	if err != nil {
+		log.Printf("Could not save the list of items in the trash: %v", err)
+	}
+}
+
+// sizeOf returns the size of a file or the total size of all files in a directory.
+func sizeOf(path string, info fs.FileInfo) int64 {
+	if !info.IsDir() {
+		return info.Size()
+	}
+	var total int64
+	_ = filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err == nil {
+			total += info.Size()
+		}
+		return nil
+	})
+	return total
+}
@@ -9,6 +9,9 @@ package trash
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"time"
@@ -23,88 +26,95 @@ type metadata struct {
 
 var trashDir = filepath.Join(os.Getenv("HOME"), ".Trash")
 
-const trashboxMetadataExt = ".trashbox.metadata.json"
+const (
+	trashboxMetadataExt = ".trashbox.metadata.json"
+	// maxNameAttempts is how many unique names we try before giving up on putting a file in the trash.
+	maxNameAttempts = 10000
+)
 
-// Put moves the specified files or directories to the system's Trash directory.
+// put moves the specified file or directory to the system's Trash directory.
 // This function generates a metadata file in the Trash for potential recovery.
 //
-// Parameters:
-//
-//	filePaths (...string): The file paths of the files or directories to be moved to Trash.
-//
-// Returns:
-//
-//	error: Returns an error if the file cannot be moved to Trash or if there are issues
-//	       in creating the metadata file. Returns nil if successful.
-//
-// Example usage:
-//
-//	err := Put("/path/to/file.txt")
-//	if err != nil {
-//	    log.Fatalf("Failed to move file to Trash: %v", err)
-//	}
-//
 // Notes:
 //   - On success, a metadata file is created in the Trash directory that stores the
 //     original location of the deleted file. This enables the file to be put back
 //     using the Restore function.
 //   - The function is currently tailored for macOS systems.
-func Put(filePaths ...string) error {
-	for _, filePath := range filePaths {
-		err := put(filePath)
-		if err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
-func put(path string) error {
+func put(path string) (Item, error) {
 	// Get the absolute file path of delete file
 	absPath, err := filepath.Abs(path)
 	if err != nil {
-		return err
+		return Item{}, err
 	}
 
 	info, err := os.Stat(absPath)
 	if err != nil {
-		return err
+		return Item{}, err
 	}
+	size := sizeOf(absPath, info)
 
-	// Get the trash file path to move to .Trash directory
-	trashPath := filepath.Join(trashDir, filepath.Base(path))
+	// Create metadata file for recovery the deleted file, it reserves a unique name in the Trash
+	// so that files with the same name don't overwrite each other.
+	metadata := metadata{OriginalPath: absPath, DeletedAt: time.Now(), Size: size, Filename: info.Name()}
+	trashPath, err := createMetadata(filepath.Base(absPath), metadata)
+	if err != nil {
+		return Item{}, err
+	}
 	// Move the file to .Trash directory
 	err = os.Rename(absPath, trashPath)
 	if err != nil {
-		return err
+		_ = os.Remove(trashPath + trashboxMetadataExt)
+		return Item{}, err
 	}
 
-	// Create metadata file for recovery the deleted file
-	metadata := metadata{OriginalPath: absPath, DeletedAt: time.Now(), Size: info.Size(), Filename: info.Name()}
-	metadataPath := trashPath + trashboxMetadataExt
-
-	// Create metadata file in Trash bin
-	metadataFile, err := os.Create(metadataPath)
-	if err != nil {
-		return err
+	item := Item{
+		Name:         filepath.Base(trashPath),
+		OriginalPath: absPath,
+		DeletedAt:    metadata.DeletedAt,
+		Size:         size,
 	}
-	defer metadataFile.Close()
+	return item, nil
+}
 
-	encoder := json.NewEncoder(metadataFile)
-	err = encoder.Encode(metadata)
-	if err != nil {
-		return err
+// createMetadata writes the metadata file for a file with the given base name and returns the unique path
+// that the file should be moved to in the Trash.
+func createMetadata(base string, metadata metadata) (string, error) {
+	for i := 1; i <= maxNameAttempts; i++ {
+		name := base
+		if i > 1 {
+			name = fmt.Sprintf("%s %d", base, i)
+		}
+		trashPath := filepath.Join(trashDir, name)
+		if _, err := os.Lstat(trashPath); err == nil {
+			continue
+		}
+		file, err := os.OpenFile(trashPath+trashboxMetadataExt, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		err = json.NewEncoder(file).Encode(metadata)
+		closeErr := file.Close()
+		if err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			_ = os.Remove(trashPath + trashboxMetadataExt)
+			return "", err
+		}
+		return trashPath, nil
 	}
-
-	return nil
+	return "", fmt.Errorf("could not find a unique name for %q in %s", base, trashDir)
 }
 
-// Restore restores a previously deleted file from the Trash to its original location.
+// restore restores a previously deleted file from the Trash to its original location.
 // The original location is determined from the metadata generated when the file was moved to Trash.
 //
 // Parameters:
 //
-//	path (string): The name of the file or directory to be restored from Trash.
+//	item (Item): The item to be restored from Trash.
 //
 // Returns:
 //
@@ -113,7 +123,7 @@ func put(path string) error {
 //
 // Example usage:
 //
-//	err := Restore("file.txt")
+//	err := restore(item)
 //	if err != nil {
 //	    log.Fatalf("Failed to put back file from Trash: %v", err)
 //	}
@@ -122,9 +132,9 @@ func put(path string) error {
 //   - The function depends on a metadata file (generated by Put) being present
 //     in the Trash directory, which contains the original path.
 //   - On success, the metadata file is removed from the Trash.
-func Restore(path string) error {
+func restore(item Item) error {
 	// Get the Trash box path and metadata path
-	trashPath := filepath.Join(trashDir, path)
+	trashPath := filepath.Join(trashDir, item.Name)
 	metadataPath := trashPath + trashboxMetadataExt
 
 	// Open metadata file to get original file path
@@ -140,6 +150,9 @@ func Restore(path string) error {
 	if err != nil {
 		return err
 	}
+	if metadata.OriginalPath != item.OriginalPath {
+		return fmt.Errorf("%q in the Trash is not from %q", item.Name, item.OriginalPath)
+	}
 
 	// Put back file to original path
 	err = os.Rename(trashPath, metadata.OriginalPath)
@@ -155,3 +168,23 @@ func Restore(path string) error {
 
 	return nil
 }
+
+// remove permanently deletes the item and its metadata file from the Trash.
+func remove(item Item) error {
+	trashPath := filepath.Join(trashDir, item.Name)
+	err := os.RemoveAll(trashPath)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(trashPath + trashboxMetadataExt)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// contains checks if the item is still in the Trash.
+func contains(item Item) bool {
+	_, err := os.Lstat(filepath.Join(trashDir, item.Name))
+	return err == nil
+}
@@ -1,157 +1,491 @@
 //go:build linux
 
 // Package trash.
-// This file contains code from the project github.com/Kei-K23/trashbox,
-// with modifications to fit the rest of the project.
-// Source: https://github.com/Kei-K23/trashbox.
-// License: MIT
+// This file implements the FreeDesktop.org Trash specification so that the files disk puts in the
+// trash show up in, and can be restored by, regular file managers.
+// Specification: https://specifications.freedesktop.org/trash-spec/latest/
 package trash
 
 import (
-	"encoding/json"
+	"bufio"
 	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sebastianappelberg/disk/pkg/storage"
+)
+
+const (
+	trashInfoExt       = ".trashinfo"
+	trashInfoHeader    = "[Trash Info]"
+	deletionDateLayout = "2006-01-02T15:04:05"
+	directorySizesName = "directorysizes"
+	// maxNameAttempts is how many unique names we try before giving up on putting a file in the trash.
+	maxNameAttempts = 10000
 )
 
-type metadata struct {
-	OriginalPath string `json:"original_path"`
+// trashDir is a trash directory, i.e. a directory containing a "files" and an "info" directory.
+type trashDir struct {
+	// root is the path to the trash directory.
+	root string
+	// topDir is the top directory of the volume for per-volume trash directories, empty for the home trash.
+	// Paths in the trashinfo files of per-volume trash directories are relative to topDir.
+	topDir string
 }
 
-// Put moves the specified files or directories to the Linux Trash.
-//
-// This function takes the path multiple files or directories as an argument,
-// converts it to an absolute path, and then moves it to the user's
-// Trash directory located at ~/.local/share/Trash/files. If the
-// provided path does not exist, or if the Trash directory does not
-// exist, an error will be returned.
-//
-// If the operation is successful, the file or directory will no
-// longer exist at the original path and will be relocated to the
-// Trash for potential recovery.
-//
-// Parameters:
-//   - filePaths: The path of the files or directories to be moved to Trash.
-//
-// Returns:
-//   - error: Returns nil on success. If an error occurs during the
-//     process (e.g., if the file does not exist or the move fails),
-//     an error will be returned explaining the reason for failure.
-//     Specifically, if the Trash directory does not exist, an
-//     error indicating that will be returned.
+func (t trashDir) filesDir() string {
+	return filepath.Join(t.root, "files")
+}
+
+func (t trashDir) infoDir() string {
+	return filepath.Join(t.root, "info")
+}
+
+func (t trashDir) infoPath(name string) string {
+	return filepath.Join(t.infoDir(), name+trashInfoExt)
+}
+
+// originalPath returns the absolute path that the file described by info had before it was put in the trash.
+func (t trashDir) originalPath(info trashInfo) string {
+	if filepath.IsAbs(info.Path) {
+		return info.Path
+	}
+	return filepath.Join(t.topDir, info.Path)
+}
+
+type trashInfo struct {
+	// Path is where the file was located before it was put in the trash. It's relative to
+	// the top directory for per-volume trash directories.
+	Path         string
+	DeletionDate time.Time
+}
+
+// put moves the file or directory to the Linux Trash.
 //
-// Example:
+// Files are moved to the home trash located at $XDG_DATA_HOME/Trash. If a file resides on another
+// volume than the home trash it's instead moved to the trash directory at the top of that volume,
+// $topdir/.Trash/$uid or $topdir/.Trash-$uid.
 //
-//	err := Put("path/to/your/file.txt")
-//	if err != nil {
-//	    log.Fatalf("Failed to move to Trash: %v", err)
-//	}
-func Put(filePaths ...string) error {
-	for _, filePath := range filePaths {
-		err := put(filePath)
+// For every file a .trashinfo file is written to the "info" directory of the trash, which contains the
+// original location of the file and the time of deletion. Files with the same name are given a unique
+// name in the trash so that they don't overwrite each other.
+func put(path string) (Item, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return Item{}, err
+	}
+	fileInfo, err := os.Lstat(absPath)
+	if err != nil {
+		return Item{}, err
+	}
+
+	item, err := putIn(homeTrash(), absPath, fileInfo)
+	if !errors.Is(err, syscall.EXDEV) {
+		return item, err
+	}
+	// The file is on another volume than the home trash so it has to go in the trash of that volume.
+	topDir, err := findTopDir(absPath)
+	if err != nil {
+		return Item{}, err
+	}
+	trash, err := topDirTrash(topDir)
+	if err != nil {
+		return Item{}, err
+	}
+	return putIn(trash, absPath, fileInfo)
+}
+
+// putIn moves the file at absPath to the given trash directory.
+func putIn(trash trashDir, absPath string, fileInfo fs.FileInfo) (Item, error) {
+	for _, dir := range []string{trash.filesDir(), trash.infoDir()} {
+		err := os.MkdirAll(dir, 0700)
 		if err != nil {
-			return err
+			return Item{}, err
 		}
 	}
-	return nil
-}
 
-func put(path string) error {
-	absPath, err := filepath.Abs(path)
+	infoPath := absPath
+	if trash.topDir != "" {
+		rel, err := filepath.Rel(trash.topDir, absPath)
+		if err != nil {
+			return Item{}, err
+		}
+		infoPath = rel
+	}
+	info := trashInfo{Path: infoPath, DeletionDate: time.Now()}
+
+	name, err := createTrashInfo(trash, filepath.Base(absPath), info)
 	if err != nil {
-		return err
+		return Item{}, err
+	}
+	size := sizeOf(absPath, fileInfo)
+	err = os.Rename(absPath, filepath.Join(trash.filesDir(), name))
+	if err != nil {
+		// The file was never moved so the trashinfo file would point to nothing.
+		_ = os.Remove(trash.infoPath(name))
+		return Item{}, err
 	}
 
-	// Get the file path to trash file
-	trashDir := getTrashDir()
-	if _, err = os.Stat(trashDir); os.IsNotExist(err) {
-		return errors.New("trash directory does not exist")
+	item := Item{Name: name, OriginalPath: absPath, DeletedAt: info.DeletionDate, Size: size}
+	if fileInfo.IsDir() {
+		return item, updateDirectorySizes(trash, map[string]int64{name: size})
 	}
+	return item, nil
+}
 
-	trashPath := filepath.Join(trashDir, filepath.Base(absPath))
-	// Move the file to trash directory
-	err = os.Rename(absPath, trashPath)
-	if err != nil {
-		return err
+// createTrashInfo writes the trashinfo file for a file with the given base name. It returns the unique
+// name that the file should be given in the trash.
+func createTrashInfo(trash trashDir, base string, info trashInfo) (string, error) {
+	for i := 1; i <= maxNameAttempts; i++ {
+		name := base
+		if i > 1 {
+			name = fmt.Sprintf("%s.%d", base, i)
+		}
+		if _, err := os.Lstat(filepath.Join(trash.filesDir(), name)); err == nil {
+			continue
+		}
+		// O_EXCL makes the creation atomic, which is how the specification says that
+		// a name is reserved in the trash.
+		file, err := os.OpenFile(trash.infoPath(name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		_, err = file.WriteString(formatTrashInfo(info))
+		closeErr := file.Close()
+		if err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			_ = os.Remove(trash.infoPath(name))
+			return "", err
+		}
+		return name, nil
+	}
+	return "", fmt.Errorf("could not find a unique name for %q in %s", base, trash.root)
+}
+
+func formatTrashInfo(info trashInfo) string {
+	return fmt.Sprintf("%s\nPath=%s\nDeletionDate=%s\n",
+		trashInfoHeader,
+		escapePath(info.Path),
+		info.DeletionDate.Format(deletionDateLayout),
+	)
+}
+
+func parseTrashInfo(data string) (trashInfo, error) {
+	var info trashInfo
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	inGroup := false
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			inGroup = line == trashInfoHeader
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !inGroup || !ok {
+			continue
+		}
+		switch key {
+		case "Path":
+			path, err := url.PathUnescape(value)
+			if err != nil {
+				return info, fmt.Errorf("invalid path %q: %w", value, err)
+			}
+			info.Path = path
+		case "DeletionDate":
+			date, err := time.ParseInLocation(deletionDateLayout, value, time.Local)
+			if err != nil {
+				return info, fmt.Errorf("invalid deletion date %q: %w", value, err)
+			}
+			info.DeletionDate = date
+		}
+	}
+	if info.Path == "" {
+		return info, errors.New("trashinfo file is missing the path")
 	}
+	return info, scanner.Err()
+}
+
+// escapePath escapes the path like a URL path but keeps the slashes, which is what the specification requires.
+func escapePath(path string) string {
+	return (&url.URL{Path: path}).EscapedPath()
+}
 
-	// Create metadata file for recovery the deleted file
-	metadata := metadata{OriginalPath: absPath}
-	metadataPath := trashPath + ".metadata.json"
+// updateDirectorySizes rewrites the directorysizes cache of the trash so that it contains an entry
+// for every directory in the trash. File managers use it to avoid calculating the size of the trash
+// by walking all of it. The sizes of directories that were just put in the trash can be passed in
+// known to avoid walking them again.
+func updateDirectorySizes(trash trashDir, known map[string]int64) error {
+	sizesPath := filepath.Join(trash.root, directorySizesName)
+	existing := readDirectorySizes(sizesPath)
 
-	// Create metadata file in Trash bin
-	metadataFile, err := os.Create(metadataPath)
+	entries, err := os.ReadDir(trash.filesDir())
 	if err != nil {
 		return err
 	}
-	defer metadataFile.Close()
+	var b strings.Builder
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		infoStat, err := os.Stat(trash.infoPath(entry.Name()))
+		if err != nil {
+			// Entries without a trashinfo file aren't valid trash entries.
+			continue
+		}
+		mtime := infoStat.ModTime().Unix()
+		size, ok := existing[entry.Name()]
+		if knownSize, isKnown := known[entry.Name()]; isKnown {
+			size = directorySize{size: knownSize, mtime: mtime}
+		} else if !ok || size.mtime != mtime {
+			dirInfo, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			dir := filepath.Join(trash.filesDir(), entry.Name())
+			size = directorySize{size: sizeOf(dir, dirInfo), mtime: mtime}
+		}
+		fmt.Fprintf(&b, "%d %d %s\n", size.size, size.mtime, url.PathEscape(entry.Name()))
+	}
 
-	encoder := json.NewEncoder(metadataFile)
-	err = encoder.Encode(metadata)
+	// Write to a temporary file and rename it so that readers never see a half written file.
+	tmp, err := os.CreateTemp(trash.root, directorySizesName+".*")
 	if err != nil {
 		return err
 	}
+	_, err = tmp.WriteString(b.String())
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), sizesPath)
+}
 
-	return nil
+type directorySize struct {
+	size  int64
+	mtime int64
 }
 
-// Restore restores a previously deleted file from the Trash to its original location.
-// The original location is determined from the metadata generated when the file was moved to Trash.
-//
-// Parameters:
-//
-//	path (string): The name of the file or directory to be restored from Trash.
-//
-// Returns:
-//
-//	error: Returns an error if the file cannot be restored or if there are issues
-//	       with reading the metadata file. Returns nil if successful.
-//
-// Example usage:
-//
-//	err := Restore("file.txt")
-//	if err != nil {
-//	    log.Fatalf("Failed to put back file from Trash: %v", err)
-//	}
+// readDirectorySizes reads the directorysizes cache. Malformed lines are ignored since the cache is rebuilt anyway.
+func readDirectorySizes(path string) map[string]directorySize {
+	sizes := make(map[string]directorySize)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return sizes
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		size, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		mtime, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		name, err := url.PathUnescape(fields[2])
+		if err != nil {
+			continue
+		}
+		sizes[name] = directorySize{size: size, mtime: mtime}
+	}
+	return sizes
+}
+
+// restore restores a previously deleted file from the Trash to its original location.
+// The original location is determined from the trashinfo file that was written when the file was moved to Trash.
+// It fails if there already is a file at the original location.
 //
-// Notes:
-//   - The function depends on a metadata file (generated by Put) being present
-//     in the Trash directory, which contains the original path.
-//   - On success, the metadata file is removed from the Trash.
-func Restore(path string) error {
-	// Get the Trash box path and metadata path
-	trashPath := getTrashDir()
-	metadataPath := trashPath + ".metadata.json"
-
-	// Open metadata file to get original file path
-	metadataFile, err := os.Open(metadataPath)
+// The home trash is searched first, then the trash directories at the top of every mounted volume.
+// On success, the trashinfo file is removed from the Trash.
+func restore(item Item) error {
+	trash, data, err := findTrashInfo(item)
 	if err != nil {
 		return err
 	}
-	defer metadataFile.Close()
+	return restoreFrom(trash, item.Name, data)
+}
 
-	var metadata metadata
-	decoder := json.NewDecoder(metadataFile)
-	err = decoder.Decode(&metadata)
+// remove permanently deletes the item and its trashinfo file from the Trash.
+func remove(item Item) error {
+	trash, _, err := findTrashInfo(item)
 	if err != nil {
 		return err
 	}
-
-	// Put back file to original path
-	err = os.Rename(trashPath, metadata.OriginalPath)
+	err = os.RemoveAll(filepath.Join(trash.filesDir(), item.Name))
 	if err != nil {
 		return err
 	}
+	err = os.Remove(trash.infoPath(item.Name))
+	if err != nil {
+		return err
+	}
+	return updateDirectorySizes(trash, nil)
+}
 
-	// Remove the metadata file
-	err = os.Remove(metadataPath)
+// contains checks if the item is still in the Trash.
+func contains(item Item) bool {
+	_, _, err := findTrashInfo(item)
+	return err == nil
+}
+
+// findTrashInfo finds the trash directory that holds the item and returns the content of its trashinfo file.
+// The original path is compared as well since every trash directory has its own names, and another application
+// might have put a file with the same name in the Trash after the item was removed.
+func findTrashInfo(item Item) (trashDir, string, error) {
+	for _, trash := range trashDirs() {
+		data, err := os.ReadFile(trash.infoPath(item.Name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return trashDir{}, "", err
+		}
+		info, err := parseTrashInfo(string(data))
+		if err != nil || trash.originalPath(info) != item.OriginalPath {
+			continue
+		}
+		return trash, string(data), nil
+	}
+	return trashDir{}, "", fmt.Errorf("%q not found in trash", item.Name)
+}
+
+func restoreFrom(trash trashDir, name, data string) error {
+	info, err := parseTrashInfo(data)
+	if err != nil {
+		return err
+	}
+	originalPath := trash.originalPath(info)
+	if _, err = os.Lstat(originalPath); err == nil {
+		return fmt.Errorf("can't restore %q: %q already exists", name, originalPath)
+	}
+	err = os.MkdirAll(filepath.Dir(originalPath), 0755)
 	if err != nil {
 		return err
 	}
 
+	trashedPath := filepath.Join(trash.filesDir(), name)
+	fileInfo, err := os.Lstat(trashedPath)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(trashedPath, originalPath)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(trash.infoPath(name))
+	if err != nil {
+		return err
+	}
+	if fileInfo.IsDir() {
+		return updateDirectorySizes(trash, nil)
+	}
 	return nil
 }
 
-func getTrashDir() string {
-	return filepath.Join(os.Getenv("HOME"), ".local/share/Trash/files")
+// homeTrash returns the trash directory of the user, $XDG_DATA_HOME/Trash.
+func homeTrash() trashDir {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		dataHome = filepath.Join(os.Getenv("HOME"), ".local", "share")
+	}
+	return trashDir{root: filepath.Join(dataHome, "Trash")}
+}
+
+// topDirTrash returns the trash directory to use for files on the volume mounted at topDir.
+// $topdir/.Trash/$uid is used if the administrator has set up a $topdir/.Trash directory,
+// otherwise $topdir/.Trash-$uid is used.
+func topDirTrash(topDir string) (trashDir, error) {
+	uid := strconv.Itoa(os.Getuid())
+	adminTrash := filepath.Join(topDir, ".Trash")
+	if isValidAdminTrash(adminTrash) {
+		return trashDir{root: filepath.Join(adminTrash, uid), topDir: topDir}, nil
+	}
+	userTrash := filepath.Join(topDir, ".Trash-"+uid)
+	err := os.MkdirAll(userTrash, 0700)
+	if err != nil {
+		return trashDir{}, err
+	}
+	return trashDir{root: userTrash, topDir: topDir}, nil
+}
+
+// isValidAdminTrash checks that the $topdir/.Trash directory exists, isn't a symbolic link and has the sticky bit set.
+func isValidAdminTrash(path string) bool {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return false
+	}
+	return info.IsDir() && info.Mode()&os.ModeSticky != 0
+}
+
+// trashDirs returns the home trash followed by the existing trash directories at the top of every mounted volume.
+func trashDirs() []trashDir {
+	dirs := []trashDir{homeTrash()}
+	mounts, err := storage.GetAvailableDisks()
+	if err != nil {
+		return dirs
+	}
+	uid := strconv.Itoa(os.Getuid())
+	for _, mount := range mounts {
+		for _, root := range []string{filepath.Join(mount, ".Trash", uid), filepath.Join(mount, ".Trash-"+uid)} {
+			if info, err := os.Stat(root); err == nil && info.IsDir() {
+				dirs = append(dirs, trashDir{root: root, topDir: mount})
+			}
+		}
+	}
+	return dirs
+}
+
+// findTopDir returns the mount point of the volume that path resides on by walking up the
+// directory tree until the device changes.
+func findTopDir(path string) (string, error) {
+	dev, err := deviceOf(path)
+	if err != nil {
+		return "", err
+	}
+	current := filepath.Dir(path)
+	for {
+		parent := filepath.Dir(current)
+		if parent == current {
+			return current, nil
+		}
+		parentDev, err := deviceOf(parent)
+		if err != nil {
+			return "", err
+		}
+		if parentDev != dev {
+			return current, nil
+		}
+		current = parent
+	}
+}
+
+func deviceOf(path string) (uint64, error) {
+	var stat syscall.Stat_t
+	err := syscall.Lstat(path, &stat)
+	if err != nil {
+		return 0, err
+	}
+	return stat.Dev, nil
 }
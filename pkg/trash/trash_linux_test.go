@@ -0,0 +1,278 @@
+//go:build linux
+
+package trash
+
+import (
+	"github.com/sebastianappelberg/disk/pkg/cache"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// Never touch the real trash of the user running the tests.
+	dataHome, err := os.MkdirTemp("", "disk-trash-test")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("XDG_DATA_HOME", dataHome)
+	testRegistry := cache.NewCache[Item](dataHome, "trash")
+	registry = func() *cache.Cache[Item] { return testRegistry }
+	code := m.Run()
+	os.RemoveAll(dataHome)
+	os.Exit(code)
+}
+
+func createFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	err := os.WriteFile(path, []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPut_WritesTrashInfo(t *testing.T) {
+	dir := t.TempDir()
+	path := createFile(t, dir, "put info.txt", "foo")
+
+	err := Put(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected %q to be moved", path)
+	}
+
+	trash := homeTrash()
+	if _, err = os.Stat(filepath.Join(trash.filesDir(), "put info.txt")); err != nil {
+		t.Errorf("expected file in trash: %v", err)
+	}
+	data, err := os.ReadFile(trash.infoPath("put info.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "[Trash Info]\n") {
+		t.Errorf("expected trashinfo header, got %q", data)
+	}
+	if !strings.Contains(string(data), "Path="+escapePath(path)+"\n") {
+		t.Errorf("expected escaped path in trashinfo, got %q", data)
+	}
+	if !strings.Contains(string(data), "put%20info.txt") {
+		t.Errorf("expected space to be escaped, got %q", data)
+	}
+}
+
+func TestPut_UniqueNames(t *testing.T) {
+	first := createFile(t, t.TempDir(), "same.txt", "first")
+	second := createFile(t, t.TempDir(), "same.txt", "second")
+
+	err := Put(first, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trash := homeTrash()
+	for name, expected := range map[string]string{"same.txt": "first", "same.txt.2": "second"} {
+		data, err := os.ReadFile(filepath.Join(trash.filesDir(), name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected {
+			t.Errorf("%s: got %q, want %q", name, data, expected)
+		}
+	}
+}
+
+func TestPutAndRestore_Directory(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "restore_dir")
+	err := os.Mkdir(dir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	createFile(t, dir, "a.txt", "12345")
+	createFile(t, dir, "b.txt", "123")
+
+	items, err := PutItems(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trash := homeTrash()
+	sizes := readDirectorySizes(filepath.Join(trash.root, directorySizesName))
+	if sizes["restore_dir"].size != 8 {
+		t.Errorf("expected directorysizes entry of 8 bytes, got %+v", sizes["restore_dir"])
+	}
+
+	err = Restore(items[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "a.txt"))
+	if err != nil || string(data) != "12345" {
+		t.Errorf("expected restored content, got %q, %v", data, err)
+	}
+	if _, err = os.Stat(trash.infoPath("restore_dir")); !os.IsNotExist(err) {
+		t.Error("expected trashinfo file to be removed")
+	}
+	sizes = readDirectorySizes(filepath.Join(trash.root, directorySizesName))
+	if _, ok := sizes["restore_dir"]; ok {
+		t.Error("expected directorysizes entry to be removed")
+	}
+}
+
+func TestListAndDelete(t *testing.T) {
+	dir := t.TempDir()
+	kept := createFile(t, dir, "list_kept.txt", "kept")
+	deleted := createFile(t, dir, "list_deleted.txt", "deleted!")
+	err := Put(kept, deleted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	items := make(map[string]Item)
+	for _, item := range List() {
+		items[item.Name] = item
+	}
+	item, ok := items["list_deleted.txt"]
+	if !ok {
+		t.Fatalf("expected list_deleted.txt to be listed, got %v", items)
+	}
+	if item.OriginalPath != deleted || item.Size != 8 {
+		t.Errorf("unexpected item: %+v", item)
+	}
+
+	err = Delete(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(homeTrash().filesDir(), "list_deleted.txt")); !os.IsNotExist(err) {
+		t.Error("expected file to be permanently deleted")
+	}
+	for _, item := range List() {
+		if item.Name == "list_deleted.txt" {
+			t.Error("expected deleted item to not be listed")
+		}
+	}
+}
+
+func TestList_ForgetsItemsRemovedByOthers(t *testing.T) {
+	path := createFile(t, t.TempDir(), "list_emptied.txt", "foo")
+	items, err := PutItems(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Simulate that the user emptied the trash with their file manager.
+	trash := homeTrash()
+	os.Remove(filepath.Join(trash.filesDir(), "list_emptied.txt"))
+	os.Remove(trash.infoPath("list_emptied.txt"))
+
+	for _, item := range List() {
+		if item.Name == "list_emptied.txt" {
+			t.Error("expected emptied item to not be listed")
+		}
+	}
+	if _, ok := registry().Get(items[0].key()); ok {
+		t.Error("expected emptied item to be forgotten")
+	}
+}
+
+func TestRestore_SameName(t *testing.T) {
+	first := filepath.Join(t.TempDir(), "node_modules")
+	second := filepath.Join(t.TempDir(), "node_modules")
+	for _, dir := range []string{first, second} {
+		err := os.Mkdir(dir, 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		createFile(t, dir, "origin.txt", dir)
+	}
+	items, err := PutItems(first, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listed := 0
+	for _, item := range List() {
+		if item.OriginalPath == first || item.OriginalPath == second {
+			listed++
+		}
+	}
+	if listed != 2 {
+		t.Fatalf("expected both items to be listed, got %d", listed)
+	}
+	for i := len(items) - 1; i >= 0; i-- {
+		err = Restore(items[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, dir := range []string{first, second} {
+		data, err := os.ReadFile(filepath.Join(dir, "origin.txt"))
+		if err != nil || string(data) != dir {
+			t.Errorf("expected %q to be restored to its own location, got %q, %v", dir, data, err)
+		}
+	}
+}
+
+func TestRestore_ExistingFile(t *testing.T) {
+	dir := t.TempDir()
+	path := createFile(t, dir, "existing.txt", "old")
+	items, err := PutItems(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	createFile(t, dir, "existing.txt", "new")
+
+	err = Restore(items[0])
+	if err == nil {
+		t.Error("expected restore to fail when the original path is taken")
+	}
+}
+
+func TestRestore_NotFound(t *testing.T) {
+	err := Restore(Item{Name: "does-not-exist.txt", OriginalPath: "/does-not-exist.txt"})
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestParseTrashInfo(t *testing.T) {
+	data := "[Trash Info]\nPath=/home/user/some%20file.txt\nDeletionDate=2004-08-31T22:32:08\n"
+	info, err := parseTrashInfo(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Path != "/home/user/some file.txt" {
+		t.Errorf("got path %q", info.Path)
+	}
+	expected := time.Date(2004, 8, 31, 22, 32, 8, 0, time.Local)
+	if !info.DeletionDate.Equal(expected) {
+		t.Errorf("got deletion date %v, want %v", info.DeletionDate, expected)
+	}
+
+	_, err = parseTrashInfo("[Other Group]\nPath=/foo\n")
+	if err == nil {
+		t.Error("expected an error when the path is outside the Trash Info group")
+	}
+}
+
+func TestFindTopDir(t *testing.T) {
+	dir := t.TempDir()
+	path := createFile(t, dir, "topdir.txt", "foo")
+	topDir, err := findTopDir(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(path, topDir) {
+		t.Errorf("expected %q to be an ancestor of %q", topDir, path)
+	}
+	dev, _ := deviceOf(path)
+	topDev, _ := deviceOf(topDir)
+	if dev != topDev {
+		t.Errorf("expected %q to be on the same device as %q", topDir, path)
+	}
+}
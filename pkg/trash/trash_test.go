@@ -1,6 +1,7 @@
 package trash
 
 import (
+	"path/filepath"
 	"testing"
 )
 
@@ -12,8 +13,18 @@ func TestMoveToTrash(t *testing.T) {
 }
 
 func TestRestore(t *testing.T) {
-	err := Restore("test.txt")
+	path, err := filepath.Abs("test.txt")
 	if err != nil {
-		t.Fatalf("failed to move file to trash: %v", err)
+		t.Fatal(err)
+	}
+	for _, item := range List() {
+		if item.OriginalPath == path {
+			err = Restore(item)
+			if err != nil {
+				t.Fatalf("failed to move file to trash: %v", err)
+			}
+			return
+		}
 	}
+	t.Fatalf("%q not found in trash", path)
 }
@@ -12,7 +12,9 @@ import (
 	"github.com/go-ole/go-ole"
 	"github.com/go-ole/go-ole/oleutil"
 	"golang.org/x/sys/windows"
+	"os"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 	"unsafe"
@@ -42,20 +44,23 @@ var (
 	procSHFileOperation = shell32.NewProc("SHFileOperationW")
 )
 
-func Put(filenames ...string) error {
-	pFromData := make([]uint16, 0, 256)
-	for _, filename := range filenames {
-		absPath, err := filepath.Abs(filename)
-		if err != nil {
-			return fmt.Errorf("failed to get absolute path: %v", err)
-		}
+// put moves the file or directory to the Recycle Bin.
+func put(filename string) (Item, error) {
+	absPath, err := filepath.Abs(filename)
+	if err != nil {
+		return Item{}, fmt.Errorf("failed to get absolute path: %v", err)
+	}
+	info, err := os.Stat(absPath)
+	if err != nil {
+		return Item{}, err
+	}
+	size := sizeOf(absPath, info)
 
-		ptr, err := windows.UTF16FromString(absPath)
-		if err != nil {
-			return fmt.Errorf("failed to convert path %q: %v", absPath, err)
-		}
-		pFromData = append(pFromData, ptr...)
+	pFromData, err := windows.UTF16FromString(absPath)
+	if err != nil {
+		return Item{}, fmt.Errorf("failed to convert path %q: %v", absPath, err)
 	}
+	// pFrom has to be terminated by a double null character.
 	pFromData = append(pFromData, 0)
 
 	title := []uint16{0, 0}
@@ -69,18 +74,75 @@ func Put(filenames ...string) error {
 
 	ret, _, _ := procSHFileOperation.Call(uintptr(unsafe.Pointer(param)))
 	if ret != 0 {
-		return fmt.Errorf("operation on %s failed with error code: %v", filenames, ret)
+		return Item{}, fmt.Errorf("operation on %s failed with error code: %v", absPath, ret)
+	}
+
+	item := Item{
+		Name:         filepath.Base(absPath),
+		OriginalPath: absPath,
+		DeletedAt:    time.Now(),
+		Size:         size,
 	}
+	return item, nil
+}
 
-	return nil
+// restore restores the item from the Recycle Bin. Items keep their name in the Recycle Bin so the original
+// location is compared as well to tell items with the same name apart.
+func restore(item Item) error {
+	return withRecycleBinItem(item, func(folder, recycled *ole.IDispatch) error {
+		_, err := recycled.CallMethod("InvokeVerb", "undelete")
+		if err != nil {
+			return err
+		}
+		// InvokeVerb is asynchronous so we need to wait for the call to finish.
+		for range 30 {
+			if _, err = os.Lstat(item.OriginalPath); err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return nil
+	})
 }
 
-func Restore(fileName string) error {
-	// Initialize COM
+func getOriginalPath(folder *ole.IDispatch, item *ole.IDispatch) string {
+	// The column index for "Original Location" varies by system and language.
+	// It's usually the second column, so index 1. You may need to adjust this.
+	const originalPathColumnIndex = 1
+	details := oleutil.MustCallMethod(folder, "GetDetailsOf", item, originalPathColumnIndex).ToString()
+	return details
+}
+
+// remove permanently deletes the item from the Recycle Bin.
+func remove(item Item) error {
+	return withRecycleBinItem(item, func(folder, recycled *ole.IDispatch) error {
+		// Path is the location of the item inside the Recycle Bin, i.e. $Recycle.Bin\<SID>\$R<id>.
+		// The original path and deletion date is stored in a sibling $I<id> file which has to be removed as well.
+		path := oleutil.MustGetProperty(recycled, "Path").ToString()
+		err := os.RemoveAll(path)
+		if err != nil {
+			return err
+		}
+		dir, name := filepath.Split(path)
+		infoPath := filepath.Join(dir, strings.Replace(name, "$R", "$I", 1))
+		err = os.Remove(infoPath)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	})
+}
+
+// contains checks if the item is still in the Recycle Bin.
+func contains(item Item) bool {
+	return withRecycleBinItem(item, func(_, _ *ole.IDispatch) error { return nil }) == nil
+}
+
+// withRecycleBinItem calls f with the Recycle Bin item that matches the name and original location of item.
+func withRecycleBinItem(item Item, f func(folder, recycled *ole.IDispatch) error) error {
 	ole.CoInitialize(0)
 	defer ole.CoUninitialize()
 
-	// Get the Shell.Application COM object
 	unknown, err := oleutil.CreateObject("Shell.Application")
 	if err != nil {
 		return fmt.Errorf("failed to create Shell.Application object: %v", err)
@@ -93,54 +155,32 @@ func Restore(fileName string) error {
 	}
 	defer shellApp.Release()
 
-	// Get the Recycle Bin folder
 	recycleBinFolder := oleutil.MustCallMethod(shellApp, "NameSpace", 10).ToIDispatch()
 	if recycleBinFolder == nil {
 		return fmt.Errorf("failed to get Recycle Bin folder")
 	}
 	defer recycleBinFolder.Release()
 
-	// Enumerate items in the Recycle Bin
 	items := oleutil.MustCallMethod(recycleBinFolder, "Items").ToIDispatch()
 	if items == nil {
 		return fmt.Errorf("failed to enumerate items in Recycle Bin")
 	}
 	defer items.Release()
 
+	originalDir := filepath.Dir(item.OriginalPath)
 	count := oleutil.MustGetProperty(items, "Count").Val
 	for i := 0; i < int(count); i++ {
-		item := oleutil.MustCallMethod(items, "Item", i).ToIDispatch()
-		if item == nil {
+		recycled := oleutil.MustCallMethod(items, "Item", i).ToIDispatch()
+		if recycled == nil {
 			continue
 		}
-
-		name := oleutil.MustGetProperty(item, "Name").ToString()
-		if name == fileName {
-			_, err = item.CallMethod("InvokeVerb", "undelete")
-			if err != nil {
-				return err
-			}
-			// InvokeVerb is asynchronous so we need to wait for the call to finish.
-			for range 30 {
-				originalPath := getOriginalPath(recycleBinFolder, item)
-				if originalPath != "" {
-					break
-				}
-				time.Sleep(10 * time.Millisecond)
-			}
-			item.Release()
-			return nil
+		name := oleutil.MustGetProperty(recycled, "Name").ToString()
+		if name == item.Name && strings.EqualFold(getOriginalPath(recycleBinFolder, recycled), originalDir) {
+			err = f(recycleBinFolder, recycled)
+			recycled.Release()
+			return err
 		}
-		item.Release()
+		recycled.Release()
 	}
-
-	return fmt.Errorf("file '%s' not found in Recycle Bin", fileName)
-}
-
-func getOriginalPath(folder *ole.IDispatch, item *ole.IDispatch) string {
-	// The column index for "Original Location" varies by system and language.
-	// It's usually the second column, so index 1. You may need to adjust this.
-	const originalPathColumnIndex = 1
-	details := oleutil.MustCallMethod(folder, "GetDetailsOf", item, originalPathColumnIndex).ToString()
-	return details
+	return fmt.Errorf("file '%s' not found in Recycle Bin", item.Name)
 }
@@ -3,9 +3,12 @@ package util
 import (
 	"fmt"
 	"os"
+	"path"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 const pathSeparator = string(os.PathSeparator)
@@ -17,6 +20,39 @@ func Time(label string) func() {
 	}
 }
 
+// ParseDuration is like time.ParseDuration but also supports days and weeks, e.g. "30d" and "2w",
+// since that's the granularity that makes sense when talking about the age of files.
+func ParseDuration(s string) (time.Duration, error) {
+	units := map[string]time.Duration{
+		"d": 24 * time.Hour,
+		"w": 7 * 24 * time.Hour,
+	}
+	for suffix, unit := range units {
+		if n, ok := strings.CutSuffix(s, suffix); ok {
+			value, err := strconv.Atoi(n)
+			if err != nil || value < 0 {
+				return 0, fmt.Errorf("invalid duration %q", s)
+			}
+			return time.Duration(value) * unit, nil
+		}
+	}
+	return time.ParseDuration(s)
+}
+
+// FuzzyMatch reports whether all characters of pattern appear in s in the same order, ignoring case,
+// e.g. "nmod" matches "node_modules".
+func FuzzyMatch(pattern, s string) bool {
+	s = strings.ToLower(s)
+	for _, r := range strings.ToLower(pattern) {
+		i := strings.IndexRune(s, r)
+		if i < 0 {
+			return false
+		}
+		s = s[i+utf8.RuneLen(r):]
+	}
+	return true
+}
+
 // SimpleJoin takes only two arguments and joins them by
 // os.PathSeparator. It's meant to be a more performant but less flexible version
 // of filepath.Join when you know how dir and name looks like.
@@ -121,3 +157,30 @@ func commonBase(path1, path2 string) string {
 
 	return strings.Join(commonSegments, sep)
 }
+
+// MatchSegments reports whether parts match the segments of a gitignore-style pattern, both split by "/". Every
+// segment is matched with path.Match, except "**" which matches any number of parts, or at least one at the end,
+// i.e. everything inside a folder.
+func MatchSegments(segments []string, parts []string) bool {
+	for len(segments) > 0 {
+		if segments[0] == "**" {
+			if len(segments) == 1 {
+				return len(parts) > 0
+			}
+			for i := 0; i <= len(parts); i++ {
+				if MatchSegments(segments[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(segments[0], parts[0]); !ok {
+			return false
+		}
+		segments, parts = segments[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
@@ -2,6 +2,7 @@ package util
 
 import (
 	"testing"
+	"time"
 )
 
 func BenchmarkSimpleJoin(b *testing.B) {
@@ -10,6 +11,65 @@ func BenchmarkSimpleJoin(b *testing.B) {
 	}
 }
 
+func TestFuzzyMatch(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		s        string
+		expected bool
+	}{
+		{"", "/src/app/node_modules", true},
+		{"nmod", "/src/app/node_modules", true},
+		{"APP", "/src/app/node_modules", true},
+		{"app/node", "/src/app/node_modules", true},
+		{"modnode", "/src/app/node_modules", false},
+		{"target", "/src/app/node_modules", false},
+		{"åä", "/Musik/Åsa/Älg", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			got := FuzzyMatch(tt.pattern, tt.s)
+			if got != tt.expected {
+				t.Errorf("FuzzyMatch(%q, %q) = %v; want %v", tt.pattern, tt.s, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		input       string
+		expected    time.Duration
+		expectError bool
+	}{
+		{"30d", 30 * 24 * time.Hour, false},
+		{"0d", 0, false},
+		{"2w", 14 * 24 * time.Hour, false},
+		{"12h", 12 * time.Hour, false},
+		{"90m", 90 * time.Minute, false},
+		{"-1d", 0, true},
+		{"1.5d", 0, true},
+		{"d", 0, true},
+		{"thirty days", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseDuration(tt.input)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("ParseDuration(%q) expected an error, but got none. Got %v", tt.input, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("ParseDuration(%q) unexpected error: %v", tt.input, err)
+			} else if got != tt.expected {
+				t.Errorf("ParseDuration(%q) = %v; want %v", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
 func TestGetDirectoryDepth(t *testing.T) {
 	tests := []struct {
 		root     string